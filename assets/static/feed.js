@@ -0,0 +1,43 @@
+// Links with a data-fragment attribute load the next page of a post list in place: the posts are
+// added above the link, their comment sections next to the others, and the link is replaced by
+// the one for the page after. Without scripts, or when loading fails, the link is simply followed.
+document.addEventListener('click', async (event) => {
+    const link = event.target.closest('a[data-fragment]');
+    if (!link) {
+        return;
+    }
+    event.preventDefault();
+    if (link.classList.contains('loading')) {
+        return;
+    }
+    link.classList.add('loading');
+
+    let response;
+    try {
+        response = await fetch(link.dataset.fragment, { credentials: 'same-origin' });
+    } catch {
+        location.href = link.href;
+        return;
+    }
+    if (!response.ok || response.redirected) {
+        location.href = link.href;
+        return;
+    }
+
+    const page = document.createElement('div');
+    page.innerHTML = await response.text();
+
+    const threads = document.querySelector('.mainContainer');
+    if (threads) {
+        threads.before(...page.querySelector('.feedThreads').children);
+    }
+    const pager = link.closest('.pager') || link;
+    pager.before(...page.querySelector('.feedPosts').children);
+
+    const more = page.querySelector('a[data-fragment]');
+    if (more) {
+        link.replaceWith(more);
+    } else {
+        link.remove();
+    }
+});
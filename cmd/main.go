@@ -1,11 +1,110 @@
 package main
 
 import (
-	DB "root/internal/database"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
 	se "root/internal"
+	"root/internal/config"
+	DB "root/internal/database"
+	"root/internal/roles"
 )
 
 func main() {
-	DB.InitDB()
-	se.ServerRunner()
-}
\ No newline at end of file
+	// Every command opens the database, which needs FTS5; say how to build before anything runs
+	if !DB.FullTextSearch {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[0], DB.ErrNoFullTextSearch)
+		os.Exit(1)
+	}
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		// "promote-admin <username>" bootstraps the first admin, who can then hand out roles from /admin/roles
+		case "promote-admin":
+			promoteAdmin(os.Args[2:])
+			return
+		// "migrate status|up|down" manages the schema migrations by hand
+		case "migrate":
+			runMigrate(os.Args[2:])
+			return
+		}
+	}
+
+	cfg, err := config.Load("./config.json")
+	if err != nil {
+		log.Fatal(err)
+	}
+	DB.InitDB(cfg.Database.Migrations == "dry-run")
+	se.ServerRunner(cfg)
+}
+
+// promoteAdmin gives an existing account the admin role
+func promoteAdmin(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintf(os.Stderr, "usage: %s promote-admin <username>\n", os.Args[0])
+		os.Exit(2)
+	}
+
+	DB.InitDB(false)
+	err := DB.SetUserRoleByUsername(args[0], roles.Admin)
+	if err == sql.ErrNoRows {
+		log.Fatalf("There is no user called %q; register the account first", args[0])
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s is now an admin\n", args[0])
+}
+
+// runMigrate shows the migration status, applies pending migrations or rolls back applied ones
+func runMigrate(args []string) {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "usage: %s migrate status | up [-dry-run] | down [-steps n] [-dry-run]\n", os.Args[0])
+		os.Exit(2)
+	}
+	if len(args) == 0 {
+		usage()
+	}
+
+	flags := flag.NewFlagSet("migrate "+args[0], flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "print the SQL that would run without changing the database")
+	steps := flags.Int("steps", 1, "how many migrations to roll back")
+	flags.Parse(args[1:])
+
+	DB.Open()
+	switch args[0] {
+	case "status":
+		states, unknown, err := DB.MigrationStatus()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range states {
+			status := "pending"
+			if s.Applied {
+				status = "applied " + s.AppliedAt.Local().Format("02 Jan 2006, 15:04")
+			}
+			if s.Modified {
+				status += " (file changed since)"
+			}
+			fmt.Printf("%-40s %s\n", s.ID(), status)
+		}
+		for _, id := range unknown {
+			fmt.Printf("%-40s applied, but its file is missing\n", id)
+		}
+	case "up":
+		if _, err := DB.MigrateUp(*dryRun, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	case "down":
+		if *steps < 1 {
+			usage()
+		}
+		if err := DB.MigrateDown(*steps, *dryRun, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		usage()
+	}
+}
@@ -1,9 +1,10 @@
-module root
-
-go 1.23
-
-require (
-	github.com/gofrs/uuid v4.4.0+incompatible // indirect
-	github.com/mattn/go-sqlite3 v1.14.24 // indirect
-	golang.org/x/crypto v0.28.0 // indirect
-)
+module root
+
+go 1.23
+
+require (
+	github.com/gofrs/uuid v4.4.0+incompatible
+	github.com/mattn/go-sqlite3 v1.14.24
+	golang.org/x/crypto v0.28.0
+	rsc.io/qr v0.2.0
+)
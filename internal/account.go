@@ -0,0 +1,191 @@
+package root
+
+import (
+	"net/http"
+	database "root/internal/database"
+	"root/internal/models"
+	"root/internal/roles"
+	"sort"
+)
+
+// Account shows the account page with the linked login providers
+func Account(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	if r.URL.Path != "/account" {
+		http.Redirect(w, r, "/404", http.StatusFound)
+		return
+	}
+
+	cookie, err := r.Cookie("session_token")
+	if err != nil || cookie.Value == "" {
+		http.Redirect(w, r, "/auth", http.StatusSeeOther)
+		return
+	}
+
+	userID, err := database.FetchUserIDBySessionToken(cookie.Value)
+	if err != nil {
+		http.Redirect(w, r, "/auth", http.StatusSeeOther)
+		return
+	}
+
+	renderAccountPage(w, r, userID, "")
+}
+
+// renderAccountPage renders the account page with an optional error message
+func renderAccountPage(w http.ResponseWriter, r *http.Request, userID int, errorMessage string) {
+	username, err := database.FetchUsernameByUserID(userID)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	email, emailVerified, err := database.FetchUserEmail(userID)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	hasPassword, err := database.UserHasPassword(userID)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	perms, err := loadPermissions(userID)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	linked, err := database.FetchUserIdentities(userID)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	// Show every enabled provider, plus any linked provider that has since been disabled
+	linkedByProvider := map[string]models.Identity{}
+	for _, identity := range linked {
+		linkedByProvider[identity.Provider] = identity
+	}
+	var identities []models.Identity
+	for name, provider := range oauthProviders {
+		identity, isLinked := linkedByProvider[name]
+		if !isLinked && !provider.Enabled() {
+			continue
+		}
+		identity.Provider = name
+		identity.ProviderName = providerDisplayName(name)
+		identities = append(identities, identity)
+	}
+	sort.Slice(identities, func(i, j int) bool { return identities[i].Provider < identities[j].Provider })
+
+	data := struct {
+		CSRFToken           string
+		Username            string
+		Email               string
+		EmailVerified       bool
+		HasPassword         bool
+		CanUnlink           bool
+		Identities          []models.Identity
+		Role                roles.Role
+		CanInvite           bool
+		CanAssignRole       bool
+		CanManageCategories bool
+		ErrorMessage        string
+	}{
+		CSRFToken:     csrfToken(r),
+		Username:      username,
+		Email:         email,
+		EmailVerified: emailVerified,
+		HasPassword:   hasPassword,
+		// Never let the user remove their last way of signing in
+		CanUnlink:           hasPassword || len(linked) > 1,
+		Identities:          identities,
+		Role:                perms.role,
+		CanInvite:           perms.role.Has(roles.ManageInvites),
+		CanAssignRole:       perms.role.Has(roles.ManageRoles),
+		CanManageCategories: perms.role.Has(roles.ManageCategories),
+		ErrorMessage:        errorMessage,
+	}
+
+	err = templates.ExecuteTemplate(w, "account.html", data)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+	}
+}
+
+// LinkProvider starts an OAuth flow that links the chosen provider to the signed-in user
+func LinkProvider(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	cookie, err := r.Cookie("session_token")
+	if err != nil || cookie.Value == "" {
+		http.Redirect(w, r, "/auth", http.StatusSeeOther)
+		return
+	}
+
+	userID, err := database.FetchUserIDBySessionToken(cookie.Value)
+	if err != nil {
+		http.Redirect(w, r, "/auth", http.StatusSeeOther)
+		return
+	}
+
+	redirectToProvider(w, r, r.FormValue("provider"), userID)
+}
+
+// UnlinkProvider removes a linked provider, as long as the user keeps a way to sign in
+func UnlinkProvider(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	provider := r.FormValue("provider")
+	if provider == "" {
+		http.Redirect(w, r, "/400", http.StatusSeeOther)
+		return
+	}
+
+	cookie, err := r.Cookie("session_token")
+	if err != nil || cookie.Value == "" {
+		http.Redirect(w, r, "/auth", http.StatusSeeOther)
+		return
+	}
+
+	userID, err := database.FetchUserIDBySessionToken(cookie.Value)
+	if err != nil {
+		http.Redirect(w, r, "/auth", http.StatusSeeOther)
+		return
+	}
+
+	hasPassword, err := database.UserHasPassword(userID)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	linked, err := database.FetchUserIdentities(userID)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	if !hasPassword && len(linked) <= 1 {
+		renderAccountPage(w, r, userID, "You cannot unlink your only way of logging in.")
+		return
+	}
+
+	err = database.UnlinkIdentity(userID, provider)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
@@ -0,0 +1,291 @@
+package root
+
+import (
+	"database/sql"
+	"net/http"
+	"regexp"
+	database "root/internal/database"
+	"root/internal/models"
+	"root/internal/roles"
+	"strconv"
+	"strings"
+)
+
+var (
+	// categorySlugPattern matches slugs such as "board-games"; slugs become URLs and page anchors
+	categorySlugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+	// categoryIconPattern matches boxicons classes such as "bx-joystick" or "bxs-flask"
+	categoryIconPattern = regexp.MustCompile(`^bx[sl]?-[a-z0-9-]+$`)
+	// categoryColorPattern matches hex colors such as "#8a2be2"
+	categoryColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+)
+
+// AdminCategories lists the categories with forms to edit them
+func AdminCategories(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	if _, ok := requirePermission(w, r, roles.ManageCategories); !ok {
+		return
+	}
+
+	renderCategoriesPage(w, r, "")
+}
+
+// CreateCategory adds a category
+func CreateCategory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	if _, ok := requirePermission(w, r, roles.ManageCategories); !ok {
+		return
+	}
+
+	category, errorMessage := categoryFromForm(r)
+	if errorMessage == "" {
+		var err error
+		errorMessage, err = categoryConflict(category)
+		if err != nil {
+			http.Redirect(w, r, "/500", http.StatusSeeOther)
+			return
+		}
+	}
+	if errorMessage != "" {
+		renderCategoriesPage(w, r, errorMessage)
+		return
+	}
+
+	if _, err := database.CreateCategory(category); err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+}
+
+// UpdateCategory saves the settings of a category
+func UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	if _, ok := requirePermission(w, r, roles.ManageCategories); !ok {
+		return
+	}
+
+	existing, found := lookupCategory(w, r)
+	if !found {
+		return
+	}
+	category, errorMessage := categoryFromForm(r)
+	category.ID = existing.ID
+	if errorMessage == "" && existing.Slug == database.GeneralCategorySlug {
+		if category.Slug != existing.Slug {
+			errorMessage = "The slug of the general category cannot change."
+		} else if category.Archived {
+			errorMessage = "The general category cannot be archived."
+		}
+	}
+	if errorMessage == "" {
+		var err error
+		errorMessage, err = categoryConflict(category)
+		if err != nil {
+			http.Redirect(w, r, "/500", http.StatusSeeOther)
+			return
+		}
+	}
+	if errorMessage != "" {
+		renderCategoriesPage(w, r, errorMessage)
+		return
+	}
+
+	if err := database.UpdateCategory(category); err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+}
+
+// DeleteCategory removes a category; its posts are kept
+func DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	if _, ok := requirePermission(w, r, roles.ManageCategories); !ok {
+		return
+	}
+
+	category, found := lookupCategory(w, r)
+	if !found {
+		return
+	}
+	if category.Slug == database.GeneralCategorySlug {
+		renderCategoriesPage(w, r, "The general category cannot be deleted.")
+		return
+	}
+
+	if err := database.DeleteCategory(category.ID); err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+}
+
+// categoryFromForm reads and checks the category fields of a form, returning an error message when one is wrong
+func categoryFromForm(r *http.Request) (models.Category, string) {
+	category := models.Category{
+		Name:        strings.TrimSpace(r.FormValue("name")),
+		Slug:        strings.ToLower(strings.TrimSpace(r.FormValue("slug"))),
+		Description: strings.TrimSpace(r.FormValue("description")),
+		Icon:        strings.TrimSpace(r.FormValue("icon")),
+		Color:       strings.TrimSpace(r.FormValue("color")),
+		Archived:    r.FormValue("archived") == "on",
+	}
+
+	if category.Name == "" || len(category.Name) > 30 {
+		return category, "The name must be between 1 and 30 characters."
+	}
+	if len(category.Slug) > 30 || !categorySlugPattern.MatchString(category.Slug) {
+		return category, "The slug must be up to 30 lowercase letters, digits and dashes, like board-games."
+	}
+	if len(category.Description) > 200 {
+		return category, "The description can be at most 200 characters."
+	}
+	if category.Icon == "" {
+		category.Icon = "bx-category"
+	}
+	if len(category.Icon) > 50 || !categoryIconPattern.MatchString(category.Icon) {
+		return category, "The icon must be a boxicons class, like bx-joystick."
+	}
+	if category.Color != "" && !categoryColorPattern.MatchString(category.Color) {
+		return category, "The color must be a hex color like #8a2be2, or empty."
+	}
+
+	if value := r.FormValue("parent_id"); value != "" {
+		parentID, err := strconv.Atoi(value)
+		if err != nil || parentID < 0 {
+			return category, "Pick a parent category from the list."
+		}
+		category.ParentID = parentID
+	}
+
+	sortOrder, err := strconv.Atoi(strings.TrimSpace(r.FormValue("sort_order")))
+	if err != nil || sortOrder < -1000 || sortOrder > 1000 {
+		return category, "The sort order must be a number between -1000 and 1000."
+	}
+	category.SortOrder = sortOrder
+	return category, ""
+}
+
+// categoryConflict returns an error message when another category already uses the name or slug,
+// or when the parent is missing, is the category itself or is nested under it
+func categoryConflict(category models.Category) (string, error) {
+	categories, err := database.FetchCategories()
+	if err != nil {
+		return "", err
+	}
+	parentFound := category.ParentID == 0
+	for _, other := range categories {
+		if other.ID == category.ParentID {
+			parentFound = true
+			if other.Slug == database.GeneralCategorySlug {
+				return "Categories cannot be nested under the general category.", nil
+			}
+		}
+		if other.ID == category.ID {
+			continue
+		}
+		if other.Slug == category.Slug {
+			return "Another category already uses the slug " + category.Slug + ".", nil
+		}
+		if strings.EqualFold(other.Name, category.Name) {
+			return "Another category is already called " + other.Name + ".", nil
+		}
+	}
+	if !parentFound {
+		return "The parent category does not exist.", nil
+	}
+	if category.ParentID == 0 {
+		return "", nil
+	}
+	if category.Slug == database.GeneralCategorySlug {
+		return "The general category cannot be nested.", nil
+	}
+	if category.ID != 0 {
+		if category.ParentID == category.ID {
+			return "A category cannot be its own parent.", nil
+		}
+		for _, ancestor := range categoryAncestors(categories, models.Category{ParentID: category.ParentID}) {
+			if ancestor.ID == category.ID {
+				return "A category cannot be nested under one of its own subcategories.", nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// lookupCategory finds the category named in the category_id field, answering 400 or 404 when there is none
+func lookupCategory(w http.ResponseWriter, r *http.Request) (models.Category, bool) {
+	categoryID, err := strconv.Atoi(r.FormValue("category_id"))
+	if err != nil {
+		http.Redirect(w, r, "/400", http.StatusSeeOther)
+		return models.Category{}, false
+	}
+	category, err := database.FetchCategory(categoryID)
+	if err == sql.ErrNoRows {
+		http.Redirect(w, r, "/404", http.StatusSeeOther)
+		return models.Category{}, false
+	}
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return models.Category{}, false
+	}
+	return category, true
+}
+
+// renderCategoriesPage renders the category management page with an optional error message
+func renderCategoriesPage(w http.ResponseWriter, r *http.Request, errorMessage string) {
+	categories, err := database.FetchCategories()
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	postCounts, err := database.CountCategoryPosts()
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	categoryNames := map[int]string{}
+	for _, category := range categories {
+		categoryNames[category.ID] = category.Name
+	}
+
+	data := struct {
+		CSRFToken     string
+		Categories    []models.Category
+		PostCounts    map[int]int
+		CategoryNames map[int]string
+		GeneralSlug   string
+		ErrorMessage  string
+	}{
+		CSRFToken:     csrfToken(r),
+		Categories:    categories,
+		PostCounts:    postCounts,
+		CategoryNames: categoryNames,
+		GeneralSlug:   database.GeneralCategorySlug,
+		ErrorMessage:  errorMessage,
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	err = templates.ExecuteTemplate(w, "categories.html", data)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,170 @@
+package root
+
+import (
+	"database/sql"
+	"net/http"
+	database "root/internal/database"
+	"root/internal/models"
+	"root/internal/roles"
+	"strconv"
+	"strings"
+)
+
+// AdminRoles lists the moderators and admins
+func AdminRoles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	if _, ok := requirePermission(w, r, roles.ManageRoles); !ok {
+		return
+	}
+
+	renderRolesPage(w, r, "")
+}
+
+// SetRole changes the site-wide role of a user
+func SetRole(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	adminID, ok := requirePermission(w, r, roles.ManageRoles)
+	if !ok {
+		return
+	}
+
+	role := roles.Role(r.FormValue("role"))
+	if !roles.Valid(role) {
+		http.Redirect(w, r, "/400", http.StatusSeeOther)
+		return
+	}
+	userID, found := lookupRoleTarget(w, r)
+	if !found {
+		return
+	}
+	// Keep admins from locking themselves out; another admin has to demote them
+	if userID == adminID {
+		renderRolesPage(w, r, "You cannot change your own role.")
+		return
+	}
+
+	if err := database.SetUserRole(userID, role); err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/admin/roles", http.StatusSeeOther)
+}
+
+// AddCategoryModerator lets a user moderate one category
+func AddCategoryModerator(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	if _, ok := requirePermission(w, r, roles.ManageRoles); !ok {
+		return
+	}
+
+	categoryID, err := strconv.Atoi(r.FormValue("category_id"))
+	if err != nil {
+		http.Redirect(w, r, "/400", http.StatusSeeOther)
+		return
+	}
+	userID, found := lookupRoleTarget(w, r)
+	if !found {
+		return
+	}
+
+	if err := database.AddCategoryModerator(userID, categoryID); err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/admin/roles", http.StatusSeeOther)
+}
+
+// RemoveCategoryModerator stops a user from moderating a category
+func RemoveCategoryModerator(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	if _, ok := requirePermission(w, r, roles.ManageRoles); !ok {
+		return
+	}
+
+	userID, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		http.Redirect(w, r, "/400", http.StatusSeeOther)
+		return
+	}
+	categoryID, err := strconv.Atoi(r.FormValue("category_id"))
+	if err != nil {
+		http.Redirect(w, r, "/400", http.StatusSeeOther)
+		return
+	}
+
+	if err := database.RemoveCategoryModerator(userID, categoryID); err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/admin/roles", http.StatusSeeOther)
+}
+
+// lookupRoleTarget finds the user named in the username field, showing an error on the roles page when there is none
+func lookupRoleTarget(w http.ResponseWriter, r *http.Request) (int, bool) {
+	username := strings.TrimPrefix(strings.TrimSpace(r.FormValue("username")), "@")
+	if username == "" {
+		renderRolesPage(w, r, "Enter a username.")
+		return 0, false
+	}
+
+	userID, _, err := database.FetchUserByUsername(username)
+	if err == sql.ErrNoRows {
+		renderRolesPage(w, r, "There is no user called @"+username+".")
+		return 0, false
+	}
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return 0, false
+	}
+	return userID, true
+}
+
+// renderRolesPage renders the role management page with an optional error message
+func renderRolesPage(w http.ResponseWriter, r *http.Request, errorMessage string) {
+	staff, err := database.FetchStaff()
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	categories, err := database.FetchCategories()
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	data := struct {
+		CSRFToken    string
+		Staff        []models.StaffMember
+		Roles        []roles.Role
+		Categories   []models.Category
+		ErrorMessage string
+	}{
+		CSRFToken:    csrfToken(r),
+		Staff:        staff,
+		Roles:        roles.All,
+		Categories:   categories,
+		ErrorMessage: errorMessage,
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	err = templates.ExecuteTemplate(w, "roles.html", data)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,424 @@
+package root
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	database "root/internal/database"
+	"root/internal/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxAPIBody bounds the JSON body of an API request
+const maxAPIBody = 64 << 10
+
+// apiHandler is an API handler that already knows who is calling
+type apiHandler func(w http.ResponseWriter, r *http.Request, userID int)
+
+// withAPIToken authenticates an API request by the personal access token in its
+// "Authorization: Bearer" header and checks that the token carries scope.
+// The API ignores session cookies, so it needs no CSRF protection.
+func withAPIToken(scope string, next apiHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			writeAPIError(w, http.StatusUnauthorized, "missing bearer token")
+			return
+		}
+
+		userID, scopes, err := database.FetchUserIDByAPIToken(token)
+		if err == sql.ErrNoRows {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api", error="invalid_token"`)
+			writeAPIError(w, http.StatusUnauthorized, "invalid or expired token")
+			return
+		}
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+
+		if scope != "" && !hasScope(scopes, scope) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api", error="insufficient_scope", scope="`+scope+`"`)
+			writeAPIError(w, http.StatusForbidden, "token lacks the "+scope+" scope")
+			return
+		}
+
+		// Tokens act for their owner, so the email verification rules apply to them too
+		blocked, err := blockedByEmailVerification(userID, scope)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		if blocked {
+			writeAPIError(w, http.StatusForbidden, "confirm your email address before you "+restrictedActionName(scope))
+			return
+		}
+
+		next(w, r, userID)
+	}
+}
+
+// bearerToken extracts the token of an "Authorization: Bearer" header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// hasScope reports whether scopes contains scope
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// apiUser is the JSON form of the calling user
+type apiUser struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+}
+
+// apiPost is the JSON form of a post
+type apiPost struct {
+	ID           int          `json:"id"`
+	Author       string       `json:"author"`
+	Content      string       `json:"content"`
+	CreatedAt    time.Time    `json:"created_at"`
+	Likes        int          `json:"likes"`
+	Dislikes     int          `json:"dislikes"`
+	CommentCount int          `json:"comment_count"`
+	Media        []apiMedia   `json:"media"`
+	Comments     []apiComment `json:"comments"`
+}
+
+// apiMedia is the JSON form of a post attachment
+type apiMedia struct {
+	URL  string `json:"url"`
+	Type string `json:"type"`
+}
+
+// apiComment is the JSON form of a comment
+type apiComment struct {
+	ID        int       `json:"id"`
+	Author    string    `json:"author"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+	Likes     int       `json:"likes"`
+	Dislikes  int       `json:"dislikes"`
+}
+
+// apiSearchResult is the JSON form of a search result. Its snippet is HTML, with the
+// matched words in <mark> elements.
+type apiSearchResult struct {
+	PostID    int       `json:"post_id"`
+	CommentID int       `json:"comment_id,omitempty"`
+	Author    string    `json:"author"`
+	Snippet   string    `json:"snippet"`
+	CreatedAt time.Time `json:"created_at"`
+	Likes     int       `json:"likes"`
+	Dislikes  int       `json:"dislikes"`
+	URL       string    `json:"url"`
+}
+
+// APIMe returns the owner of the token
+func APIMe(w http.ResponseWriter, r *http.Request, userID int) {
+	username, err := database.FetchUsernameByUserID(userID)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, apiUser{ID: userID, Username: username})
+}
+
+// APIListPosts returns a page of posts with their comments, newest first unless sort and t
+// pick another order like the feed's tabs
+func APIListPosts(w http.ResponseWriter, r *http.Request, userID int) {
+	sort, err := sortRequest(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, err := database.FetchFeedPage(userID, sort, pageRequest(r))
+	if err == database.ErrBadCursor {
+		writeAPIError(w, http.StatusBadRequest, "malformed page cursor")
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	out := struct {
+		Posts []apiPost `json:"posts"`
+		Next  string    `json:"next,omitempty"`
+		Prev  string    `json:"prev,omitempty"`
+	}{Posts: make([]apiPost, 0, len(page.Posts)), Next: page.Next, Prev: page.Prev}
+	for _, post := range page.Posts {
+		out.Posts = append(out.Posts, toAPIPost(post))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// APIGetPost returns one post with its comments
+func APIGetPost(w http.ResponseWriter, r *http.Request, userID int) {
+	post, ok := findAPIPost(w, r, userID)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, toAPIPost(post))
+}
+
+// APICreatePost creates a post from {"content": "...", "categories": ["gaming"]}
+func APICreatePost(w http.ResponseWriter, r *http.Request, userID int) {
+	var body struct {
+		Content    string   `json:"content"`
+		Categories []string `json:"categories"`
+	}
+	if !readAPIBody(w, r, &body) {
+		return
+	}
+
+	content := strings.TrimSpace(body.Content)
+	if content == "" || len(content) > 366 {
+		writeAPIError(w, http.StatusBadRequest, "content must be between 1 and 366 characters")
+		return
+	}
+	categoryIDs, unknown, err := postCategoryIDs(body.Categories)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if unknown != "" {
+		slugs, err := postableCategorySlugs()
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		writeAPIError(w, http.StatusBadRequest, "unknown or archived category "+strconv.Quote(unknown)+", expected one of "+strings.Join(slugs, ", "))
+		return
+	}
+
+	postID, err := database.InsertPost(userID, content)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	for _, categoryID := range categoryIDs {
+		if err := database.AssociatePostWithCategory(postID, categoryID); err != nil {
+			writeAPIError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+	}
+
+	r.SetPathValue("id", strconv.FormatInt(postID, 10))
+	post, ok := findAPIPost(w, r, userID)
+	if !ok {
+		return
+	}
+	w.Header().Set("Location", "/api/posts/"+strconv.Itoa(post.ID))
+	writeJSON(w, http.StatusCreated, toAPIPost(post))
+}
+
+// APICreateComment comments on a post from {"content": "..."}
+func APICreateComment(w http.ResponseWriter, r *http.Request, userID int) {
+	post, ok := findAPIPost(w, r, userID)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Content string `json:"content"`
+	}
+	if !readAPIBody(w, r, &body) {
+		return
+	}
+	content := strings.TrimSpace(body.Content)
+	if content == "" || len(content) > 366 {
+		writeAPIError(w, http.StatusBadRequest, "content must be between 1 and 366 characters")
+		return
+	}
+
+	commentID, err := database.InsertComment(userID, post.ID, content)
+	if err == database.ErrPostArchived {
+		writeAPIError(w, http.StatusForbidden, "post is archived")
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	username, err := database.FetchUsernameByUserID(userID)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	writeJSON(w, http.StatusCreated, apiComment{
+		ID:        int(commentID),
+		Author:    username,
+		Content:   content,
+		CreatedAt: time.Now().UTC(),
+	})
+}
+
+// APILikePost toggles a like on a post and returns the new counts
+func APILikePost(w http.ResponseWriter, r *http.Request, userID int) {
+	reactToAPIPost(w, r, userID, database.LikePost)
+}
+
+// APIDislikePost toggles a dislike on a post and returns the new counts
+func APIDislikePost(w http.ResponseWriter, r *http.Request, userID int) {
+	reactToAPIPost(w, r, userID, database.DislikePost)
+}
+
+// reactToAPIPost applies a like or dislike toggle and answers with the post's counts
+func reactToAPIPost(w http.ResponseWriter, r *http.Request, userID int, react func(int, string) error) {
+	post, ok := findAPIPost(w, r, userID)
+	if !ok {
+		return
+	}
+	err := react(userID, strconv.Itoa(post.ID))
+	if err == database.ErrPostArchived {
+		writeAPIError(w, http.StatusForbidden, "post is archived")
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	likes, dislikes, err := database.CountLikes(post.ID, nil)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"likes": likes, "dislikes": dislikes})
+}
+
+// APISearch searches posts or comments like the search page and returns a page of the best
+// matches, with the cursor of the next page when there is one
+func APISearch(w http.ResponseWriter, r *http.Request, userID int) {
+	query, err := searchRequest(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if strings.TrimSpace(query.Text) == "" {
+		writeAPIError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+	results, err := database.Search(query, pageRequest(r))
+	if err == database.ErrBadCursor {
+		writeAPIError(w, http.StatusBadRequest, "malformed page cursor")
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	out := struct {
+		Results []apiSearchResult `json:"results"`
+		Next    string            `json:"next,omitempty"`
+		Prev    string            `json:"prev,omitempty"`
+	}{Results: []apiSearchResult{}, Next: results.Next, Prev: results.Prev}
+	for _, result := range results.Results {
+		out.Results = append(out.Results, apiSearchResult{
+			PostID:    result.PostID,
+			CommentID: result.CommentID,
+			Author:    result.Username,
+			Snippet:   string(highlight(result.Snippet)),
+			CreatedAt: result.CreatedAt,
+			Likes:     result.Likes,
+			Dislikes:  result.Dislikes,
+			URL:       absoluteURL(searchResultURL(result)),
+		})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// findAPIPost looks up the post named by the {id} path segment, answering 404 when there is none
+func findAPIPost(w http.ResponseWriter, r *http.Request, userID int) (models.Post, bool) {
+	postID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "post not found")
+		return models.Post{}, false
+	}
+
+	post, err := database.FetchPost(postID, userID)
+	if err == sql.ErrNoRows {
+		writeAPIError(w, http.StatusNotFound, "post not found")
+		return models.Post{}, false
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "internal error")
+		return models.Post{}, false
+	}
+	return post, true
+}
+
+// toAPIPost converts a post and its comments to their JSON form
+func toAPIPost(post models.Post) apiPost {
+	out := apiPost{
+		ID:           post.ID,
+		Author:       post.Username,
+		Content:      post.Content,
+		CreatedAt:    post.CreatedAt,
+		Likes:        post.Likes,
+		Dislikes:     post.Dislikes,
+		CommentCount: post.ComCount,
+		Media:        []apiMedia{},
+		Comments:     []apiComment{},
+	}
+	for _, media := range post.Media {
+		out.Media = append(out.Media, apiMedia{URL: absoluteURL("/" + strings.TrimPrefix(media.FilePath, "./")), Type: media.FileType})
+	}
+	for _, comment := range post.Comment {
+		out.Comments = append(out.Comments, apiComment{
+			ID:        comment.ComID,
+			Author:    comment.ComUsername,
+			Content:   comment.ComContent,
+			CreatedAt: comment.ComCreatedAt,
+			Likes:     comment.ComLikes,
+			Dislikes:  comment.ComDislikes,
+		})
+	}
+	return out
+}
+
+// readAPIBody decodes a JSON request body, answering 400 when it is malformed
+func readAPIBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBody))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// writeJSON sends v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Writing API response failed: %v", err)
+	}
+}
+
+// writeAPIError sends an {"error": "..."} response
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,191 @@
+package root
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"net/http"
+	database "root/internal/database"
+	"root/internal/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// apiTokenPrefix marks personal access tokens so they are easy to spot in logs and secret scanners
+	apiTokenPrefix = "sfp_"
+	// maxAPITokens caps how many tokens one user may hold
+	maxAPITokens = 20
+	// maxAPITokenDays caps how long a token may stay valid
+	maxAPITokenDays = 365
+)
+
+// apiScope is a permission that can be granted to a personal access token
+type apiScope struct {
+	Name        string
+	Description string
+}
+
+// apiScopes lists every scope a token can carry
+var apiScopes = []apiScope{
+	{"read", "Read posts and comments"},
+	{"post", "Create posts"},
+	{"comment", "Write comments"},
+	{"react", "Like and dislike posts"},
+}
+
+// validAPIScope reports whether name is a known scope
+func validAPIScope(name string) bool {
+	for _, scope := range apiScopes {
+		if scope.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// APITokens lists the personal access tokens of the signed-in user
+func APITokens(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	userID, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	renderAPITokensPage(w, r, userID, "", "")
+}
+
+// CreateAPIToken mints a personal access token and shows it once
+func CreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	userID, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Redirect(w, r, "/400", http.StatusSeeOther)
+		return
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" || len(name) > 50 {
+		renderAPITokensPage(w, r, userID, "", "Give the token a name of up to 50 characters.")
+		return
+	}
+	scopes := r.Form["scopes"]
+	if len(scopes) == 0 {
+		renderAPITokensPage(w, r, userID, "", "Pick at least one scope.")
+		return
+	}
+	for _, scope := range scopes {
+		if !validAPIScope(scope) {
+			http.Redirect(w, r, "/400", http.StatusSeeOther)
+			return
+		}
+	}
+	days, err := strconv.Atoi(r.FormValue("expires_in_days"))
+	if err != nil || days < 0 || days > maxAPITokenDays {
+		renderAPITokensPage(w, r, userID, "", "Expiry must be between 0 (never) and "+strconv.Itoa(maxAPITokenDays)+" days.")
+		return
+	}
+
+	tokens, err := database.FetchUserAPITokens(userID)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	if len(tokens) >= maxAPITokens {
+		renderAPITokensPage(w, r, userID, "", "You already have "+strconv.Itoa(maxAPITokens)+" tokens. Revoke one first.")
+		return
+	}
+
+	var expiresAt time.Time
+	if days > 0 {
+		expiresAt = time.Now().UTC().AddDate(0, 0, days)
+	}
+	token, err := generateAPIToken()
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	if err := database.CreateAPIToken(userID, name, token, scopes, expiresAt); err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	// The token is stored hashed, so this response is the only place it appears
+	renderAPITokensPage(w, r, userID, token, "")
+}
+
+// RevokeAPIToken deletes one of the signed-in user's tokens
+func RevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	userID, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	tokenID, err := strconv.Atoi(r.FormValue("token_id"))
+	if err != nil {
+		http.Redirect(w, r, "/400", http.StatusSeeOther)
+		return
+	}
+	if err := database.DeleteUserAPIToken(userID, tokenID); err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, "/account/tokens", http.StatusSeeOther)
+}
+
+// renderAPITokensPage renders the personal access token page; newToken is only passed right after creation
+func renderAPITokensPage(w http.ResponseWriter, r *http.Request, userID int, newToken, errorMessage string) {
+	tokens, err := database.FetchUserAPITokens(userID)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	data := struct {
+		CSRFToken    string
+		Tokens       []models.APIToken
+		Scopes       []apiScope
+		NewToken     string
+		APIBase      string
+		ErrorMessage string
+	}{
+		CSRFToken:    csrfToken(r),
+		Tokens:       tokens,
+		Scopes:       apiScopes,
+		NewToken:     newToken,
+		APIBase:      absoluteURL("/api"),
+		ErrorMessage: errorMessage,
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	err = templates.ExecuteTemplate(w, "tokens.html", data)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+	}
+}
+
+// generateAPIToken returns a new random personal access token
+func generateAPIToken() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return apiTokenPrefix + strings.ToLower(base32.StdEncoding.EncodeToString(buf)), nil
+}
@@ -0,0 +1,183 @@
+package root
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	database "root/internal/database"
+	"root/internal/models"
+)
+
+// errNoGeneralCategory means the category that uncategorized posts go to is missing
+var errNoGeneralCategory = errors.New("the " + database.GeneralCategorySlug + " category does not exist")
+
+// postCategoryIDs resolves the categories picked for a new post, given by slug or by name.
+// No categories files the post under the general category. The second result is the first
+// value that is not an open category, or empty when every value is fine.
+func postCategoryIDs(values []string) ([]int, string, error) {
+	categories, err := database.FetchCategories()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var ids []int
+	seen := map[int]bool{}
+	for _, value := range values {
+		category, ok := findCategory(categories, value)
+		if !ok || category.Archived {
+			return nil, value, nil
+		}
+		if !seen[category.ID] {
+			seen[category.ID] = true
+			ids = append(ids, category.ID)
+		}
+	}
+	if len(ids) > 0 {
+		return ids, "", nil
+	}
+
+	general, ok := findCategory(categories, database.GeneralCategorySlug)
+	if !ok {
+		return nil, "", errNoGeneralCategory
+	}
+	return []int{general.ID}, "", nil
+}
+
+// postableCategorySlugs lists the slugs a new post can be filed under
+func postableCategorySlugs() ([]string, error) {
+	categories, err := database.FetchCategories()
+	if err != nil {
+		return nil, err
+	}
+	var slugs []string
+	for _, category := range categories {
+		if !category.Archived {
+			slugs = append(slugs, category.Slug)
+		}
+	}
+	return slugs, nil
+}
+
+// findCategory looks a category up by slug or by name
+func findCategory(categories []models.Category, value string) (models.Category, bool) {
+	for _, category := range categories {
+		if category.Slug == value || category.Name == value {
+			return category, true
+		}
+	}
+	return models.Category{}, false
+}
+
+// CategoryPage is the landing page of a category at /c/{slug}: its subcategories and a page of
+// the posts filed under it or under any of them
+func CategoryPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	category, err := database.FetchCategoryBySlug(r.PathValue("slug"))
+	if err == sql.ErrNoRows {
+		http.Redirect(w, r, "/404", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	categories, err := database.FetchCategories()
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	if err := fillCategoryActivity(&category); err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	var subcategories []models.Category
+	for _, child := range categories {
+		if child.ParentID != category.ID {
+			continue
+		}
+		if err := fillCategoryActivity(&child); err != nil {
+			http.Redirect(w, r, "/500", http.StatusSeeOther)
+			return
+		}
+		subcategories = append(subcategories, child)
+	}
+
+	sort, err := sortRequest(r)
+	if err != nil {
+		http.Redirect(w, r, "/400", http.StatusSeeOther)
+		return
+	}
+	userID := sessionUserID(r)
+	posts, err := database.FetchCategoryPage(category.ID, userID, sort, pageRequest(r))
+	if err == database.ErrBadCursor {
+		http.Redirect(w, r, "/400", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	data := struct {
+		CSRFToken     string
+		SignedIn      bool
+		Category      models.Category
+		Breadcrumbs   []models.Category
+		Subcategories []models.Category
+		Posts         []models.Post
+		Nav           models.ListNav
+	}{
+		CSRFToken:     csrfToken(r),
+		SignedIn:      userID != 0,
+		Category:      category,
+		Breadcrumbs:   categoryAncestors(categories, category),
+		Subcategories: subcategories,
+		Posts:         posts.Posts,
+		Nav:           listNav("/c/"+category.Slug, "", sort, posts),
+	}
+
+	err = templates.ExecuteTemplate(w, "category.html", data)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+	}
+}
+
+// fillCategoryActivity sets the post count and last activity of a category
+func fillCategoryActivity(category *models.Category) error {
+	count, last, err := database.FetchCategoryActivity(category.ID)
+	if err != nil {
+		return err
+	}
+	category.PostCount = count
+	category.LastActivity = last
+	if !last.IsZero() {
+		category.FormatLastActivity = database.FormatDate(last)
+	}
+	return nil
+}
+
+// categoryAncestors returns the categories above category, outermost first
+func categoryAncestors(categories []models.Category, category models.Category) []models.Category {
+	byID := map[int]models.Category{}
+	for _, c := range categories {
+		byID[c.ID] = c
+	}
+
+	var ancestors []models.Category
+	seen := map[int]bool{category.ID: true}
+	for parentID := category.ParentID; parentID != 0 && !seen[parentID]; {
+		parent, ok := byID[parentID]
+		if !ok {
+			break
+		}
+		seen[parentID] = true
+		ancestors = append([]models.Category{parent}, ancestors...)
+		parentID = parent.ParentID
+	}
+	return ancestors
+}
@@ -0,0 +1,336 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Config holds the settings the forum reads at startup
+type Config struct {
+	// BaseURL is the public address of the forum, used to build absolute links
+	BaseURL string `json:"base_url"`
+	// OAuth lists the enabled OAuth2 login providers keyed by their short name (e.g. "google")
+	OAuth map[string]OAuthProvider `json:"oauth"`
+	// Mail configures how the forum sends email
+	Mail Mail `json:"mail"`
+	// EmailVerification decides what accounts with an unverified email may do
+	EmailVerification EmailVerification `json:"email_verification"`
+	// Password is the policy new passwords must satisfy
+	Password Password `json:"password"`
+	// Registration decides who may create an account
+	Registration Registration `json:"registration"`
+	// Database configures the schema migrations run at startup
+	Database Database `json:"database"`
+}
+
+// Database sets what happens to pending schema migrations at startup. Migrations is
+// "apply" (the default) to run them, or "dry-run" to list them and refuse to start
+// until they are applied with the migrate command.
+type Database struct {
+	Migrations string `json:"migrations"`
+}
+
+// Registration sets who may create an account, both with a password and through an
+// OAuth provider. Mode is "open", "invite" (an invite code is required) or "closed".
+// When AllowDomains is not empty only those email domains (and their subdomains) may
+// register; DenyDomains and the domains in DisposableList are always refused.
+// DisposableList can be set to "" to accept disposable addresses.
+type Registration struct {
+	Mode           string   `json:"mode"`
+	AllowDomains   []string `json:"allow_domains"`
+	DenyDomains    []string `json:"deny_domains"`
+	DisposableList *string  `json:"disposable_list"`
+	// InviteCodes are accepted in invite mode besides the invites created by admins.
+	// They record no inviter and never run out, which makes them handy to bootstrap a forum.
+	InviteCodes []string `json:"invite_codes,omitempty"`
+}
+
+// Password sets the password policy. Lengths count characters, not bytes; whatever
+// they are set to, bcrypt never accepts more than 72 bytes. BreachedList points to a
+// sorted file of SHA-1 hashes (the Pwned Passwords "ordered by hash" format) and can be
+// set to "" to skip the breached password check.
+type Password struct {
+	MinLength int `json:"min_length"`
+	MaxLength int `json:"max_length"`
+	// MinClasses is how many of lowercase, uppercase, digits and symbols a password must mix (0-4)
+	MinClasses   int     `json:"min_classes"`
+	BreachedList *string `json:"breached_list"`
+}
+
+// EmailVerification lists the actions an account may not take until its email is verified.
+// Known actions are "post", "comment" and "react".
+type EmailVerification struct {
+	Restrict []string `json:"restrict"`
+}
+
+// Mail selects the mail transport. The "outbox" transport writes every message to
+// OutboxDir instead of sending it, which is handy in development.
+type Mail struct {
+	Transport    string `json:"transport"`
+	From         string `json:"from"`
+	OutboxDir    string `json:"outbox_dir,omitempty"`
+	SMTPHost     string `json:"smtp_host,omitempty"`
+	SMTPPort     string `json:"smtp_port,omitempty"`
+	SMTPUsername string `json:"smtp_username,omitempty"`
+	SMTPPassword string `json:"smtp_password,omitempty"`
+}
+
+// OAuthProvider describes the endpoints and credentials of one OAuth2 login provider.
+// Setting Issuer turns it into an OpenID Connect provider whose endpoints are discovered.
+type OAuthProvider struct {
+	DisplayName string `json:"display_name"`
+	// Icon is the boxicons class shown on the login button (e.g. "bxl-google")
+	Icon         string   `json:"icon,omitempty"`
+	Issuer       string   `json:"issuer,omitempty"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	AuthURL      string   `json:"auth_url"`
+	TokenURL     string   `json:"token_url"`
+	UserInfoURL  string   `json:"userinfo_url"`
+	RedirectURL  string   `json:"redirect_url"`
+	Scopes       []string `json:"scopes"`
+	// EmailsURL is queried when the user info response has no email (GitHub private emails)
+	EmailsURL string `json:"emails_url,omitempty"`
+	// Field names used to read the user info response
+	SubjectField  string `json:"subject_field,omitempty"`
+	EmailField    string `json:"email_field,omitempty"`
+	UsernameField string `json:"username_field,omitempty"`
+}
+
+// Default returns the configuration used when no file is present
+func Default() *Config {
+	return &Config{
+		BaseURL: "https://localhost:8080",
+		OAuth: map[string]OAuthProvider{
+			"google": {
+				DisplayName:   "Google",
+				Icon:          "bxl-google",
+				AuthURL:       "https://accounts.google.com/o/oauth2/v2/auth",
+				TokenURL:      "https://oauth2.googleapis.com/token",
+				UserInfoURL:   "https://openidconnect.googleapis.com/v1/userinfo",
+				RedirectURL:   "https://localhost:8080/auth/callback",
+				Scopes:        []string{"openid", "email", "profile"},
+				SubjectField:  "sub",
+				EmailField:    "email",
+				UsernameField: "name",
+			},
+			"github": {
+				DisplayName:   "GitHub",
+				Icon:          "bxl-github",
+				AuthURL:       "https://github.com/login/oauth/authorize",
+				TokenURL:      "https://github.com/login/oauth/access_token",
+				UserInfoURL:   "https://api.github.com/user",
+				EmailsURL:     "https://api.github.com/user/emails",
+				RedirectURL:   "https://localhost:8080/auth/github/callback",
+				Scopes:        []string{"user:email"},
+				SubjectField:  "id",
+				EmailField:    "email",
+				UsernameField: "login",
+			},
+		},
+		Mail: Mail{
+			Transport: "outbox",
+			From:      "Stellar Forum <no-reply@localhost>",
+			OutboxDir: "./outbox",
+			SMTPPort:  "587",
+		},
+		EmailVerification: EmailVerification{
+			Restrict: []string{"post", "comment"},
+		},
+		Password: Password{
+			MinLength:    8,
+			MaxLength:    64,
+			BreachedList: &defaultBreachedList,
+		},
+		Registration: Registration{
+			Mode:           "open",
+			DisposableList: &defaultDisposableList,
+		},
+		Database: Database{
+			Migrations: "apply",
+		},
+	}
+}
+
+// defaultDisposableList is the list of throwaway mail domains shipped with the forum
+var defaultDisposableList = "./assets/registration/disposable_domains.txt"
+
+// defaultBreachedList is the small list of common passwords shipped with the forum
+var defaultBreachedList = "./assets/breached/passwords.txt"
+
+// Load reads the JSON configuration file at path on top of the defaults.
+// A missing file is not an error. Provider credentials can also be supplied through
+// OAUTH_<NAME>_CLIENT_ID and OAUTH_<NAME>_CLIENT_SECRET environment variables, and the
+// SMTP password through SMTP_PASSWORD.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	raw, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		var fileCfg Config
+		if err := json.Unmarshal(raw, &fileCfg); err != nil {
+			return nil, err
+		}
+		cfg.merge(&fileCfg)
+	}
+
+	for name, provider := range cfg.OAuth {
+		if !validProviderName(name) {
+			return nil, fmt.Errorf("invalid OAuth provider name %q", name)
+		}
+		if provider.RedirectURL == "" {
+			provider.RedirectURL = strings.TrimSuffix(cfg.BaseURL, "/") + "/auth/" + name + "/callback"
+		}
+
+		prefix := "OAUTH_" + strings.ToUpper(name) + "_"
+		if v := os.Getenv(prefix + "CLIENT_ID"); v != "" {
+			provider.ClientID = v
+		}
+		if v := os.Getenv(prefix + "CLIENT_SECRET"); v != "" {
+			provider.ClientSecret = v
+		}
+		cfg.OAuth[name] = provider
+	}
+
+	if v := os.Getenv("SMTP_PASSWORD"); v != "" {
+		cfg.Mail.SMTPPassword = v
+	}
+	if cfg.Mail.Transport != "smtp" && cfg.Mail.Transport != "outbox" {
+		return nil, fmt.Errorf("unknown mail transport %q", cfg.Mail.Transport)
+	}
+	for _, action := range cfg.EmailVerification.Restrict {
+		if action != "post" && action != "comment" && action != "react" {
+			return nil, fmt.Errorf("unknown email verification restriction %q", action)
+		}
+	}
+	if cfg.Password.MinLength < 1 || cfg.Password.MaxLength < cfg.Password.MinLength {
+		return nil, fmt.Errorf("invalid password length range %d-%d", cfg.Password.MinLength, cfg.Password.MaxLength)
+	}
+	if cfg.Password.MinClasses < 0 || cfg.Password.MinClasses > 4 {
+		return nil, fmt.Errorf("password min_classes must be between 0 and 4")
+	}
+	if mode := cfg.Registration.Mode; mode != "open" && mode != "invite" && mode != "closed" {
+		return nil, fmt.Errorf("unknown registration mode %q", mode)
+	}
+	if m := cfg.Database.Migrations; m != "apply" && m != "dry-run" {
+		return nil, fmt.Errorf("database migrations must be \"apply\" or \"dry-run\", not %q", m)
+	}
+
+	return cfg, nil
+}
+
+// validProviderName reports whether name can be used in the /auth/{provider} routes
+func validProviderName(name string) bool {
+	if name == "" || name == "signup" || name == "callback" {
+		return false
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// merge overlays the non-empty settings of other onto cfg
+func (cfg *Config) merge(other *Config) {
+	if other.BaseURL != "" {
+		cfg.BaseURL = other.BaseURL
+	}
+	for name, provider := range other.OAuth {
+		cfg.OAuth[name] = mergeProvider(cfg.OAuth[name], provider)
+	}
+	cfg.Mail = mergeMail(cfg.Mail, other.Mail)
+	// An explicit empty list lifts every restriction
+	if other.EmailVerification.Restrict != nil {
+		cfg.EmailVerification.Restrict = other.EmailVerification.Restrict
+	}
+	if other.Password.MinLength != 0 {
+		cfg.Password.MinLength = other.Password.MinLength
+	}
+	if other.Password.MaxLength != 0 {
+		cfg.Password.MaxLength = other.Password.MaxLength
+	}
+	if other.Password.MinClasses != 0 {
+		cfg.Password.MinClasses = other.Password.MinClasses
+	}
+	// An explicit empty path turns the breached password check off
+	if other.Password.BreachedList != nil {
+		cfg.Password.BreachedList = other.Password.BreachedList
+	}
+	if other.Registration.Mode != "" {
+		cfg.Registration.Mode = other.Registration.Mode
+	}
+	if other.Registration.AllowDomains != nil {
+		cfg.Registration.AllowDomains = other.Registration.AllowDomains
+	}
+	if other.Registration.DenyDomains != nil {
+		cfg.Registration.DenyDomains = other.Registration.DenyDomains
+	}
+	// An explicit empty path accepts disposable addresses
+	if other.Registration.DisposableList != nil {
+		cfg.Registration.DisposableList = other.Registration.DisposableList
+	}
+	if other.Registration.InviteCodes != nil {
+		cfg.Registration.InviteCodes = other.Registration.InviteCodes
+	}
+	if other.Database.Migrations != "" {
+		cfg.Database.Migrations = other.Database.Migrations
+	}
+}
+
+// mergeMail fills the empty fields of override from base
+func mergeMail(base, override Mail) Mail {
+	pick := func(a, b string) string {
+		if b != "" {
+			return b
+		}
+		return a
+	}
+	return Mail{
+		Transport:    pick(base.Transport, override.Transport),
+		From:         pick(base.From, override.From),
+		OutboxDir:    pick(base.OutboxDir, override.OutboxDir),
+		SMTPHost:     pick(base.SMTPHost, override.SMTPHost),
+		SMTPPort:     pick(base.SMTPPort, override.SMTPPort),
+		SMTPUsername: pick(base.SMTPUsername, override.SMTPUsername),
+		SMTPPassword: pick(base.SMTPPassword, override.SMTPPassword),
+	}
+}
+
+// mergeProvider fills the empty fields of override from base, so a config file
+// only has to mention the credentials of a built-in provider
+func mergeProvider(base, override OAuthProvider) OAuthProvider {
+	pick := func(a, b string) string {
+		if b != "" {
+			return b
+		}
+		return a
+	}
+	merged := OAuthProvider{
+		DisplayName:   pick(base.DisplayName, override.DisplayName),
+		Icon:          pick(base.Icon, override.Icon),
+		Issuer:        pick(base.Issuer, override.Issuer),
+		ClientID:      pick(base.ClientID, override.ClientID),
+		ClientSecret:  pick(base.ClientSecret, override.ClientSecret),
+		AuthURL:       pick(base.AuthURL, override.AuthURL),
+		TokenURL:      pick(base.TokenURL, override.TokenURL),
+		UserInfoURL:   pick(base.UserInfoURL, override.UserInfoURL),
+		RedirectURL:   pick(base.RedirectURL, override.RedirectURL),
+		Scopes:        base.Scopes,
+		EmailsURL:     pick(base.EmailsURL, override.EmailsURL),
+		SubjectField:  pick(base.SubjectField, override.SubjectField),
+		EmailField:    pick(base.EmailField, override.EmailField),
+		UsernameField: pick(base.UsernameField, override.UsernameField),
+	}
+	if len(override.Scopes) > 0 {
+		merged.Scopes = override.Scopes
+	}
+	return merged
+}
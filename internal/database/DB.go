@@ -13,63 +13,154 @@ import (
 
 var db *sql.DB
 
-// InitDB initializes the database connection and creates the tables if they don't exist.
-func InitDB() {
+const (
+	// dbPath is the SQLite file holding the forum
+	dbPath = "./internal/database/forum.db"
+	// migrationsDir holds the numbered schema migrations
+	migrationsDir = "./internal/database/migrations"
+)
+
+// InitDB opens the database and applies any pending schema migrations. With dryRun the
+// pending migrations are only listed, and the program stops if there are any.
+func InitDB(dryRun bool) {
+	Open()
+
+	if dryRun {
+		pending, err := MigrateUp(true, os.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if pending > 0 {
+			log.Fatalf("%d pending migration(s); apply them with the migrate command before starting", pending)
+		}
+	} else if _, err := MigrateUp(false, log.Writer()); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println("You are connected to the database correctly")
+}
+
+// Open initializes the global database connection without touching the schema
+func Open() {
+	OpenFile(dbPath)
+}
+
+// OpenFile is Open for a database file other than the forum's, such as a scratch copy
+func OpenFile(path string) {
 	var err error
-	// Initialize the global db connection
-	db, err = sql.Open("sqlite3", "./internal/database/forum.db")
+	db, err = sql.Open(driverName, path)
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	if err2 := RunSQL(db, "./internal/database/tables.sql"); err2 != nil {
-		log.Fatal(err2)
+	if err := checkFullTextSearch(); err != nil {
+		log.Fatal(err)
 	}
+}
 
-	log.Println("You are connected to the database correctly")
+// legacyColumns lists the columns that were added to existing tables before migrations
+// existed. Databases created back then may lack them, so they are added when such a
+// database is first migrated. New columns belong in a migration instead.
+// backfill, when set, fills the new column in for the rows that were already there;
+// its one parameter is the time of the upgrade.
+var legacyColumns = []struct {
+	table, column, definition, backfill string
+}{
+	{"oauth_states", "link_user_id", "INTEGER NOT NULL DEFAULT 0", ""},
+	{"oauth_states", "nonce", "TEXT NOT NULL DEFAULT ''", ""},
+	// Members who joined before verification existed keep posting; only new accounts verify
+	{"users", "email_verified_at", "DATETIME", "UPDATE users SET email_verified_at = ? WHERE email_verified_at IS NULL"},
+	{"users", "invited_by", "INTEGER", ""},
+	{"users", "invite_id", "INTEGER", ""},
+	{"users", "role", "TEXT NOT NULL DEFAULT 'user'", ""},
+}
+
+// upgradeLegacyColumns adds any column from legacyColumns that an existing table is missing.
+// Tables that do not exist yet are skipped; the initial migration creates them complete.
+func upgradeLegacyColumns(db *sql.DB) error {
+	for _, upgrade := range legacyColumns {
+		rows, err := db.Query("SELECT name FROM pragma_table_info(?)", upgrade.table)
+		if err != nil {
+			return err
+		}
+		exists, found := false, false
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				rows.Close()
+				return err
+			}
+			exists = true
+			if name == upgrade.column {
+				found = true
+			}
+		}
+		rows.Close()
+
+		if exists && !found {
+			if err := addLegacyColumn(db, upgrade.table, upgrade.column, upgrade.definition, upgrade.backfill); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
-func RunSQL(db *sql.DB, filepath string) error {
-	sql, err := os.ReadFile(filepath)
+// addLegacyColumn adds a column and runs its backfill in one transaction, so a column
+// is never left behind without the values its existing rows should have
+func addLegacyColumn(db *sql.DB, table, column, definition, backfill string) error {
+	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
-	sqlComms := string(sql)
-	_, err = db.Exec(sqlComms)
-	return err
-}
+	defer tx.Rollback()
 
-// insertUser inserts a new user into the database
-func InsertUser(email, username, passwordHash string) error {
-	fmt.Println("You entered this function")
-	stmt, err := db.Prepare("INSERT INTO users(email, username, password_hash, cookies) VALUES(?, ?, ?, ?)")
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
 	if err != nil {
 		return err
 	}
-	_, err = stmt.Exec(email, username, passwordHash, "")
-	return err
+	if backfill != "" {
+		if _, err := tx.Exec(backfill, time.Now().UTC()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// InsertUser inserts a new user into the database and returns its ID.
+// A non-empty inviteCode is redeemed in the same transaction and records who invited the user.
+func InsertUser(email, username, passwordHash, inviteCode string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	userID, err := insertUser(tx, email, username, passwordHash, inviteCode, sql.NullTime{})
+	if err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit()
 }
 
-// FetchUserByUsername fetches user data based on the username
-func FetchUserByUsername(username string) (string, error) {
+// FetchUserByUsername fetches the user ID and password hash based on the username
+func FetchUserByUsername(username string) (int, string, error) {
 	var userID int
 	var passwordHash string
 	err := db.QueryRow("SELECT id, password_hash FROM users WHERE username = ?", username).Scan(&userID, &passwordHash)
 	if err != nil {
-		return "", err
+		return 0, "", err
 	}
-	return passwordHash, nil
+	return userID, passwordHash, nil
 }
 
-func StoreSessionToken(username string, token string) error {
-	// Prepare the SQL query to update the user's session token in the users table
-	stmt, err := db.Prepare("UPDATE users SET cookies = ? WHERE username = ?")
+// FetchUserIDByEmail retrieves the user ID for a given email
+func FetchUserIDByEmail(email string) (int, error) {
+	var userID int
+	err := db.QueryRow("SELECT id FROM users WHERE email = ?", email).Scan(&userID)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	// Execute the prepared statement with the session token and username
-	_, err = stmt.Exec(token, username)
-	return err
+	return userID, nil
 }
 
 // CheckUsernameExists checks if a user already exists with the given username
@@ -95,237 +186,137 @@ func InsertMedia(postID int64, filePath, fileType string) error {
 	return err
 }
 
-// FetchMediaByPostID retrieves all media files associated with a specific post ID
-func FetchMediaByPostID(postID int) ([]models.Media, error) {
-	rows, err := db.Query("SELECT file_path, file_type FROM media WHERE post_id = ?", postID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var mediaFiles []models.Media
-	for rows.Next() {
-		var media models.Media
-		if err := rows.Scan(&media.FilePath, &media.FileType); err != nil {
-			return nil, err
-		}
-		mediaFiles = append(mediaFiles, media)
-	}
-	return mediaFiles, nil
-}
-
-// DeleteSession removes a session token from the sessions table
-func DeleteSession(sessionToken string) error {
-	// Parameterized query to safely remove the session token
-	query := "UPDATE users SET cookies = NULL WHERE cookies = ?"
-
-	// Execute the query with the provided session token
-	_, err := db.Exec(query, sessionToken)
-
-	// Return any error encountered
-	return err
-}
-
 // CountLikes fetches the total likes and dislikes for a specific post or comment.
 func CountLikes(postID int, commentID *int) (likes int, dislikes int, err error) {
 	query := `
         SELECT 
-            SUM(CASE WHEN is_like = 1 THEN 1 ELSE 0 END) AS likes,
-            SUM(CASE WHEN is_like = 0 THEN 1 ELSE 0 END) AS dislikes
-        FROM likes
-        WHERE post_id = ? AND (comment_id = ? OR (comment_id IS NULL AND ? IS NULL))
+            COUNT(CASE WHEN is_like = 1 THEN 1 END) AS likes,
+            COUNT(CASE WHEN is_like = 0 THEN 1 END) AS dislikes
+        FROM post_reactions
+        WHERE post_id = ?
+    `
+	target := postID
+	if commentID != nil {
+		query = `
+        SELECT 
+            COUNT(CASE WHEN is_like = 1 THEN 1 END) AS likes,
+            COUNT(CASE WHEN is_like = 0 THEN 1 END) AS dislikes
+        FROM comment_reactions
+        WHERE comment_id = ?
     `
+		target = *commentID
+	}
 
-	err = db.QueryRow(query, postID, commentID, commentID).Scan(&likes, &dislikes)
+	err = db.QueryRow(query, target).Scan(&likes, &dislikes)
 	return
 }
 
-// LikePost adds a like for the given post and user
+// LikePost toggles a like for the given post and user, replacing a dislike
 func LikePost(userID int, postID string) error {
-	// First, check if the user has already liked or disliked this post
-	var existingLikeCount int
-	var existingDislikeCount int
-	err := db.QueryRow("SELECT COUNT(*) FROM likes WHERE user_id = ? AND post_id = ? AND comment_id IS NULL AND is_like = 1", userID, postID).Scan(&existingLikeCount)
-	if err != nil {
-		return err
-	}
-	err = db.QueryRow("SELECT COUNT(*) FROM likes WHERE user_id = ? AND post_id = ? AND comment_id IS NULL AND is_like = 0", userID, postID).Scan(&existingDislikeCount)
-	if err != nil {
-		return err
-	}
-
-	// If the user already liked this post, do nothing
-	if existingLikeCount > 0 {
-		_, err := db.Exec("DELETE FROM likes WHERE user_id = ? AND post_id = ? AND comment_id IS NULL AND is_like = 1", userID, postID)
-		if err != nil {
-			return err
-		}
-		return nil
-	}
-
-	// If the user disliked the post, remove the dislike and add a like
-	if existingDislikeCount > 0 {
-		_, err := db.Exec("DELETE FROM likes WHERE user_id = ? AND post_id = ? AND comment_id IS NULL AND is_like = 0", userID, postID)
-		if err != nil {
-			return err
-		}
-	}
-
-	// Insert a new like into the likes table
-	_, err = db.Exec("INSERT INTO likes (user_id, post_id, is_like) VALUES (?, ?, 1)", userID, postID)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return togglePostReaction(userID, postID, true)
 }
 
-// DislikePost adds a dislike for the given post and user
+// DislikePost toggles a dislike for the given post and user, replacing a like
 func DislikePost(userID int, postID string) error {
-	// First, check if the user has already liked or disliked this post
-	var existingLikeCount int
-	var existingDislikeCount int
-	err := db.QueryRow("SELECT COUNT(*) FROM likes WHERE user_id = ? AND post_id = ? AND comment_id IS NULL AND is_like = 1", userID, postID).Scan(&existingLikeCount)
-	if err != nil {
-		return err
-	}
-	err = db.QueryRow("SELECT COUNT(*) FROM likes WHERE user_id = ? AND post_id = ? AND comment_id IS NULL AND is_like = 0", userID, postID).Scan(&existingDislikeCount)
-	if err != nil {
-		return err
-	}
-
-	// If the user already disliked this post, do nothing
-	if existingDislikeCount > 0 {
-		_, err := db.Exec("DELETE FROM likes WHERE user_id = ? AND post_id = ? AND comment_id IS NULL AND is_like = 0", userID, postID)
-		if err != nil {
-			return err
-		}
-		return nil
-	}
-
-	// If the user liked the post, remove the like and add a dislike
-	if existingLikeCount > 0 {
-		_, err := db.Exec("DELETE FROM likes WHERE user_id = ? AND post_id = ? AND comment_id IS NULL AND is_like = 1", userID, postID)
-		if err != nil {
-			return err
-		}
-	}
-
-	// Insert a new dislike into the likes table
-	_, err = db.Exec("INSERT INTO likes (user_id, post_id, is_like) VALUES (?, ?, 0)", userID, postID)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return togglePostReaction(userID, postID, false)
 }
 
-func LikeIconsCom(postID,commentID,userID int) string {
-	var existingLikeCount int
-	var existingDislikeCount int
-	err := db.QueryRow("SELECT COUNT(*) FROM likes WHERE user_id = ? AND post_id = ? AND comment_id = ? AND is_like = 1", userID, postID,commentID).Scan(&existingLikeCount)
-	if err != nil {
-		return ""
-	}
-	err = db.QueryRow("SELECT COUNT(*) FROM likes WHERE user_id = ? AND post_id = ? AND comment_id = ? AND is_like = 0", userID, postID,commentID).Scan(&existingDislikeCount)
-	if err != nil {
-		return ""
-	}
-
-	// If the user already disliked this post, do nothing
-	if existingDislikeCount > 0 {
-		return ""
-	}
-
-	// If the user liked the post, remove the like and add a dislike
-	if existingLikeCount > 0 {
-		return "s"
-	}
-	return ""
+// LikeComment toggles a like for the given comment and user, replacing a dislike
+func LikeComment(userID int, postID string, commentID string) error {
+	return toggleCommentReaction(userID, postID, commentID, true)
 }
 
-func DislikeIconsCom(postID,commentID,userID int) string {
-	var existingLikeCount int
-	var existingDislikeCount int
-	err := db.QueryRow("SELECT COUNT(*) FROM likes WHERE user_id = ? AND post_id = ? AND comment_id = ? AND is_like = 1", userID, postID,commentID).Scan(&existingLikeCount)
-	if err != nil {
-		return ""
-	}
-	err = db.QueryRow("SELECT COUNT(*) FROM likes WHERE user_id = ? AND post_id = ? AND comment_id = ? AND is_like = 0", userID, postID,commentID).Scan(&existingDislikeCount)
-	if err != nil {
-		return ""
-	}
+// DislikeComment toggles a dislike for the given comment and user, replacing a like
+func DislikeComment(userID int, postID string, commentID string) error {
+	return toggleCommentReaction(userID, postID, commentID, false)
+}
 
-	// If the user already disliked this post, do nothing
-	if existingDislikeCount > 0 {
-		return "s"
+// togglePostReaction sets the user's vote on a post, or removes it when they cast the same vote again,
+// and refreshes the post's scores. Reactions to posts that do not exist are ignored.
+// Posts filed only under archived categories return ErrPostArchived.
+func togglePostReaction(userID int, postID string, isLike bool) error {
+	if err := checkPostOpen(postID); err != nil {
+		return err
 	}
-
-	// If the user liked the post, remove the like and add a dislike
-	if existingLikeCount > 0 {
-		return ""
+	refresh := func(tx *sql.Tx) error {
+		return refreshScores(tx, "p.id = ?", postID)
 	}
-	return ""
+	return toggleReaction(`
+		INSERT INTO post_reactions (post_id, user_id, is_like, created_at)
+		SELECT id, ?, ?, ? FROM posts WHERE id = ?
+		ON CONFLICT (post_id, user_id) DO UPDATE
+		SET is_like = excluded.is_like, created_at = excluded.created_at
+		WHERE post_reactions.is_like <> excluded.is_like`,
+		"DELETE FROM post_reactions WHERE post_id = ? AND user_id = ? AND is_like = ?",
+		refresh, userID, postID, isLike)
 }
 
-func LikeIconsPosts(postID int,userID int) string {
-	var existingLikeCount int
-	var existingDislikeCount int
-	err := db.QueryRow("SELECT COUNT(*) FROM likes WHERE user_id = ? AND post_id = ? AND comment_id IS NULL AND is_like = 1", userID, postID).Scan(&existingLikeCount)
-	if err != nil {
-		return ""
+// toggleCommentReaction sets the user's vote on a comment, or removes it when they cast the same vote again.
+// Reactions to comments that do not exist or belong to another post are ignored.
+// Comments on posts filed only under archived categories return ErrPostArchived.
+func toggleCommentReaction(userID int, postID, commentID string, isLike bool) error {
+	if err := checkPostOpen(postID); err != nil {
+		return err
 	}
-	err = db.QueryRow("SELECT COUNT(*) FROM likes WHERE user_id = ? AND post_id = ? AND comment_id IS NULL AND is_like = 0", userID, postID).Scan(&existingDislikeCount)
+	return toggleReaction(`
+		INSERT INTO comment_reactions (comment_id, user_id, is_like, created_at)
+		SELECT id, ?, ?, ? FROM comments WHERE id = ? AND post_id = ?
+		ON CONFLICT (comment_id, user_id) DO UPDATE
+		SET is_like = excluded.is_like, created_at = excluded.created_at
+		WHERE comment_reactions.is_like <> excluded.is_like`,
+		`DELETE FROM comment_reactions WHERE comment_id = ? AND user_id = ? AND is_like = ?
+		AND comment_id IN (SELECT id FROM comments WHERE post_id = ?)`,
+		nil, userID, commentID, isLike, postID)
+}
+
+// toggleReaction runs an upsert that inserts a vote or flips an opposite one, and removes
+// the vote when the upsert changed nothing because the same vote was already there.
+// Both statements take the same extra arguments after their own.
+// Both statements share a transaction, so concurrent clicks cannot leave a stale or duplicate vote.
+// refresh, when not nil, runs last in the same transaction to update what is derived from the votes.
+func toggleReaction(upsert, remove string, refresh func(tx *sql.Tx) error, userID int, targetID string, isLike bool, extra ...any) error {
+	tx, err := db.Begin()
 	if err != nil {
-		return ""
-	}
-
-	// If the user already disliked this post, do nothing
-	if existingDislikeCount > 0 {
-		return ""
-	}
-
-	// If the user liked the post, remove the like and add a dislike
-	if existingLikeCount > 0 {
-		return "s"
+		return err
 	}
-	return ""
-}
+	defer tx.Rollback()
 
-func DislikeIconsPosts(postID int,userID int) string {
-	var existingLikeCount int
-	var existingDislikeCount int
-	err := db.QueryRow("SELECT COUNT(*) FROM likes WHERE user_id = ? AND post_id = ? AND comment_id IS NULL AND is_like = 1", userID, postID).Scan(&existingLikeCount)
+	args := append([]any{userID, isLike, time.Now().UTC(), targetID}, extra...)
+	res, err := tx.Exec(upsert, args...)
 	if err != nil {
-		return ""
+		return err
 	}
-	err = db.QueryRow("SELECT COUNT(*) FROM likes WHERE user_id = ? AND post_id = ? AND comment_id IS NULL AND is_like = 0", userID, postID).Scan(&existingDislikeCount)
+	changed, err := res.RowsAffected()
 	if err != nil {
-		return ""
+		return err
 	}
-
-	// If the user already disliked this post, do nothing
-	if existingDislikeCount > 0 {
-		return "s"
+	if changed == 0 {
+		if _, err := tx.Exec(remove, append([]any{targetID, userID, isLike}, extra...)...); err != nil {
+			return err
+		}
 	}
-
-	// If the user liked the post, remove the like and add a dislike
-	if existingLikeCount > 0 {
-		return ""
+	if refresh != nil {
+		if err := refresh(tx); err != nil {
+			return err
+		}
 	}
-	return ""
+	return tx.Commit()
 }
 
-// FetchUserLikes retrieves all likes made by a user.
+// FetchUserLikes retrieves all post and comment votes made by a user.
 func FetchUserLikes(userID int) ([]map[string]interface{}, error) {
 	rows, err := db.Query(`
-        SELECT 
-            l.id AS like_id, l.post_id, l.comment_id, l.is_like, p.content AS post_content, c.content AS comment_content
-        FROM likes l
-        LEFT JOIN posts p ON l.post_id = p.id
-        LEFT JOIN comments c ON l.comment_id = c.id
-        WHERE l.user_id = ?
-    `, userID)
+        SELECT r.post_id, NULL, r.is_like, p.content, NULL
+        FROM post_reactions r
+        LEFT JOIN posts p ON r.post_id = p.id
+        WHERE r.user_id = ?
+        UNION ALL
+        SELECT c.post_id, r.comment_id, r.is_like, p.content, c.content
+        FROM comment_reactions r
+        LEFT JOIN comments c ON r.comment_id = c.id
+        LEFT JOIN posts p ON c.post_id = p.id
+        WHERE r.user_id = ?
+    `, userID, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -333,17 +324,16 @@ func FetchUserLikes(userID int) ([]map[string]interface{}, error) {
 
 	var likes []map[string]interface{}
 	for rows.Next() {
-		var likeID, postID, commentID sql.NullInt64
+		var postID, commentID sql.NullInt64
 		var isLike bool
 		var postContent, commentContent sql.NullString
 
-		err = rows.Scan(&likeID, &postID, &commentID, &isLike, &postContent, &commentContent)
+		err = rows.Scan(&postID, &commentID, &isLike, &postContent, &commentContent)
 		if err != nil {
 			return nil, err
 		}
 
 		like := map[string]interface{}{
-			"like_id":         likeID.Int64,
 			"post_id":         postID.Int64,
 			"comment_id":      commentID.Int64,
 			"is_like":         isLike,
@@ -355,7 +345,7 @@ func FetchUserLikes(userID int) ([]map[string]interface{}, error) {
 	return likes, nil
 }
 
-// InsertPost inserts a new post into the database
+// InsertPost inserts a new post into the database and gives it the scores of a post without votes
 func InsertPost(userID int, content string) (int64, error) {
 	stmt, err := db.Prepare("INSERT INTO posts (user_id, content) VALUES (?, ?)")
 	if err != nil {
@@ -365,11 +355,19 @@ func InsertPost(userID int, content string) (int64, error) {
 	if err != nil {
 		return 0, err
 	}
-	return res.LastInsertId()
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return id, refreshScores(db, "p.id = ?", id)
 }
 
-// InsertComment inserts a new post into the database
+// InsertComment inserts a new post into the database.
+// Posts filed only under archived categories return ErrPostArchived.
 func InsertComment(userID int, postID int, content string) (int64, error) {
+	if err := checkPostOpen(postID); err != nil {
+		return 0, err
+	}
 	stmt, err := db.Prepare("INSERT INTO comments (user_id, post_id, content) VALUES (?, ?, ?)")
 	if err != nil {
 		return 0, err
@@ -381,16 +379,6 @@ func InsertComment(userID int, postID int, content string) (int64, error) {
 	return res.LastInsertId()
 }
 
-// FetchUserIDBySessionToken retrieves the user ID for a given session token
-func FetchUserIDBySessionToken(sessionToken string) (int, error) {
-	var userID int
-	err := db.QueryRow("SELECT id FROM users WHERE cookies = ?", sessionToken).Scan(&userID)
-	if err != nil {
-		return 0, err
-	}
-	return userID, nil
-}
-
 // FetchUserIDBySessionToken retrieves the user ID for a given session token
 func FetchUsernameByUserID(id int) (string, error) {
 	var username string
@@ -401,832 +389,17 @@ func FetchUsernameByUserID(id int) (string, error) {
 	return username, nil
 }
 
-// GetOrCreateCategory returns the category ID for a given name, creating it if necessary.
-func GetOrCreateCategory(name string) (int, error) {
-	var categoryID int
-	err := db.QueryRow("SELECT id FROM categories WHERE name = ?", name).Scan(&categoryID)
-	if err == sql.ErrNoRows {
-		gnrl := "Gnrl"
-		err := db.QueryRow("SELECT id FROM categories WHERE name = ?", gnrl).Scan(&categoryID)
-		if err != nil {
-			return 0, err
-		}
-		return categoryID, err
-	}
-	return categoryID, err
-}
-
 // AssociatePostWithCategory creates an association between a post and a category.
 func AssociatePostWithCategory(postID int64, categoryID int) error {
 	_, err := db.Exec("INSERT INTO post_categories (post_id, category_id) VALUES (?, ?)", postID, categoryID)
 	return err
 }
 
-// FetchPosts retrieves all posts from the database and includes like and dislike counts.
-func FetchPosts(user int) ([]models.Post, error) {
-	rows, err := db.Query(`
-        SELECT 
-            p.id, p.user_id, u.username, p.content, p.created_at,
-            COUNT(CASE WHEN l.is_like = 1 THEN 1 END) AS likes,
-            COUNT(CASE WHEN l.is_like = 0 THEN 1 END) AS dislikes
-        FROM posts p
-        JOIN users u ON p.user_id = u.id
-        LEFT JOIN likes l ON p.id = l.post_id AND l.comment_id IS NULL
-        GROUP BY p.id
-        ORDER BY p.created_at DESC
-    `)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var posts []models.Post
-	for rows.Next() {
-		var post models.Post
-		err := rows.Scan(&post.ID, &post.UserID, &post.Username, &post.Content, &post.CreatedAt, &post.Likes, &post.Dislikes)
-		if err != nil {
-			return nil, err
-		}
-
-		post.FormatDate = FormatDate(post.CreatedAt)
-
-		// Optionally, fetch media for each post
-		media, err := FetchMediaByPostID(post.ID)
-		if err != nil {
-			return nil, err
-		}
-		post.Media = media
-
-		comments, err := FetchCommentsByPostID(post.ID,user)
-		if err != nil {
-			return nil, err
-		}
-		post.Comment = comments
-		commentCount, err := CountComments(post.ID)
-		if err != nil {
-			return nil, err
-		}
-		post.ComCount = commentCount
-
-		profileColor, err := getProfileColor(post.UserID)
-		if err != nil {
-			return nil, err
-		}
-		post.ProfileColor = profileColor
-
-		post.LikeIcon = LikeIconsPosts(post.ID,user)
-		post.DislikeIcon = DislikeIconsPosts(post.ID,user)
-		posts = append(posts, post)
-	}
-	return posts, nil
-}
-
-// FetchMemesPostsByCategoryID retrieves posts for the Memes category by its ID
-func FetchMemesPostsByCategoryID(categoryID,user int) ([]models.MemesPosts, error) {
-	// Query to retrieve posts in the Memes category
-	rows, err := db.Query(`
-		SELECT p.id, pc.category_id, p.user_id, u.username, p.content, p.created_at,
-			COUNT(CASE WHEN l.is_like = 1 THEN 1 END) AS likes,
-			COUNT(CASE WHEN l.is_like = 0 THEN 1 END) AS dislikes
-		FROM posts p
-		JOIN users u ON p.user_id = u.id
-		LEFT JOIN likes l ON p.id = l.post_id AND l.comment_id IS NULL
-		JOIN post_categories pc ON p.id = pc.post_id
-		WHERE pc.category_id = ?
-		GROUP BY p.id
-		ORDER BY p.created_at DESC
-	`, categoryID)
-	if err != nil {
-		return nil, fmt.Errorf("Error querying posts for category ID %d: %w", categoryID, err)
-	}
-	defer rows.Close()
-
-	// Initialize an empty slice to store the fetched posts
-	var posts []models.MemesPosts
-	for rows.Next() {
-		var post models.MemesPosts
-
-		// Scan the database row into the MemesPosts struct
-		err := rows.Scan(&post.PostID, &post.CategoriesID, &post.UserID, &post.Username, &post.Content, &post.CreatedAt, &post.Likes, &post.Dislikes)
-		if err != nil {
-			return nil, fmt.Errorf("Error scanning post data: %w", err)
-		}
-
-		// Format the created date for the post
-		post.FormatDate = FormatDate(post.CreatedAt)
-
-		// Fetch media for the post (e.g., images, videos)
-		media, err := FetchMediaByPostID(post.PostID)
-		if err != nil {
-			return nil, fmt.Errorf("Error fetching media for post %d: %w", post.PostID, err)
-		}
-		post.Media = media
-
-		// Fetch comments for the post
-		comments, err := FetchCommentsByPostID(post.PostID,user)
-		if err != nil {
-			return nil, fmt.Errorf("Error fetching comments for post %d: %w", post.PostID, err)
-		}
-		post.Comment = comments
-
-		// Fetch the comment count for the post
-		commentCount, err := CountComments(post.PostID)
-		if err != nil {
-			return nil, fmt.Errorf("Error counting comments for post %d: %w", post.PostID, err)
-		}
-		post.ComCount = commentCount
-
-		profileColor, err := getProfileColor(post.UserID)
-		if err != nil {
-			return nil, err
-		}
-		post.ProfileColor = profileColor
-
-		post.LikeIcon = LikeIconsPosts(post.PostID,user)
-		post.DislikeIcon = DislikeIconsPosts(post.PostID,user)
-		// Append the populated post to the posts slice
-		posts = append(posts, post)
-	}
-
-	// Return the populated slice of MemesPosts
-	return posts, nil
-}
-
-// FetchMemesPostsByCategoryID retrieves posts for the Memes category by its ID
-func FetchGamingPostsByCategoryID(categoryID,user int) ([]models.GamingPosts, error) {
-	// Query to retrieve posts in the Memes category
-	rows, err := db.Query(`
-		SELECT p.id, pc.category_id, p.user_id, u.username, p.content, p.created_at,
-			COUNT(CASE WHEN l.is_like = 1 THEN 1 END) AS likes,
-			COUNT(CASE WHEN l.is_like = 0 THEN 1 END) AS dislikes
-		FROM posts p
-		JOIN users u ON p.user_id = u.id
-		LEFT JOIN likes l ON p.id = l.post_id AND l.comment_id IS NULL
-		JOIN post_categories pc ON p.id = pc.post_id
-		WHERE pc.category_id = ?
-		GROUP BY p.id
-		ORDER BY p.created_at DESC
-	`, categoryID)
-	if err != nil {
-		return nil, fmt.Errorf("Error querying posts for category ID %d: %w", categoryID, err)
-	}
-	defer rows.Close()
-
-	// Initialize an empty slice to store the fetched posts
-	var posts []models.GamingPosts
-	for rows.Next() {
-		var post models.GamingPosts
-
-		// Scan the database row into the MemesPosts struct
-		err := rows.Scan(&post.PostID, &post.CategoriesID, &post.UserID, &post.Username, &post.Content, &post.CreatedAt, &post.Likes, &post.Dislikes)
-		if err != nil {
-			return nil, fmt.Errorf("Error scanning post data: %w", err)
-		}
-
-		// Format the created date for the post
-		post.FormatDate = FormatDate(post.CreatedAt)
-
-		// Fetch media for the post (e.g., images, videos)
-		media, err := FetchMediaByPostID(post.PostID)
-		if err != nil {
-			return nil, fmt.Errorf("Error fetching media for post %d: %w", post.PostID, err)
-		}
-		post.Media = media
-
-		// Fetch comments for the post
-		comments, err := FetchCommentsByPostID(post.PostID,user)
-		if err != nil {
-			return nil, fmt.Errorf("Error fetching comments for post %d: %w", post.PostID, err)
-		}
-		post.Comment = comments
-
-		// Fetch the comment count for the post
-		commentCount, err := CountComments(post.PostID)
-		if err != nil {
-			return nil, fmt.Errorf("Error counting comments for post %d: %w", post.PostID, err)
-		}
-		post.ComCount = commentCount
-
-		profileColor, err := getProfileColor(post.UserID)
-		if err != nil {
-			return nil, err
-		}
-		post.ProfileColor = profileColor
-
-		post.LikeIcon = LikeIconsPosts(post.PostID,user)
-		post.DislikeIcon = DislikeIconsPosts(post.PostID,user)
-
-		// Append the populated post to the posts slice
-		posts = append(posts, post)
-	}
-
-	// Return the populated slice of MemesPosts
-	return posts, nil
-}
-
-// FetchMemesPostsByCategoryID retrieves posts for the Memes category by its ID
-func FetcheEducationPostsByCategoryID(categoryID,user int) ([]models.EducationPosts, error) {
-	// Query to retrieve posts in the Memes category
-	rows, err := db.Query(`
-		SELECT p.id, pc.category_id, p.user_id, u.username, p.content, p.created_at,
-			COUNT(CASE WHEN l.is_like = 1 THEN 1 END) AS likes,
-			COUNT(CASE WHEN l.is_like = 0 THEN 1 END) AS dislikes
-		FROM posts p
-		JOIN users u ON p.user_id = u.id
-		LEFT JOIN likes l ON p.id = l.post_id AND l.comment_id IS NULL
-		JOIN post_categories pc ON p.id = pc.post_id
-		WHERE pc.category_id = ?
-		GROUP BY p.id
-		ORDER BY p.created_at DESC
-	`, categoryID)
-	if err != nil {
-		return nil, fmt.Errorf("Error querying posts for category ID %d: %w", categoryID, err)
-	}
-	defer rows.Close()
-
-	// Initialize an empty slice to store the fetched posts
-	var posts []models.EducationPosts
-	for rows.Next() {
-		var post models.EducationPosts
-
-		// Scan the database row into the MemesPosts struct
-		err := rows.Scan(&post.PostID, &post.CategoriesID, &post.UserID, &post.Username, &post.Content, &post.CreatedAt, &post.Likes, &post.Dislikes)
-		if err != nil {
-			return nil, fmt.Errorf("Error scanning post data: %w", err)
-		}
-
-		// Format the created date for the post
-		post.FormatDate = FormatDate(post.CreatedAt)
-
-		// Fetch media for the post (e.g., images, videos)
-		media, err := FetchMediaByPostID(post.PostID)
-		if err != nil {
-			return nil, fmt.Errorf("Error fetching media for post %d: %w", post.PostID, err)
-		}
-		post.Media = media
-
-		// Fetch comments for the post
-		comments, err := FetchCommentsByPostID(post.PostID,user)
-		if err != nil {
-			return nil, fmt.Errorf("Error fetching comments for post %d: %w", post.PostID, err)
-		}
-		post.Comment = comments
-
-		// Fetch the comment count for the post
-		commentCount, err := CountComments(post.PostID)
-		if err != nil {
-			return nil, fmt.Errorf("Error counting comments for post %d: %w", post.PostID, err)
-		}
-		post.ComCount = commentCount
-
-		profileColor, err := getProfileColor(post.UserID)
-		if err != nil {
-			return nil, err
-		}
-		post.ProfileColor = profileColor
-
-		post.LikeIcon = LikeIconsPosts(post.PostID,user)
-		post.DislikeIcon = DislikeIconsPosts(post.PostID,user)
-
-		// Append the populated post to the posts slice
-		posts = append(posts, post)
-	}
-
-	// Return the populated slice of MemesPosts
-	return posts, nil
-}
-
-// FetchMemesPostsByCategoryID retrieves posts for the Memes category by its ID
-func FetchTechnologyPostsByCategoryID(categoryID,user int) ([]models.TechnologyPosts, error) {
-	// Query to retrieve posts in the Memes category
-	rows, err := db.Query(`
-		SELECT p.id, pc.category_id, p.user_id, u.username, p.content, p.created_at,
-			COUNT(CASE WHEN l.is_like = 1 THEN 1 END) AS likes,
-			COUNT(CASE WHEN l.is_like = 0 THEN 1 END) AS dislikes
-		FROM posts p
-		JOIN users u ON p.user_id = u.id
-		LEFT JOIN likes l ON p.id = l.post_id AND l.comment_id IS NULL
-		JOIN post_categories pc ON p.id = pc.post_id
-		WHERE pc.category_id = ?
-		GROUP BY p.id
-		ORDER BY p.created_at DESC
-	`, categoryID)
-	if err != nil {
-		return nil, fmt.Errorf("Error querying posts for category ID %d: %w", categoryID, err)
-	}
-	defer rows.Close()
-
-	// Initialize an empty slice to store the fetched posts
-	var posts []models.TechnologyPosts
-	for rows.Next() {
-		var post models.TechnologyPosts
-
-		// Scan the database row into the MemesPosts struct
-		err := rows.Scan(&post.PostID, &post.CategoriesID, &post.UserID, &post.Username, &post.Content, &post.CreatedAt, &post.Likes, &post.Dislikes)
-		if err != nil {
-			return nil, fmt.Errorf("Error scanning post data: %w", err)
-		}
-
-		// Format the created date for the post
-		post.FormatDate = FormatDate(post.CreatedAt)
-
-		// Fetch media for the post (e.g., images, videos)
-		media, err := FetchMediaByPostID(post.PostID)
-		if err != nil {
-			return nil, fmt.Errorf("Error fetching media for post %d: %w", post.PostID, err)
-		}
-		post.Media = media
-
-		// Fetch comments for the post
-		comments, err := FetchCommentsByPostID(post.PostID,user)
-		if err != nil {
-			return nil, fmt.Errorf("Error fetching comments for post %d: %w", post.PostID, err)
-		}
-		post.Comment = comments
-
-		// Fetch the comment count for the post
-		commentCount, err := CountComments(post.PostID)
-		if err != nil {
-			return nil, fmt.Errorf("Error counting comments for post %d: %w", post.PostID, err)
-		}
-		post.ComCount = commentCount
-
-		profileColor, err := getProfileColor(post.UserID)
-		if err != nil {
-			return nil, err
-		}
-		post.ProfileColor = profileColor
-
-		post.LikeIcon = LikeIconsPosts(post.PostID,user)
-		post.DislikeIcon = DislikeIconsPosts(post.PostID,user)
-
-		// Append the populated post to the posts slice
-		posts = append(posts, post)
-	}
-
-	// Return the populated slice of MemesPosts
-	return posts, nil
-}
-
-// FetchMemesPostsByCategoryID retrieves posts for the Memes category by its ID
-func FetchSciencePostsByCategoryID(categoryID,user int) ([]models.SciencePosts, error) {
-	// Query to retrieve posts in the Memes category
-	rows, err := db.Query(`
-		SELECT p.id, pc.category_id, p.user_id, u.username, p.content, p.created_at,
-			COUNT(CASE WHEN l.is_like = 1 THEN 1 END) AS likes,
-			COUNT(CASE WHEN l.is_like = 0 THEN 1 END) AS dislikes
-		FROM posts p
-		JOIN users u ON p.user_id = u.id
-		LEFT JOIN likes l ON p.id = l.post_id AND l.comment_id IS NULL
-		JOIN post_categories pc ON p.id = pc.post_id
-		WHERE pc.category_id = ?
-		GROUP BY p.id
-		ORDER BY p.created_at DESC
-	`, categoryID)
-	if err != nil {
-		return nil, fmt.Errorf("Error querying posts for category ID %d: %w", categoryID, err)
-	}
-	defer rows.Close()
-
-	// Initialize an empty slice to store the fetched posts
-	var posts []models.SciencePosts
-	for rows.Next() {
-		var post models.SciencePosts
-
-		// Scan the database row into the MemesPosts struct
-		err := rows.Scan(&post.PostID, &post.CategoriesID, &post.UserID, &post.Username, &post.Content, &post.CreatedAt, &post.Likes, &post.Dislikes)
-		if err != nil {
-			return nil, fmt.Errorf("Error scanning post data: %w", err)
-		}
-
-		// Format the created date for the post
-		post.FormatDate = FormatDate(post.CreatedAt)
-
-		// Fetch media for the post (e.g., images, videos)
-		media, err := FetchMediaByPostID(post.PostID)
-		if err != nil {
-			return nil, fmt.Errorf("Error fetching media for post %d: %w", post.PostID, err)
-		}
-		post.Media = media
-
-		// Fetch comments for the post
-		comments, err := FetchCommentsByPostID(post.PostID,user)
-		if err != nil {
-			return nil, fmt.Errorf("Error fetching comments for post %d: %w", post.PostID, err)
-		}
-		post.Comment = comments
-
-		// Fetch the comment count for the post
-		commentCount, err := CountComments(post.PostID)
-		if err != nil {
-			return nil, fmt.Errorf("Error counting comments for post %d: %w", post.PostID, err)
-		}
-		post.ComCount = commentCount
-
-		profileColor, err := getProfileColor(post.UserID)
-		if err != nil {
-			return nil, err
-		}
-		post.ProfileColor = profileColor
-
-		post.LikeIcon = LikeIconsPosts(post.PostID,user)
-		post.DislikeIcon = DislikeIconsPosts(post.PostID,user)
-
-		// Append the populated post to the posts slice
-		posts = append(posts, post)
-	}
-
-	// Return the populated slice of MemesPosts
-	return posts, nil
-}
-
-// FetchMemesPostsByCategoryID retrieves posts for the Memes category by its ID
-func FetchSportsPostsByCategoryID(categoryID,user int) ([]models.SportsPosts, error) {
-	// Query to retrieve posts in the Memes category
-	rows, err := db.Query(`
-		SELECT p.id, pc.category_id, p.user_id, u.username, p.content, p.created_at,
-			COUNT(CASE WHEN l.is_like = 1 THEN 1 END) AS likes,
-			COUNT(CASE WHEN l.is_like = 0 THEN 1 END) AS dislikes
-		FROM posts p
-		JOIN users u ON p.user_id = u.id
-		LEFT JOIN likes l ON p.id = l.post_id AND l.comment_id IS NULL
-		JOIN post_categories pc ON p.id = pc.post_id
-		WHERE pc.category_id = ?
-		GROUP BY p.id
-		ORDER BY p.created_at DESC
-	`, categoryID)
-	if err != nil {
-		return nil, fmt.Errorf("Error querying posts for category ID %d: %w", categoryID, err)
-	}
-	defer rows.Close()
-
-	// Initialize an empty slice to store the fetched posts
-	var posts []models.SportsPosts
-	for rows.Next() {
-		var post models.SportsPosts
-
-		// Scan the database row into the MemesPosts struct
-		err := rows.Scan(&post.PostID, &post.CategoriesID, &post.UserID, &post.Username, &post.Content, &post.CreatedAt, &post.Likes, &post.Dislikes)
-		if err != nil {
-			return nil, fmt.Errorf("Error scanning post data: %w", err)
-		}
-
-		// Format the created date for the post
-		post.FormatDate = FormatDate(post.CreatedAt)
-
-		// Fetch media for the post (e.g., images, videos)
-		media, err := FetchMediaByPostID(post.PostID)
-		if err != nil {
-			return nil, fmt.Errorf("Error fetching media for post %d: %w", post.PostID, err)
-		}
-		post.Media = media
-
-		// Fetch comments for the post
-		comments, err := FetchCommentsByPostID(post.PostID,user)
-		if err != nil {
-			return nil, fmt.Errorf("Error fetching comments for post %d: %w", post.PostID, err)
-		}
-		post.Comment = comments
-
-		// Fetch the comment count for the post
-		commentCount, err := CountComments(post.PostID)
-		if err != nil {
-			return nil, fmt.Errorf("Error counting comments for post %d: %w", post.PostID, err)
-		}
-		post.ComCount = commentCount
-
-		profileColor, err := getProfileColor(post.UserID)
-		if err != nil {
-			return nil, err
-		}
-		post.ProfileColor = profileColor
-
-		post.LikeIcon = LikeIconsPosts(post.PostID,user)
-		post.DislikeIcon = DislikeIconsPosts(post.PostID,user)
-
-		// Append the populated post to the posts slice
-		posts = append(posts, post)
-	}
-
-	// Return the populated slice of MemesPosts
-	return posts, nil
-}
-
+// FormatDate formats a post or comment date for display
 func FormatDate(date time.Time) string {
 	return date.Format("02 Jan 2006")
 }
 
-func FetchCommentsByPostID(postID,user int) ([]models.Comment, error) {
-	rows, err := db.Query(`
-		SELECT 
-			c.id, 
-			c.user_id, 
-			c.content, 
-			c.created_at,
-			COUNT(CASE WHEN l.is_like = 1 THEN 1 END) AS likes,
-			COUNT(CASE WHEN l.is_like = 0 THEN 1 END) AS dislikes
-		FROM 
-			comments c
-		LEFT JOIN 
-			likes l ON c.id = l.comment_id
-		WHERE 
-			c.post_id = ?
-		GROUP BY 
-			c.id, c.user_id, c.content, c.created_at
-		ORDER BY 
-			c.created_at DESC;
-	`, postID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var comments []models.Comment
-	for rows.Next() {
-		var comment models.Comment
-		var userID int
-		err := rows.Scan(&comment.ComID, &userID, &comment.ComContent, &comment.ComCreatedAt, &comment.ComLikes, &comment.ComDislikes)
-		if err != nil {
-			return nil, err
-		}
-
-		comment.ComFormatDate = FormatDate(comment.ComCreatedAt)
-
-		// Fetch username using FetchUsernameByUserID
-		username, err := FetchUsernameByUserID(userID)
-		if err != nil {
-			return nil, err
-		}
-		comment.ComUsername = username
-		comment.PostID = postID
-		
-		profileColor, err := getProfileColor(userID)
-		if err != nil {
-			return nil, err
-		}
-		comment.ComProfile = profileColor
-
-		comment.ComLikeIcon = LikeIconsCom(comment.PostID,comment.ComID,user)
-		comment.ComDislikeIcon = DislikeIconsCom(comment.PostID,comment.ComID,user)
-
-		comments = append(comments, comment)
-	}
-
-	return comments, nil
-}
-
-func LikeComment(userID int, postID string, commentID string) error {
-	// First, check if the user has already liked or disliked this post
-	var existingLikeCount int
-	var existingDislikeCount int
-	err := db.QueryRow("SELECT COUNT(*) FROM likes WHERE user_id = ? AND post_id = ? AND comment_id = ? AND is_like = 1", userID, postID, commentID).Scan(&existingLikeCount)
-	if err != nil {
-		return err
-	}
-	err = db.QueryRow("SELECT COUNT(*) FROM likes WHERE user_id = ? AND post_id = ? AND comment_id = ? AND is_like = 0", userID, postID, commentID).Scan(&existingDislikeCount)
-	if err != nil {
-		return err
-	}
-
-	// If the user already liked this post, do nothing
-	if existingLikeCount > 0 {
-		_, err := db.Exec("DELETE FROM likes WHERE user_id = ? AND post_id = ? AND comment_id = ? AND is_like = 1", userID, postID, commentID)
-		if err != nil {
-			return err
-		}
-		return nil
-	}
-
-	// If the user disliked the post, remove the dislike and add a like
-	if existingDislikeCount > 0 {
-		_, err := db.Exec("DELETE FROM likes WHERE user_id = ? AND post_id = ? AND comment_id = ? AND is_like = 0", userID, postID, commentID)
-		if err != nil {
-			return err
-		}
-	}
-
-	// Insert a new like into the likes table
-	_, err = db.Exec("INSERT INTO likes (user_id, post_id, comment_id, is_like) VALUES (?, ?, ?, 1)", userID, postID, commentID)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func DislikeComment(userID int, postID string, commentID string) error {
-	// First, check if the user has already liked or disliked this post
-	var existingLikeCount int
-	var existingDislikeCount int
-	err := db.QueryRow("SELECT COUNT(*) FROM likes WHERE user_id = ? AND post_id = ? AND comment_id = ? AND is_like = 1", userID, postID, commentID).Scan(&existingLikeCount)
-	if err != nil {
-		return err
-	}
-	err = db.QueryRow("SELECT COUNT(*) FROM likes WHERE user_id = ? AND post_id = ? AND comment_id = ? AND is_like = 0", userID, postID, commentID).Scan(&existingDislikeCount)
-	if err != nil {
-		return err
-	}
-
-	// If the user already liked this post, do nothing
-	if existingDislikeCount > 0 {
-		_, err := db.Exec("DELETE FROM likes WHERE user_id = ? AND post_id = ? AND comment_id = ? AND is_like = 0", userID, postID, commentID)
-		if err != nil {
-			return err
-		}
-		return nil
-	}
-
-	// If the user disliked the post, remove the dislike and add a like
-	if existingLikeCount > 0 {
-		_, err := db.Exec("DELETE FROM likes WHERE user_id = ? AND post_id = ? AND comment_id = ? AND is_like = 1", userID, postID, commentID)
-		if err != nil {
-			return err
-		}
-	}
-
-	// Insert a new like into the likes table
-	_, err = db.Exec("INSERT INTO likes (user_id, post_id, comment_id, is_like) VALUES (?, ?, ?, 0)", userID, postID, commentID)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// CountComments fetches the total number of comments for a specific post.
-func CountComments(postID int) (ComCount int, err error) {
-	query := `
-        SELECT 
-            COUNT(*) AS ComCount
-        FROM comments
-        WHERE post_id = ?
-    `
-
-	err = db.QueryRow(query, postID).Scan(&ComCount)
-	return
-}
-
-func FetchLikedPosts(userID int) ([]models.Post, error) {
-	query := `
-        SELECT 
-            p.id, p.user_id, u.username, p.content, p.created_at,
-            COUNT(CASE WHEN l.is_like = 1 THEN 1 END) AS likes,
-            COUNT(CASE WHEN l.is_like = 0 THEN 1 END) AS dislikes
-        FROM likes l
-        JOIN posts p ON l.post_id = p.id
-        JOIN users u ON p.user_id = u.id
-        WHERE l.user_id = ? AND l.comment_id IS NULL AND l.is_like = 1
-        GROUP BY p.id
-        ORDER BY p.created_at DESC`
-
-	rows, err := db.Query(query, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var likedPosts []models.Post
-	for rows.Next() {
-		var post models.Post
-		var username string
-		err := rows.Scan(&post.ID, &post.UserID, &username, &post.Content, &post.CreatedAt, &post.Likes, &post.Dislikes)
-		if err != nil {
-			return nil, err
-		}
-
-		post.Username = username
-		post.FormatDate = FormatDate(post.CreatedAt)
-
-		// Fetch media and comments for the post
-		post.Media, err = FetchMediaByPostID(post.ID)
-		if err != nil {
-			return nil, err
-		}
-		post.Comment, err = FetchCommentsByPostID(post.ID,userID)
-		if err != nil {
-			return nil, err
-		}
-		profileColor, err := getProfileColor(post.UserID)
-		if err != nil {
-			return nil, err
-		}
-		post.ProfileColor = profileColor
-
-		post.LikeIcon = LikeIconsPosts(post.ID,userID)
-		post.DislikeIcon = DislikeIconsPosts(post.ID,userID)
-
-		likedPosts = append(likedPosts, post)
-	}
-
-	return likedPosts, nil
-}
-
-func FetchDislikedPosts(userID int) ([]models.Post, error) {
-	rows, err := db.Query(`
-		SELECT 
-			p.id, p.user_id, u.username, p.content, p.created_at,
-			COUNT(CASE WHEN l.is_like = 1 THEN 1 END) AS likes,
-			COUNT(CASE WHEN l.is_like = 0 THEN 1 END) AS dislikes
-		FROM likes l
-		JOIN posts p ON l.post_id = p.id
-		JOIN users u ON p.user_id = u.id
-		WHERE l.user_id = ? AND l.comment_id IS NULL AND l.is_like = 0
-		GROUP BY p.id
-		ORDER BY p.created_at DESC`, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var dislikedPosts []models.Post
-	for rows.Next() {
-		var post models.Post
-		var username string
-		err := rows.Scan(&post.ID, &post.UserID, &username, &post.Content, &post.CreatedAt, &post.Likes, &post.Dislikes)
-		if err != nil {
-			return nil, err
-		}
-
-		post.Username = username
-		post.FormatDate = FormatDate(post.CreatedAt)
-
-		// Fetch media and comments for the post
-		post.Media, err = FetchMediaByPostID(post.ID)
-		if err != nil {
-			return nil, err
-		}
-		post.Comment, err = FetchCommentsByPostID(post.ID,userID)
-		if err != nil {
-			return nil, err
-		}
-		profileColor, err := getProfileColor(post.UserID)
-		if err != nil {
-			return nil, err
-		}
-		post.ProfileColor = profileColor
-
-		post.LikeIcon = LikeIconsPosts(post.ID,userID)
-		post.DislikeIcon = DislikeIconsPosts(post.ID,userID)
-
-		dislikedPosts = append(dislikedPosts, post)
-	}
-
-	return dislikedPosts, nil
-}
-
-func FetchCreatedPosts(userID int) ([]models.Post, error) {
-	rows, err := db.Query(`
-		SELECT 
-			p.id, p.user_id, u.username, p.content, p.created_at,
-			COUNT(CASE WHEN l.is_like = 1 THEN 1 END) AS likes,
-			COUNT(CASE WHEN l.is_like = 0 THEN 1 END) AS dislikes
-		FROM posts p
-		JOIN users u ON p.user_id = u.id
-		LEFT JOIN likes l ON p.id = l.post_id AND l.comment_id IS NULL
-		WHERE p.user_id = ?
-		GROUP BY p.id
-		ORDER BY p.created_at DESC`, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var createdPosts []models.Post
-	for rows.Next() {
-		var post models.Post
-		var username string
-		err := rows.Scan(&post.ID, &post.UserID, &username, &post.Content, &post.CreatedAt, &post.Likes, &post.Dislikes)
-		if err != nil {
-			return nil, err
-		}
-
-		post.Username = username
-		post.FormatDate = FormatDate(post.CreatedAt)
-
-		// Fetch media and comments for the post
-		post.Media, err = FetchMediaByPostID(post.ID)
-		if err != nil {
-			return nil, err
-		}
-		post.Comment, err = FetchCommentsByPostID(post.ID,userID)
-		if err != nil {
-			return nil, err
-		}
-		profileColor, err := getProfileColor(post.UserID)
-		if err != nil {
-			return nil, err
-		}
-		post.ProfileColor = profileColor
-
-		post.LikeIcon = LikeIconsPosts(post.ID,userID)
-		post.DislikeIcon = DislikeIconsPosts(post.ID,userID)
-
-		createdPosts = append(createdPosts, post)
-	}
-
-	return createdPosts, nil
-}
-
 func FetchUserProfileBySessionToken(sessionToken string) ([]models.UserProfile, error) {
 
 	if sessionToken == "" {
@@ -1237,16 +410,16 @@ func FetchUserProfileBySessionToken(sessionToken string) ([]models.UserProfile,
 	if err != nil {
 		return nil, err
 	}
-	likedPosts, err := FetchLikedPosts(userID)
+	likedPosts, err := FetchLikedPostsPage(userID, PageRequest{})
 	if err != nil {
 		return nil, err
 	}
-	dislikedPosts, err := FetchDislikedPosts(userID)
+	dislikedPosts, err := FetchDislikedPostsPage(userID, PageRequest{})
 	if err != nil {
 		return nil, err
 	}
 
-	createdPosts, err := FetchCreatedPosts(userID)
+	createdPosts, err := FetchCreatedPostsPage(userID, PageRequest{})
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,92 @@
+package root
+
+import (
+	"database/sql"
+	"root/internal/models"
+	"strings"
+	"time"
+)
+
+// apiTokenTouchInterval limits how often last_used_at is written for a busy token
+const apiTokenTouchInterval = time.Minute
+
+// CreateAPIToken stores a personal access token. A zero expiresAt means it never expires.
+func CreateAPIToken(userID int, name, token string, scopes []string, expiresAt time.Time) error {
+	var expires sql.NullTime
+	if !expiresAt.IsZero() {
+		expires = sql.NullTime{Time: expiresAt.UTC(), Valid: true}
+	}
+	_, err := db.Exec(`
+		INSERT INTO api_tokens (user_id, name, token_hash, scopes, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		userID, name, hashToken(token), strings.Join(scopes, " "), time.Now().UTC(), expires)
+	return err
+}
+
+// FetchUserIDByAPIToken retrieves the user ID and scopes for a personal access token,
+// the same way FetchUserIDBySessionToken does for a session. Expired tokens are rejected.
+func FetchUserIDByAPIToken(token string) (int, []string, error) {
+	var tokenID, userID int
+	var scopes string
+	var lastUsedAt sql.NullTime
+	now := time.Now().UTC()
+
+	err := db.QueryRow(`
+		SELECT id, user_id, scopes, last_used_at
+		FROM api_tokens
+		WHERE token_hash = ? AND (expires_at IS NULL OR expires_at > ?)`, hashToken(token), now).Scan(&tokenID, &userID, &scopes, &lastUsedAt)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if !lastUsedAt.Valid || now.Sub(lastUsedAt.Time) >= apiTokenTouchInterval {
+		if _, err := db.Exec("UPDATE api_tokens SET last_used_at = ? WHERE id = ?", now, tokenID); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	return userID, strings.Fields(scopes), nil
+}
+
+// FetchUserAPITokens lists the personal access tokens of a user, newest first
+func FetchUserAPITokens(userID int) ([]models.APIToken, error) {
+	rows, err := db.Query(`
+		SELECT id, name, scopes, created_at, last_used_at, expires_at
+		FROM api_tokens
+		WHERE user_id = ?
+		ORDER BY created_at DESC, id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now().UTC()
+	var tokens []models.APIToken
+	for rows.Next() {
+		var token models.APIToken
+		var scopes string
+		var lastUsedAt, expiresAt sql.NullTime
+		if err := rows.Scan(&token.ID, &token.Name, &scopes, &token.CreatedAt, &lastUsedAt, &expiresAt); err != nil {
+			return nil, err
+		}
+		token.Scopes = strings.Fields(scopes)
+		token.FormatCreated = token.CreatedAt.Local().Format("02 Jan 2006, 15:04")
+		token.FormatLastUsed = "Never used"
+		if lastUsedAt.Valid {
+			token.FormatLastUsed = "Last used " + lastUsedAt.Time.Local().Format("02 Jan 2006, 15:04")
+		}
+		token.FormatExpires = "Never expires"
+		if expiresAt.Valid {
+			token.FormatExpires = "Expires " + expiresAt.Time.Local().Format("02 Jan 2006, 15:04")
+			token.Expired = !expiresAt.Time.After(now)
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// DeleteUserAPIToken revokes one token, only if it belongs to the given user
+func DeleteUserAPIToken(userID, tokenID int) error {
+	_, err := db.Exec("DELETE FROM api_tokens WHERE id = ? AND user_id = ?", tokenID, userID)
+	return err
+}
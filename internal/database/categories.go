@@ -0,0 +1,200 @@
+package root
+
+import (
+	"database/sql"
+	"errors"
+	"root/internal/models"
+	"time"
+)
+
+// GeneralCategorySlug is the category that collects posts filed under no other category.
+// It is the home feed itself, so it cannot be archived or deleted.
+const GeneralCategorySlug = "general"
+
+// ErrPostArchived is returned for comments and votes on a post filed only under archived categories
+var ErrPostArchived = errors.New("post is archived")
+
+// categoryColumns are the columns scanCategory reads, in order
+const categoryColumns = "id, name, slug, description, icon, color, sort_order, archived, COALESCE(parent_id, 0)"
+
+// subtreeCTE selects a category and every category nested under it as "subtree",
+// starting from the category ID bound to its one parameter. UNION stops at cycles.
+const subtreeCTE = `
+	WITH RECURSIVE subtree(id) AS (
+		SELECT ?
+		UNION
+		SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+	)`
+
+// scanner is a *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanCategory reads one row selected with categoryColumns
+func scanCategory(row scanner) (models.Category, error) {
+	var c models.Category
+	err := row.Scan(&c.ID, &c.Name, &c.Slug, &c.Description, &c.Icon, &c.Color, &c.SortOrder, &c.Archived, &c.ParentID)
+	return c, err
+}
+
+// checkPostOpen returns ErrPostArchived when every category the post is filed under is archived.
+// Posts without categories are open.
+func checkPostOpen(postID any) error {
+	var archived bool
+	err := db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM post_categories WHERE post_id = ?)
+		AND NOT EXISTS (
+			SELECT 1 FROM post_categories pc JOIN categories c ON c.id = pc.category_id
+			WHERE pc.post_id = ? AND c.archived = 0
+		)`, postID, postID).Scan(&archived)
+	if err != nil {
+		return err
+	}
+	if archived {
+		return ErrPostArchived
+	}
+	return nil
+}
+
+// FetchCategories lists every category, archived ones included, in their sort order
+func FetchCategories() ([]models.Category, error) {
+	rows, err := db.Query("SELECT " + categoryColumns + " FROM categories ORDER BY sort_order, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []models.Category
+	for rows.Next() {
+		category, err := scanCategory(rows)
+		if err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+	return categories, rows.Err()
+}
+
+// FetchCategory returns one category by ID, or sql.ErrNoRows
+func FetchCategory(categoryID int) (models.Category, error) {
+	return scanCategory(db.QueryRow("SELECT "+categoryColumns+" FROM categories WHERE id = ?", categoryID))
+}
+
+// FetchCategoryBySlug returns one category by slug, or sql.ErrNoRows
+func FetchCategoryBySlug(slug string) (models.Category, error) {
+	return scanCategory(db.QueryRow("SELECT "+categoryColumns+" FROM categories WHERE slug = ?", slug))
+}
+
+// CreateCategory adds a category and returns its ID
+func CreateCategory(c models.Category) (int, error) {
+	res, err := db.Exec(`
+		INSERT INTO categories (name, slug, description, icon, color, sort_order, archived, parent_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, 0))`,
+		c.Name, c.Slug, c.Description, c.Icon, c.Color, c.SortOrder, c.Archived, c.ParentID)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+// UpdateCategory saves the settings of an existing category
+func UpdateCategory(c models.Category) error {
+	res, err := db.Exec(`
+		UPDATE categories
+		SET name = ?, slug = ?, description = ?, icon = ?, color = ?, sort_order = ?, archived = ?, parent_id = NULLIF(?, 0)
+		WHERE id = ?`,
+		c.Name, c.Slug, c.Description, c.Icon, c.Color, c.SortOrder, c.Archived, c.ParentID, c.ID)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(res)
+}
+
+// DeleteCategory removes a category and its moderators. Its subcategories move up to its parent,
+// and of its posts the ones left without any category are refiled under the general category.
+func DeleteCategory(categoryID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT OR IGNORE INTO post_categories (post_id, category_id)
+		SELECT pc.post_id, g.id
+		FROM post_categories pc
+		JOIN categories g ON g.slug = ?
+		WHERE pc.category_id = ?
+			AND NOT EXISTS (
+				SELECT 1 FROM post_categories other
+				WHERE other.post_id = pc.post_id AND other.category_id <> pc.category_id
+			)`, GeneralCategorySlug, categoryID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE categories SET parent_id = (SELECT parent_id FROM categories WHERE id = ?)
+		WHERE parent_id = ?`, categoryID, categoryID)
+	if err != nil {
+		return err
+	}
+	for _, query := range []string{
+		"DELETE FROM post_categories WHERE category_id = ?",
+		"DELETE FROM category_moderators WHERE category_id = ?",
+	} {
+		if _, err := tx.Exec(query, categoryID); err != nil {
+			return err
+		}
+	}
+	res, err := tx.Exec("DELETE FROM categories WHERE id = ?", categoryID)
+	if err != nil {
+		return err
+	}
+	if err := expectOneRow(res); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CountCategoryPosts returns how many posts are filed directly under each category, by category ID
+func CountCategoryPosts() (map[int]int, error) {
+	rows, err := db.Query("SELECT category_id, COUNT(*) FROM post_categories GROUP BY category_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[int]int{}
+	for rows.Next() {
+		var categoryID, count int
+		if err := rows.Scan(&categoryID, &count); err != nil {
+			return nil, err
+		}
+		counts[categoryID] = count
+	}
+	return counts, rows.Err()
+}
+
+// FetchCategoryActivity returns how many posts are filed under a category or the categories
+// nested under it, and when the latest of those posts or their comments was written
+func FetchCategoryActivity(categoryID int) (int, time.Time, error) {
+	var count int
+	var last sql.NullInt64
+	err := db.QueryRow(subtreeCTE+`,
+		tagged AS (
+			SELECT DISTINCT post_id FROM post_categories WHERE category_id IN (SELECT id FROM subtree)
+		)
+		SELECT
+			(SELECT COUNT(*) FROM tagged),
+			(SELECT MAX(at) FROM (
+				SELECT CAST(strftime('%s', created_at) AS INTEGER) AS at FROM posts WHERE id IN tagged
+				UNION ALL
+				SELECT CAST(strftime('%s', created_at) AS INTEGER) FROM comments WHERE post_id IN tagged
+			))`, categoryID).Scan(&count, &last)
+	if err != nil || !last.Valid {
+		return count, time.Time{}, err
+	}
+	return count, time.Unix(last.Int64, 0).UTC(), nil
+}
@@ -0,0 +1,91 @@
+package root
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	// EmailVerificationLifetime is how long an email verification link stays valid
+	EmailVerificationLifetime = 24 * time.Hour
+	// EmailVerificationResendInterval is the minimum wait between two verification emails
+	EmailVerificationResendInterval = time.Minute
+)
+
+// CreateEmailVerification stores a verification token for the user's current email,
+// replacing any earlier one. It returns false without creating a token when the last
+// one was issued less than EmailVerificationResendInterval ago.
+func CreateEmailVerification(userID int, email, token string) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	var recent int
+	err = tx.QueryRow("SELECT COUNT(1) FROM email_verifications WHERE user_id = ? AND created_at > ?",
+		userID, now.Add(-EmailVerificationResendInterval)).Scan(&recent)
+	if err != nil {
+		return false, err
+	}
+	if recent > 0 {
+		return false, nil
+	}
+
+	if _, err := tx.Exec("DELETE FROM email_verifications WHERE user_id = ? OR expires_at <= ?", userID, now); err != nil {
+		return false, err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO email_verifications (token_hash, user_id, email, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		hashToken(token), userID, email, now, now.Add(EmailVerificationLifetime))
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// VerifyEmail consumes a verification token and marks the email it was sent to as verified.
+// A token sent to an address the user no longer has is rejected with sql.ErrNoRows.
+func VerifyEmail(token string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	var userID int
+	var email string
+	err = tx.QueryRow(`
+		DELETE FROM email_verifications
+		WHERE token_hash = ? AND expires_at > ?
+		RETURNING user_id, email`, hashToken(token), now).Scan(&userID, &email)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := tx.Exec("UPDATE users SET email_verified_at = COALESCE(email_verified_at, ?) WHERE id = ? AND email = ?", now, userID, email)
+	if err != nil {
+		return 0, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = sql.ErrNoRows
+		}
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
+
+// FetchUserEmail returns the user's email and whether it has been verified
+func FetchUserEmail(userID int) (string, bool, error) {
+	var email string
+	var verifiedAt sql.NullTime
+	err := db.QueryRow("SELECT email, email_verified_at FROM users WHERE id = ?", userID).Scan(&email, &verifiedAt)
+	if err != nil {
+		return "", false, err
+	}
+	return email, verifiedAt.Valid, nil
+}
@@ -0,0 +1,12 @@
+package root
+
+import "time"
+
+// RecordFailedLogin keeps an audit record of a rejected login attempt
+func RecordFailedLogin(username, ipAddress, userAgent, reason string) error {
+	_, err := db.Exec(`
+		INSERT INTO failed_logins (username, ip_address, user_agent, reason, attempted_at)
+		VALUES (?, ?, ?, ?, ?)`,
+		username, ipAddress, userAgent, reason, time.Now().UTC())
+	return err
+}
@@ -0,0 +1,204 @@
+package root
+
+import (
+	"database/sql"
+	"root/internal/models"
+	"strings"
+)
+
+// postColumns selects a post with its author, vote counts, comment count and the viewer's vote,
+// from posts p joined with users u. Its one parameter is the viewer's user ID. Queries follow it
+// with the value of their sort key, which the post's page cursor is made from.
+const postColumns = `
+	p.id, p.user_id, u.username, u.profile_color, p.content, p.created_at,
+	(SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = p.id AND r.is_like = 1),
+	(SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = p.id AND r.is_like = 0),
+	(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id),
+	(SELECT r.is_like FROM post_reactions r WHERE r.post_id = p.id AND r.user_id = ?)`
+
+// commentColumns selects a comment with its author, vote counts, the viewer's vote and the stored
+// created_at text its page cursor is made from, from comments c joined with users u.
+// Its one parameter is the viewer's user ID.
+const commentColumns = `
+	c.id, c.post_id, c.user_id, u.username, u.profile_color, c.content, c.created_at,
+	(SELECT COUNT(*) FROM comment_reactions r WHERE r.comment_id = c.id AND r.is_like = 1),
+	(SELECT COUNT(*) FROM comment_reactions r WHERE r.comment_id = c.id AND r.is_like = 0),
+	(SELECT r.is_like FROM comment_reactions r WHERE r.comment_id = c.id AND r.user_id = ?),
+	CAST(c.created_at AS TEXT)`
+
+// detailBatch bounds how many posts share one query for their media and comments,
+// keeping the number of bound parameters well below SQLite's limit
+const detailBatch = 500
+
+// FetchPost retrieves one post with the viewer's votes, or sql.ErrNoRows
+func FetchPost(postID, viewer int) (models.Post, error) {
+	posts, err := queryPosts(viewer, `
+		SELECT `+postColumns+`, `+createdKey.value+`
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.id = ?`, viewer, postID)
+	if err != nil {
+		return models.Post{}, err
+	}
+	if len(posts) == 0 {
+		return models.Post{}, sql.ErrNoRows
+	}
+	return posts[0], nil
+}
+
+// FetchPostSummary retrieves one post with its media and the viewer's votes but without its
+// comments, which FetchCommentsPage pages through, or sql.ErrNoRows
+func FetchPostSummary(postID, viewer int) (models.Post, error) {
+	posts, err := scanPosts(`
+		SELECT `+postColumns+`, `+createdKey.value+`
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.id = ?`, viewer, postID)
+	if err != nil {
+		return models.Post{}, err
+	}
+	if len(posts) == 0 {
+		return models.Post{}, sql.ErrNoRows
+	}
+	byID := map[int]*models.Post{postID: &posts[0]}
+	if err := attachMedia(byID, "(?)", []any{postID}); err != nil {
+		return models.Post{}, err
+	}
+	return posts[0], nil
+}
+
+// queryPosts runs a query selecting postColumns and a sort key, and loads the media and
+// comments of the posts it returns. However many posts there are, that takes one query plus two per detailBatch.
+func queryPosts(viewer int, query string, args ...any) ([]models.Post, error) {
+	posts, err := scanPosts(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	if err := attachPostDetails(posts, viewer); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// scanPosts runs a query selecting postColumns and a sort key, and reads the posts it returns
+func scanPosts(query string, args ...any) ([]models.Post, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []models.Post
+	for rows.Next() {
+		var post models.Post
+		var vote sql.NullBool
+		var key any
+		err := rows.Scan(&post.ID, &post.UserID, &post.Username, &post.ProfileColor, &post.Content, &post.CreatedAt,
+			&post.Likes, &post.Dislikes, &post.ComCount, &vote, &key)
+		if err != nil {
+			return nil, err
+		}
+		post.FormatDate = FormatDate(post.CreatedAt)
+		post.LikeIcon, post.DislikeIcon = voteIcons(vote)
+		post.Cursor = encodeCursor(key, post.ID)
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+// attachPostDetails fills in the media and comments of posts, detailBatch posts at a time
+func attachPostDetails(posts []models.Post, viewer int) error {
+	byID := make(map[int]*models.Post, len(posts))
+	for i := range posts {
+		byID[posts[i].ID] = &posts[i]
+	}
+
+	for start := 0; start < len(posts); start += detailBatch {
+		batch := posts[start:min(start+detailBatch, len(posts))]
+		ids := make([]any, len(batch))
+		for i, post := range batch {
+			ids[i] = post.ID
+		}
+		in := "(" + strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",") + ")"
+
+		if err := attachMedia(byID, in, ids); err != nil {
+			return err
+		}
+		if err := attachComments(byID, in, ids, viewer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attachMedia loads the media of the posts listed in the "IN (...)" clause in
+func attachMedia(byID map[int]*models.Post, in string, ids []any) error {
+	rows, err := db.Query("SELECT post_id, file_path, file_type FROM media WHERE post_id IN "+in+" ORDER BY id", ids...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var postID int
+		var media models.Media
+		if err := rows.Scan(&postID, &media.FilePath, &media.FileType); err != nil {
+			return err
+		}
+		post := byID[postID]
+		post.Media = append(post.Media, media)
+	}
+	return rows.Err()
+}
+
+// attachComments loads the comments of the posts listed in the "IN (...)" clause in, newest first
+func attachComments(byID map[int]*models.Post, in string, ids []any, viewer int) error {
+	rows, err := db.Query(`
+		SELECT `+commentColumns+`
+		FROM comments c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.post_id IN `+in+`
+		ORDER BY c.created_at DESC, c.id DESC`, append([]any{viewer}, ids...)...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return err
+		}
+		post := byID[comment.PostID]
+		post.Comment = append(post.Comment, comment)
+	}
+	return rows.Err()
+}
+
+// scanComment reads one row selected with commentColumns
+func scanComment(row scanner) (models.Comment, error) {
+	var comment models.Comment
+	var vote sql.NullBool
+	var createdAt string
+	err := row.Scan(&comment.ComID, &comment.PostID, &comment.ComUserID, &comment.ComUsername, &comment.ComProfile,
+		&comment.ComContent, &comment.ComCreatedAt, &comment.ComLikes, &comment.ComDislikes, &vote, &createdAt)
+	if err != nil {
+		return comment, err
+	}
+	comment.ComFormatDate = FormatDate(comment.ComCreatedAt)
+	comment.ComLikeIcon, comment.ComDislikeIcon = voteIcons(vote)
+	comment.ComCursor = encodeCursor(createdAt, comment.ComID)
+	return comment, nil
+}
+
+// voteIcons returns the boxicons suffix for the like and dislike buttons: "s" (solid) marks the viewer's vote
+func voteIcons(vote sql.NullBool) (string, string) {
+	switch {
+	case !vote.Valid:
+		return "", ""
+	case vote.Bool:
+		return "s", ""
+	default:
+		return "", "s"
+	}
+}
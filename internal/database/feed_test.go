@@ -0,0 +1,316 @@
+package root
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"root/internal/models"
+	"testing"
+	"time"
+)
+
+// benchmarkPosts is how many posts the feed benchmark's database is seeded with
+const benchmarkPosts = 10000
+
+// BenchmarkFeedPage times loading the first page of the feed in every sort order from a
+// scratch database seeded with benchmarkPosts posts, against the one-query-per-post loading
+// the feed used before, after checking both return the same posts. It needs the FTS5 driver:
+//
+//	go test -tags sqlite_fts5 -run '^$' -bench FeedPage ./internal/database
+func BenchmarkFeedPage(b *testing.B) {
+	openSeededDB(b, benchmarkPosts)
+	const viewer = 1
+
+	page, err := FetchFeedPage(viewer, Sort{}, PageRequest{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	perPost, err := fetchPostsOneByOne(viewer, PageSize)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := sameFeed(page.Posts, perPost); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, mode := range SortModes {
+		b.Run(mode, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := FetchFeedPage(viewer, Sort{Mode: mode}, PageRequest{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+	b.Run("per post", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := fetchPostsOneByOne(viewer, PageSize); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// openSeededDB points the package at a migrated scratch database in a temporary directory,
+// seeded with posts posts. The migrations are read relative to the repository root.
+func openSeededDB(b *testing.B, posts int) {
+	b.Helper()
+	if !FullTextSearch {
+		b.Skip("the feed benchmark needs the FTS5 driver; run it with -tags sqlite_fts5")
+	}
+	path := filepath.Join(b.TempDir(), "forum.db")
+	wd, err := os.Getwd()
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := os.Chdir("../.."); err != nil {
+		b.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	previous := db
+	OpenFile(path)
+	b.Cleanup(func() {
+		db.Close()
+		db = previous
+	})
+	if _, err := MigrateUp(false, io.Discard); err != nil {
+		b.Fatal(err)
+	}
+	if err := seedFeed(posts); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// seedFeed fills a freshly migrated database with users, posts, comments, votes and media
+// shaped roughly like a busy forum
+func seedFeed(posts int) error {
+	const users = 200
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var categoryIDs []int
+	rows, err := tx.Query("SELECT id FROM categories")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		categoryIDs = append(categoryIDs, id)
+	}
+	rows.Close()
+	if len(categoryIDs) == 0 {
+		return fmt.Errorf("the database has no categories to file posts under")
+	}
+
+	userStmt, err := tx.Prepare("INSERT INTO users (id, email, username, password_hash, profile_color) VALUES (?, ?, ?, '', '#8683dc')")
+	if err != nil {
+		return err
+	}
+	postStmt, err := tx.Prepare("INSERT INTO posts (id, user_id, content, created_at) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	categoryStmt, err := tx.Prepare("INSERT INTO post_categories (post_id, category_id) VALUES (?, ?)")
+	if err != nil {
+		return err
+	}
+	mediaStmt, err := tx.Prepare("INSERT INTO media (post_id, file_path, file_type) VALUES (?, 'assets/uploads/bench.png', 'image')")
+	if err != nil {
+		return err
+	}
+	commentStmt, err := tx.Prepare("INSERT INTO comments (id, post_id, user_id, content, created_at) VALUES (?, ?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	postVoteStmt, err := tx.Prepare("INSERT OR IGNORE INTO post_reactions (post_id, user_id, is_like, created_at) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	commentVoteStmt, err := tx.Prepare("INSERT OR IGNORE INTO comment_reactions (comment_id, user_id, is_like, created_at) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+
+	for id := 1; id <= users; id++ {
+		if _, err := userStmt.Exec(id, fmt.Sprintf("bench%d@example.com", id), fmt.Sprintf("bench%d", id)); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now().UTC()
+	commentID := 0
+	for postID := 1; postID <= posts; postID++ {
+		created := now.Add(-time.Duration(posts-postID) * 37 * time.Minute)
+		if _, err := postStmt.Exec(postID, 1+rng.IntN(users), fmt.Sprintf("Benchmark post %d", postID), created); err != nil {
+			return err
+		}
+		if _, err := categoryStmt.Exec(postID, categoryIDs[rng.IntN(len(categoryIDs))]); err != nil {
+			return err
+		}
+		if rng.IntN(10) == 0 {
+			if _, err := mediaStmt.Exec(postID); err != nil {
+				return err
+			}
+		}
+		for v := rng.IntN(10); v > 0; v-- {
+			if _, err := postVoteStmt.Exec(postID, 1+rng.IntN(users), rng.IntN(4) > 0, created); err != nil {
+				return err
+			}
+		}
+		for c := rng.IntN(7); c > 0; c-- {
+			commentID++
+			commented := created.Add(time.Duration(c) * time.Minute)
+			if _, err := commentStmt.Exec(commentID, postID, 1+rng.IntN(users), "Benchmark comment", commented); err != nil {
+				return err
+			}
+			for v := rng.IntN(3); v > 0; v-- {
+				if _, err := commentVoteStmt.Exec(commentID, 1+rng.IntN(users), rng.IntN(3) > 0, commented); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if err := refreshScores(tx, "1 = 1"); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// sameFeed reports the first difference between two loads of the feed
+func sameFeed(a, b []models.Post) error {
+	if len(a) != len(b) {
+		return fmt.Errorf("%d posts against %d", len(a), len(b))
+	}
+	for i := range a {
+		x, y := a[i], b[i]
+		if x.ID != y.ID || x.Likes != y.Likes || x.Dislikes != y.Dislikes || x.ComCount != y.ComCount ||
+			x.LikeIcon != y.LikeIcon || x.DislikeIcon != y.DislikeIcon || x.ProfileColor != y.ProfileColor ||
+			len(x.Media) != len(y.Media) || len(x.Comment) != len(y.Comment) {
+			return fmt.Errorf("post %d differs", x.ID)
+		}
+		for j := range x.Comment {
+			if x.Comment[j].ComID != y.Comment[j].ComID || x.Comment[j].ComLikes != y.Comment[j].ComLikes ||
+				x.Comment[j].ComLikeIcon != y.Comment[j].ComLikeIcon || x.Comment[j].ComDislikeIcon != y.Comment[j].ComDislikeIcon {
+				return fmt.Errorf("comment %d differs", x.Comment[j].ComID)
+			}
+		}
+	}
+	return nil
+}
+
+// fetchPostsOneByOne loads the feed the way it was loaded before queryPosts: one query for the
+// posts, then media, comments, comment count, author color and vote icons post by post, and the
+// author, color and vote icons comment by comment. It is kept only as the benchmark's baseline.
+func fetchPostsOneByOne(viewer, limit int) ([]models.Post, error) {
+	rows, err := db.Query(`
+		SELECT p.id, p.user_id, u.username, p.content, p.created_at,
+			COUNT(CASE WHEN l.is_like = 1 THEN 1 END),
+			COUNT(CASE WHEN l.is_like = 0 THEN 1 END)
+		FROM posts p
+		JOIN users u ON p.user_id = u.id
+		LEFT JOIN post_reactions l ON p.id = l.post_id
+		GROUP BY p.id
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	var posts []models.Post
+	for rows.Next() {
+		var post models.Post
+		if err := rows.Scan(&post.ID, &post.UserID, &post.Username, &post.Content, &post.CreatedAt, &post.Likes, &post.Dislikes); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	vote := func(query string, targetID int) (string, string) {
+		var isLike sql.NullBool
+		err := db.QueryRow(query, targetID, viewer).Scan(&isLike)
+		if err != nil && err != sql.ErrNoRows {
+			return "", ""
+		}
+		return voteIcons(isLike)
+	}
+	for i := range posts {
+		post := &posts[i]
+		post.FormatDate = FormatDate(post.CreatedAt)
+
+		media, err := db.Query("SELECT file_path, file_type FROM media WHERE post_id = ? ORDER BY id", post.ID)
+		if err != nil {
+			return nil, err
+		}
+		for media.Next() {
+			var m models.Media
+			if err := media.Scan(&m.FilePath, &m.FileType); err != nil {
+				media.Close()
+				return nil, err
+			}
+			post.Media = append(post.Media, m)
+		}
+		media.Close()
+
+		comments, err := db.Query(`
+			SELECT c.id, c.user_id, c.content, c.created_at,
+				COUNT(CASE WHEN l.is_like = 1 THEN 1 END),
+				COUNT(CASE WHEN l.is_like = 0 THEN 1 END)
+			FROM comments c
+			LEFT JOIN comment_reactions l ON c.id = l.comment_id
+			WHERE c.post_id = ?
+			GROUP BY c.id
+			ORDER BY c.created_at DESC, c.id DESC`, post.ID)
+		if err != nil {
+			return nil, err
+		}
+		for comments.Next() {
+			var c models.Comment
+			if err := comments.Scan(&c.ComID, &c.ComUserID, &c.ComContent, &c.ComCreatedAt, &c.ComLikes, &c.ComDislikes); err != nil {
+				comments.Close()
+				return nil, err
+			}
+			post.Comment = append(post.Comment, c)
+		}
+		comments.Close()
+		for j := range post.Comment {
+			c := &post.Comment[j]
+			c.PostID = post.ID
+			c.ComFormatDate = FormatDate(c.ComCreatedAt)
+			if c.ComUsername, err = FetchUsernameByUserID(c.ComUserID); err != nil {
+				return nil, err
+			}
+			if err := db.QueryRow("SELECT profile_color FROM users WHERE id = ?", c.ComUserID).Scan(&c.ComProfile); err != nil {
+				return nil, err
+			}
+			c.ComLikeIcon, _ = vote("SELECT is_like FROM comment_reactions WHERE comment_id = ? AND user_id = ?", c.ComID)
+			_, c.ComDislikeIcon = vote("SELECT is_like FROM comment_reactions WHERE comment_id = ? AND user_id = ?", c.ComID)
+		}
+
+		if err := db.QueryRow("SELECT COUNT(*) FROM comments WHERE post_id = ?", post.ID).Scan(&post.ComCount); err != nil {
+			return nil, err
+		}
+		if err := db.QueryRow("SELECT profile_color FROM users WHERE id = ?", post.UserID).Scan(&post.ProfileColor); err != nil {
+			return nil, err
+		}
+		post.LikeIcon, _ = vote("SELECT is_like FROM post_reactions WHERE post_id = ? AND user_id = ?", post.ID)
+		_, post.DislikeIcon = vote("SELECT is_like FROM post_reactions WHERE post_id = ? AND user_id = ?", post.ID)
+	}
+	return posts, nil
+}
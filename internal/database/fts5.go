@@ -0,0 +1,7 @@
+//go:build sqlite_fts5
+
+package root
+
+// FullTextSearch reports whether the SQLite driver was built with FTS5, which search and its
+// migration need. The driver only compiles it in with the sqlite_fts5 build tag.
+const FullTextSearch = true
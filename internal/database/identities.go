@@ -0,0 +1,153 @@
+package root
+
+import (
+	"database/sql"
+	"errors"
+	"root/internal/models"
+	"time"
+)
+
+// PendingSignupLifetime bounds how long a first-time OAuth user has to pick a username
+const PendingSignupLifetime = 15 * time.Minute
+
+// ErrIdentityTaken is returned when a provider account is already linked to another user
+var ErrIdentityTaken = errors.New("identity is linked to another account")
+
+// FetchUserIDByIdentity returns the user linked to a provider account
+func FetchUserIDByIdentity(provider, subject string) (int, error) {
+	var userID int
+	err := db.QueryRow("SELECT user_id FROM identities WHERE provider = ? AND subject = ?", provider, subject).Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// LinkIdentity links a provider account to a user. Linking the same account twice is a no-op.
+func LinkIdentity(userID int, provider, subject, email string) error {
+	ownerID, err := FetchUserIDByIdentity(provider, subject)
+	if err == nil {
+		if ownerID != userID {
+			return ErrIdentityTaken
+		}
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	_, err = db.Exec("INSERT INTO identities (user_id, provider, subject, email) VALUES (?, ?, ?, ?)", userID, provider, subject, email)
+	return err
+}
+
+// UnlinkIdentity removes the link between a user and a provider
+func UnlinkIdentity(userID int, provider string) error {
+	_, err := db.Exec("DELETE FROM identities WHERE user_id = ? AND provider = ?", userID, provider)
+	return err
+}
+
+// FetchUserIdentities lists the providers linked to a user
+func FetchUserIdentities(userID int) ([]models.Identity, error) {
+	rows, err := db.Query("SELECT provider, email, created_at FROM identities WHERE user_id = ? ORDER BY provider", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []models.Identity
+	for rows.Next() {
+		var identity models.Identity
+		var createdAt time.Time
+		if err := rows.Scan(&identity.Provider, &identity.Email, &createdAt); err != nil {
+			return nil, err
+		}
+		identity.Linked = true
+		identity.FormatCreatedAt = FormatDate(createdAt)
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+// UserHasPassword reports whether the user can sign in with a password
+func UserHasPassword(userID int) (bool, error) {
+	var passwordHash string
+	err := db.QueryRow("SELECT password_hash FROM users WHERE id = ?", userID).Scan(&passwordHash)
+	if err != nil {
+		return false, err
+	}
+	return passwordHash != "", nil
+}
+
+// AdoptLegacyOAuthUser links a provider account to a user created by the old email-matched
+// OAuth login (no password and no identities yet). It returns 0 when there is no such user.
+func AdoptLegacyOAuthUser(provider, subject, email string) (int, error) {
+	var userID int
+	err := db.QueryRow(`
+		SELECT u.id FROM users u
+		WHERE u.email = ? AND u.password_hash = ''
+		AND NOT EXISTS (SELECT 1 FROM identities i WHERE i.user_id = u.id)`, email).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := LinkIdentity(userID, provider, subject, email); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// CreateOAuthUser creates a password-less account and links the provider account to it.
+// A non-empty inviteCode is redeemed in the same transaction.
+func CreateOAuthUser(email, username, provider, subject, inviteCode string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Providers only hand us verified emails, so the address counts as verified
+	userID, err := insertUser(tx, email, username, "", inviteCode, sql.NullTime{Time: time.Now().UTC(), Valid: true})
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec("INSERT INTO identities (user_id, provider, subject, email) VALUES (?, ?, ?, ?)", userID, provider, subject, email)
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
+
+// SavePendingSignup stores a first-time OAuth login until the user has picked a username
+func SavePendingSignup(token string, signup models.PendingSignup) error {
+	now := time.Now().UTC()
+	if _, err := db.Exec("DELETE FROM pending_signups WHERE expires_at <= ?", now); err != nil {
+		return err
+	}
+	_, err := db.Exec(`
+		INSERT INTO pending_signups (token_hash, provider, subject, email, suggested_username, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		hashToken(token), signup.Provider, signup.Subject, signup.Email, signup.SuggestedUsername, now.Add(PendingSignupLifetime))
+	return err
+}
+
+// FetchPendingSignup returns the pending signup behind a token if it has not expired
+func FetchPendingSignup(token string) (models.PendingSignup, error) {
+	var signup models.PendingSignup
+	err := db.QueryRow(`
+		SELECT provider, subject, email, suggested_username
+		FROM pending_signups
+		WHERE token_hash = ? AND expires_at > ?`, hashToken(token), time.Now().UTC()).
+		Scan(&signup.Provider, &signup.Subject, &signup.Email, &signup.SuggestedUsername)
+	return signup, err
+}
+
+// DeletePendingSignup removes a pending signup once it has been completed
+func DeletePendingSignup(token string) error {
+	_, err := db.Exec("DELETE FROM pending_signups WHERE token_hash = ?", hashToken(token))
+	return err
+}
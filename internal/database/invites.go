@@ -0,0 +1,153 @@
+package root
+
+import (
+	"database/sql"
+	"errors"
+	"root/internal/models"
+	"strings"
+	"time"
+)
+
+// ErrInviteInvalid is returned when an invite code is unknown, used up, expired or revoked
+var ErrInviteInvalid = errors.New("invite code is not valid")
+
+// NormalizeInviteCode puts an invite code in the form it is stored in, so a code pasted
+// with surrounding spaces or in another case still matches
+func NormalizeInviteCode(code string) string {
+	return strings.ToLower(strings.TrimSpace(code))
+}
+
+// CreateInvite stores a new invite code. A zero expiresAt means the invite never expires.
+func CreateInvite(createdBy int, code, note string, maxUses int, expiresAt time.Time) error {
+	code = NormalizeInviteCode(code)
+	var expires sql.NullTime
+	if !expiresAt.IsZero() {
+		expires = sql.NullTime{Time: expiresAt.UTC(), Valid: true}
+	}
+	_, err := db.Exec(`
+		INSERT INTO invites (code_hash, code_hint, created_by, note, max_uses, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		hashToken(code), code[:4], createdBy, note, maxUses, expires, time.Now().UTC())
+	return err
+}
+
+// ValidInvite reports whether an invite code can still be redeemed, without using it
+func ValidInvite(code string) (bool, error) {
+	var id int
+	err := db.QueryRow(`
+		SELECT id FROM invites
+		WHERE code_hash = ? AND uses < max_uses AND revoked_at IS NULL
+		AND (expires_at IS NULL OR expires_at > ?)`, hashToken(NormalizeInviteCode(code)), time.Now().UTC()).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// redeemInvite uses up one redemption of an invite code and returns the invite and its creator.
+// It runs inside the transaction that creates the account, so a failed signup gives the use back.
+func redeemInvite(tx *sql.Tx, code string) (int, int, error) {
+	var inviteID, inviterID int
+	err := tx.QueryRow(`
+		UPDATE invites SET uses = uses + 1
+		WHERE code_hash = ? AND uses < max_uses AND revoked_at IS NULL
+		AND (expires_at IS NULL OR expires_at > ?)
+		RETURNING id, created_by`, hashToken(NormalizeInviteCode(code)), time.Now().UTC()).Scan(&inviteID, &inviterID)
+	if err == sql.ErrNoRows {
+		return 0, 0, ErrInviteInvalid
+	}
+	return inviteID, inviterID, err
+}
+
+// insertUser creates an account inside tx, redeeming inviteCode first when one is given
+func insertUser(tx *sql.Tx, email, username, passwordHash, inviteCode string, emailVerifiedAt sql.NullTime) (int, error) {
+	var invitedBy, inviteID sql.NullInt64
+	if inviteCode != "" {
+		id, inviter, err := redeemInvite(tx, inviteCode)
+		if err != nil {
+			return 0, err
+		}
+		inviteID = sql.NullInt64{Int64: int64(id), Valid: true}
+		invitedBy = sql.NullInt64{Int64: int64(inviter), Valid: true}
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO users (email, username, password_hash, email_verified_at, invited_by, invite_id)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		email, username, passwordHash, emailVerifiedAt, invitedBy, inviteID)
+	if err != nil {
+		return 0, err
+	}
+	userID, err := res.LastInsertId()
+	return int(userID), err
+}
+
+// FetchInvites lists every invite, newest first, with the users who joined through it
+func FetchInvites() ([]models.Invite, error) {
+	rows, err := db.Query(`
+		SELECT i.id, i.code_hint, i.note, u.username, i.max_uses, i.uses, i.expires_at, i.revoked_at IS NOT NULL, i.created_at
+		FROM invites i
+		JOIN users u ON u.id = i.created_by
+		ORDER BY i.created_at DESC, i.id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now().UTC()
+	var invites []models.Invite
+	byID := map[int]int{}
+	for rows.Next() {
+		var invite models.Invite
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&invite.ID, &invite.CodeHint, &invite.Note, &invite.CreatedBy, &invite.MaxUses, &invite.Uses, &expiresAt, &invite.Revoked, &invite.CreatedAt); err != nil {
+			return nil, err
+		}
+		invite.FormatCreated = invite.CreatedAt.Local().Format("02 Jan 2006, 15:04")
+		invite.FormatExpires = "Never"
+		if expiresAt.Valid {
+			invite.ExpiresAt = expiresAt.Time
+			invite.FormatExpires = expiresAt.Time.Local().Format("02 Jan 2006, 15:04")
+		}
+
+		switch {
+		case invite.Revoked:
+			invite.Status = "Revoked"
+		case invite.Uses >= invite.MaxUses:
+			invite.Status = "Used up"
+		case expiresAt.Valid && !expiresAt.Time.After(now):
+			invite.Status = "Expired"
+		default:
+			invite.Status = "Active"
+		}
+
+		byID[invite.ID] = len(invites)
+		invites = append(invites, invite)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	invitees, err := db.Query("SELECT invite_id, username FROM users WHERE invite_id IS NOT NULL ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer invitees.Close()
+	for invitees.Next() {
+		var inviteID int
+		var username string
+		if err := invitees.Scan(&inviteID, &username); err != nil {
+			return nil, err
+		}
+		if i, ok := byID[inviteID]; ok {
+			invites[i].Invitees = append(invites[i].Invitees, username)
+		}
+	}
+	return invites, invitees.Err()
+}
+
+// RevokeInvite stops an invite from being redeemed again
+func RevokeInvite(inviteID int) error {
+	_, err := db.Exec("UPDATE invites SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", time.Now().UTC(), inviteID)
+	return err
+}
@@ -0,0 +1,115 @@
+package root
+
+import (
+	"fmt"
+	"io"
+	"root/internal/migrate"
+	"strings"
+)
+
+// MigrateUp applies every pending migration, oldest first, and returns how many there were.
+// With dryRun nothing is changed; the migrations that would run are written to out with their SQL.
+func MigrateUp(dryRun bool, out io.Writer) (int, error) {
+	migrations, err := migrate.Load(migrationsDir)
+	if err != nil {
+		return 0, err
+	}
+	pending, err := migrate.Pending(db, migrations)
+	if err != nil {
+		return 0, err
+	}
+
+	legacy, err := isLegacyDatabase()
+	if err != nil {
+		return 0, err
+	}
+
+	if dryRun {
+		if legacy {
+			fmt.Fprintln(out, "would add the columns this database is missing from before migrations existed")
+		}
+		for _, m := range pending {
+			fmt.Fprintf(out, "would apply %s:\n%s\n", m.ID(), indentSQL(m.Up))
+		}
+		if len(pending) == 0 {
+			fmt.Fprintln(out, "no pending migrations")
+		}
+		return len(pending), nil
+	}
+
+	if legacy {
+		if err := upgradeLegacyColumns(db); err != nil {
+			return 0, err
+		}
+	}
+	for _, m := range pending {
+		if err := migrate.Apply(db, m); err != nil {
+			return 0, err
+		}
+		fmt.Fprintf(out, "applied %s\n", m.ID())
+	}
+	return len(pending), nil
+}
+
+// MigrateDown rolls back the latest steps applied migrations, newest first.
+// With dryRun nothing is changed; the migrations that would be rolled back are written to out with their SQL.
+func MigrateDown(steps int, dryRun bool, out io.Writer) error {
+	migrations, err := migrate.Load(migrationsDir)
+	if err != nil {
+		return err
+	}
+	applied, err := migrate.Applied(db, migrations)
+	if err != nil {
+		return err
+	}
+	if steps < len(applied) {
+		applied = applied[:steps]
+	}
+	if len(applied) == 0 {
+		fmt.Fprintln(out, "no migrations to roll back")
+		return nil
+	}
+
+	for _, m := range applied {
+		if m.Down == "" {
+			return fmt.Errorf("%s has no down script, nothing was rolled back", m.ID())
+		}
+	}
+	for _, m := range applied {
+		if dryRun {
+			fmt.Fprintf(out, "would roll back %s:\n%s\n", m.ID(), indentSQL(m.Down))
+			continue
+		}
+		if err := migrate.Revert(db, m); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "rolled back %s\n", m.ID())
+	}
+	return nil
+}
+
+// MigrationStatus lists every migration with its state, plus applied migrations whose file is gone
+func MigrationStatus() ([]migrate.State, []string, error) {
+	migrations, err := migrate.Load(migrationsDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	return migrate.Status(db, migrations)
+}
+
+// isLegacyDatabase reports whether the database was created from tables.sql before migrations existed
+func isLegacyDatabase() (bool, error) {
+	initialized, err := migrate.Initialized(db)
+	if err != nil || initialized {
+		return false, err
+	}
+	var n int
+	err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'users'").Scan(&n)
+	return n > 0, err
+}
+
+// indentSQL indents a script for dry-run output
+func indentSQL(script string) string {
+	lines := strings.Split(strings.TrimSpace(script), "\n")
+	return "    " + strings.Join(lines, "\n    ")
+}
@@ -0,0 +1,20 @@
+DROP TABLE IF EXISTS media;
+DROP TABLE IF EXISTS likes;
+DROP TABLE IF EXISTS category_moderators;
+DROP TABLE IF EXISTS post_categories;
+DROP TABLE IF EXISTS categories;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS posts;
+DROP TABLE IF EXISTS invites;
+DROP TABLE IF EXISTS api_tokens;
+DROP TABLE IF EXISTS password_resets;
+DROP TABLE IF EXISTS failed_logins;
+DROP TABLE IF EXISTS login_challenges;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS totp_secrets;
+DROP TABLE IF EXISTS email_verifications;
+DROP TABLE IF EXISTS pending_signups;
+DROP TABLE IF EXISTS identities;
+DROP TABLE IF EXISTS oauth_states;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,21 @@
+CREATE TABLE likes (
+    user_id INTEGER NOT NULL,
+    post_id INTEGER NOT NULL,
+    comment_id INTEGER,
+    is_like BOOLEAN NOT NULL,
+    PRIMARY KEY (comment_id,user_id),
+    FOREIGN KEY (user_id) REFERENCES users (id),
+    FOREIGN KEY (post_id) REFERENCES posts (id),
+    FOREIGN KEY (comment_id) REFERENCES comments (id)
+);
+
+INSERT INTO likes (user_id, post_id, comment_id, is_like)
+SELECT user_id, post_id, NULL, is_like FROM post_reactions;
+
+INSERT INTO likes (user_id, post_id, comment_id, is_like)
+SELECT r.user_id, c.post_id, r.comment_id, r.is_like
+FROM comment_reactions r
+JOIN comments c ON c.id = r.comment_id;
+
+DROP TABLE comment_reactions;
+DROP TABLE post_reactions;
@@ -0,0 +1,50 @@
+-- likes had PRIMARY KEY (comment_id, user_id), and comment_id is NULL for post votes,
+-- so nothing stopped a user from voting on the same post many times. Post and comment
+-- votes now live in their own tables, keyed by what was voted on and who voted.
+
+CREATE TABLE post_reactions (
+    post_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    is_like BOOLEAN NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (post_id, user_id),
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_post_reactions_user_id ON post_reactions (user_id);
+
+CREATE TABLE comment_reactions (
+    comment_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    is_like BOOLEAN NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (comment_id, user_id),
+    FOREIGN KEY (comment_id) REFERENCES comments (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_comment_reactions_user_id ON comment_reactions (user_id);
+
+-- Keep only the latest vote of each user on each post or comment, and drop votes
+-- on posts and comments that no longer exist
+INSERT INTO post_reactions (post_id, user_id, is_like)
+SELECT l.post_id, l.user_id, l.is_like
+FROM likes l
+JOIN posts p ON p.id = l.post_id
+WHERE l.comment_id IS NULL
+AND l.rowid = (
+    SELECT MAX(rowid) FROM likes
+    WHERE comment_id IS NULL AND post_id = l.post_id AND user_id = l.user_id
+);
+
+INSERT INTO comment_reactions (comment_id, user_id, is_like)
+SELECT l.comment_id, l.user_id, l.is_like
+FROM likes l
+JOIN comments c ON c.id = l.comment_id
+WHERE l.rowid = (
+    SELECT MAX(rowid) FROM likes
+    WHERE comment_id = l.comment_id AND user_id = l.user_id
+);
+
+DROP TABLE likes;
@@ -0,0 +1,3 @@
+DROP INDEX idx_categories_slug;
+ALTER TABLE categories DROP COLUMN icon;
+ALTER TABLE categories DROP COLUMN slug;
@@ -0,0 +1,15 @@
+-- Categories carry what the templates need to list them, so adding one is a data change
+ALTER TABLE categories ADD COLUMN slug TEXT;
+ALTER TABLE categories ADD COLUMN icon TEXT NOT NULL DEFAULT 'bx-category';
+
+UPDATE categories SET slug = 'general' WHERE name = 'Gnrl';
+UPDATE categories SET slug = lower(name) WHERE slug IS NULL;
+
+UPDATE categories SET icon = 'bx-laugh' WHERE name = 'Memes';
+UPDATE categories SET icon = 'bx-joystick' WHERE name = 'Gaming';
+UPDATE categories SET icon = 'bx-book-alt' WHERE name = 'Education';
+UPDATE categories SET icon = 'bx-microchip' WHERE name = 'Technology';
+UPDATE categories SET icon = 'bxs-flask' WHERE name = 'Science';
+UPDATE categories SET icon = 'bx-basketball' WHERE name = 'Sports';
+
+CREATE UNIQUE INDEX idx_categories_slug ON categories (slug);
@@ -0,0 +1,4 @@
+ALTER TABLE categories DROP COLUMN archived;
+ALTER TABLE categories DROP COLUMN sort_order;
+ALTER TABLE categories DROP COLUMN color;
+ALTER TABLE categories DROP COLUMN description;
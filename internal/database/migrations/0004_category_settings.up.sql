@@ -0,0 +1,8 @@
+-- Admins manage categories from /admin/categories; these are the settings they can change
+ALTER TABLE categories ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE categories ADD COLUMN color TEXT NOT NULL DEFAULT '';
+ALTER TABLE categories ADD COLUMN sort_order INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE categories ADD COLUMN archived BOOLEAN NOT NULL DEFAULT 0;
+
+-- Keep the order the navigation bar had when it was hard-coded
+UPDATE categories SET sort_order = id;
@@ -0,0 +1,2 @@
+DROP INDEX idx_categories_parent;
+ALTER TABLE categories DROP COLUMN parent_id;
@@ -0,0 +1,5 @@
+-- Categories can nest; parent_id is NULL for top-level categories.
+-- There is no REFERENCES clause so the column can be dropped again, DeleteCategory reparents children instead.
+ALTER TABLE categories ADD COLUMN parent_id INTEGER;
+
+CREATE INDEX idx_categories_parent ON categories (parent_id);
@@ -0,0 +1,5 @@
+DROP INDEX idx_post_categories_category_id;
+DROP INDEX idx_media_post_id;
+DROP INDEX idx_comments_post_id;
+DROP INDEX idx_posts_user_id;
+DROP INDEX idx_posts_created_at;
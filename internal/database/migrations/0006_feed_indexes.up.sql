@@ -0,0 +1,6 @@
+-- Indexes for loading the feed a page at a time instead of one post at a time
+CREATE INDEX idx_posts_created_at ON posts (created_at, id);
+CREATE INDEX idx_posts_user_id ON posts (user_id, created_at);
+CREATE INDEX idx_comments_post_id ON comments (post_id, created_at);
+CREATE INDEX idx_media_post_id ON media (post_id);
+CREATE INDEX idx_post_categories_category_id ON post_categories (category_id, post_id);
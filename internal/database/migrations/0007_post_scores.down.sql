@@ -0,0 +1,6 @@
+DROP INDEX idx_posts_controversy;
+DROP INDEX idx_posts_hot;
+DROP INDEX idx_posts_score;
+ALTER TABLE posts DROP COLUMN controversy;
+ALTER TABLE posts DROP COLUMN hot;
+ALTER TABLE posts DROP COLUMN score;
@@ -0,0 +1,22 @@
+-- Scores the feed and category pages can sort posts by, kept up to date on every vote
+-- so that sorting by them is an index scan: net votes, a hot score that favours new posts,
+-- and a controversy score. hot_score and controversy_score are registered by the driver.
+ALTER TABLE posts ADD COLUMN score INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE posts ADD COLUMN hot REAL NOT NULL DEFAULT 0;
+ALTER TABLE posts ADD COLUMN controversy REAL NOT NULL DEFAULT 0;
+
+UPDATE posts SET
+    score = v.likes - v.dislikes,
+    hot = hot_score(v.likes, v.dislikes, CAST(strftime('%s', posts.created_at) AS INTEGER)),
+    controversy = controversy_score(v.likes, v.dislikes)
+FROM (
+    SELECT p.id,
+        (SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = p.id AND r.is_like = 1) AS likes,
+        (SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = p.id AND r.is_like = 0) AS dislikes
+    FROM posts p
+) v
+WHERE posts.id = v.id;
+
+CREATE INDEX idx_posts_score ON posts (score, id);
+CREATE INDEX idx_posts_hot ON posts (hot, id);
+CREATE INDEX idx_posts_controversy ON posts (controversy, id);
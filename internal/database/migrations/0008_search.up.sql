@@ -0,0 +1,46 @@
+-- Full-text indexes of post and comment text for search. They are external-content tables,
+-- so the text itself stays in posts and comments, and these triggers keep them in step.
+-- FTS5 is only compiled into the SQLite driver with the sqlite_fts5 build tag.
+CREATE VIRTUAL TABLE posts_fts USING fts5 (
+    content,
+    content = 'posts',
+    content_rowid = 'id',
+    tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE VIRTUAL TABLE comments_fts USING fts5 (
+    content,
+    content = 'comments',
+    content_rowid = 'id',
+    tokenize = 'unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER posts_fts_insert AFTER INSERT ON posts BEGIN
+    INSERT INTO posts_fts (rowid, content) VALUES (new.id, new.content);
+END;
+
+CREATE TRIGGER posts_fts_delete AFTER DELETE ON posts BEGIN
+    INSERT INTO posts_fts (posts_fts, rowid, content) VALUES ('delete', old.id, old.content);
+END;
+
+CREATE TRIGGER posts_fts_update AFTER UPDATE OF content ON posts BEGIN
+    INSERT INTO posts_fts (posts_fts, rowid, content) VALUES ('delete', old.id, old.content);
+    INSERT INTO posts_fts (rowid, content) VALUES (new.id, new.content);
+END;
+
+CREATE TRIGGER comments_fts_insert AFTER INSERT ON comments BEGIN
+    INSERT INTO comments_fts (rowid, content) VALUES (new.id, new.content);
+END;
+
+CREATE TRIGGER comments_fts_delete AFTER DELETE ON comments BEGIN
+    INSERT INTO comments_fts (comments_fts, rowid, content) VALUES ('delete', old.id, old.content);
+END;
+
+CREATE TRIGGER comments_fts_update AFTER UPDATE OF content ON comments BEGIN
+    INSERT INTO comments_fts (comments_fts, rowid, content) VALUES ('delete', old.id, old.content);
+    INSERT INTO comments_fts (rowid, content) VALUES (new.id, new.content);
+END;
+
+-- Index what was written before search existed
+INSERT INTO posts_fts (posts_fts) VALUES ('rebuild');
+INSERT INTO comments_fts (comments_fts) VALUES ('rebuild');
@@ -0,0 +1,35 @@
+package root
+
+import (
+	"root/internal/models"
+	"time"
+)
+
+// OAuthStateLifetime bounds how long a user may take on the provider's consent screen
+const OAuthStateLifetime = 10 * time.Minute
+
+// SaveOAuthState remembers a pending OAuth login together with its PKCE verifier and nonce
+func SaveOAuthState(state string, pending models.OAuthState) error {
+	now := time.Now().UTC()
+	_, err := db.Exec(`
+		INSERT INTO oauth_states (state, provider, code_verifier, link_user_id, nonce, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		state, pending.Provider, pending.CodeVerifier, pending.LinkUserID, pending.Nonce, now, now.Add(OAuthStateLifetime))
+	return err
+}
+
+// ConsumeOAuthState deletes a pending OAuth login and returns it.
+// A state can only be consumed once, and expired states are never returned.
+func ConsumeOAuthState(state string) (models.OAuthState, error) {
+	var pending models.OAuthState
+	now := time.Now().UTC()
+	if _, err := db.Exec("DELETE FROM oauth_states WHERE expires_at <= ?", now); err != nil {
+		return pending, err
+	}
+
+	err := db.QueryRow(`
+		DELETE FROM oauth_states
+		WHERE state = ? AND expires_at > ?
+		RETURNING provider, code_verifier, link_user_id, nonce`, state, now).Scan(&pending.Provider, &pending.CodeVerifier, &pending.LinkUserID, &pending.Nonce)
+	return pending, err
+}
@@ -0,0 +1,291 @@
+package root
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"root/internal/models"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// PageSize is how many posts or comments a page shows
+const PageSize = 20
+
+// ErrBadCursor means a page cursor was not one this package handed out
+var ErrBadCursor = errors.New("malformed page cursor")
+
+// PageRequest picks a page of a list of posts or comments: the ones after the After cursor,
+// the ones before the Before cursor, or the first page when both are empty
+type PageRequest struct {
+	After  string
+	Before string
+}
+
+// postList is a list of posts to page through. Its query is
+// with + "SELECT " + postColumns + " " + from + " WHERE " + where; from must join posts p with users u.
+type postList struct {
+	with     string
+	withArgs []any
+	from     string
+	where    string
+	args     []any
+	sort     Sort
+}
+
+// Kinds of sort key a cursor holds
+const (
+	cursorText  = 's'
+	cursorInt   = 'i'
+	cursorFloat = 'f'
+)
+
+// sortKey is what a list pages by besides the row ID: the column it orders by, the
+// expression selecting the column's value for cursors and the kind of that value
+type sortKey struct {
+	column string
+	value  string
+	kind   byte
+}
+
+// createdKey orders posts newest first. The stored created_at text is what the cursor holds,
+// since it sorts exactly like the column does.
+var createdKey = sortKey{"p.created_at", "CAST(p.created_at AS TEXT)", cursorText}
+
+// FetchFeedPage retrieves a page of every post in the given order, with the viewer's votes
+func FetchFeedPage(viewer int, sort Sort, page PageRequest) (models.PostPage, error) {
+	return fetchPage(viewer, page, postList{
+		from:  "FROM posts p JOIN users u ON u.id = p.user_id",
+		where: "1 = 1",
+		sort:  sort,
+	})
+}
+
+// FetchCategoryPage retrieves a page of the posts filed under a category or any category
+// nested under it, in the given order
+func FetchCategoryPage(categoryID, viewer int, sort Sort, page PageRequest) (models.PostPage, error) {
+	return fetchPage(viewer, page, postList{
+		with:     subtreeCTE,
+		withArgs: []any{categoryID},
+		from:     "FROM posts p JOIN users u ON u.id = p.user_id",
+		where:    "p.id IN (SELECT post_id FROM post_categories WHERE category_id IN (SELECT id FROM subtree))",
+		sort:     sort,
+	})
+}
+
+// FetchCreatedPostsPage retrieves a page of the posts a user wrote
+func FetchCreatedPostsPage(userID int, page PageRequest) (models.PostPage, error) {
+	return fetchPage(userID, page, postList{
+		from:  "FROM posts p JOIN users u ON u.id = p.user_id",
+		where: "p.user_id = ?",
+		args:  []any{userID},
+	})
+}
+
+// FetchLikedPostsPage retrieves a page of the posts a user liked
+func FetchLikedPostsPage(userID int, page PageRequest) (models.PostPage, error) {
+	return fetchVotedPostsPage(userID, true, page)
+}
+
+// FetchDislikedPostsPage retrieves a page of the posts a user disliked
+func FetchDislikedPostsPage(userID int, page PageRequest) (models.PostPage, error) {
+	return fetchVotedPostsPage(userID, false, page)
+}
+
+// fetchVotedPostsPage retrieves a page of the posts a user liked or disliked
+func fetchVotedPostsPage(userID int, isLike bool, page PageRequest) (models.PostPage, error) {
+	return fetchPage(userID, page, postList{
+		from:  "FROM post_reactions mine JOIN posts p ON p.id = mine.post_id JOIN users u ON u.id = p.user_id",
+		where: "mine.user_id = ? AND mine.is_like = ?",
+		args:  []any{userID, isLike},
+	})
+}
+
+// FetchCommentsPage retrieves a page of the comments on a post, newest first, with the viewer's votes
+func FetchCommentsPage(postID, viewer int, page PageRequest) (models.CommentPage, error) {
+	keys, err := newKeyset(page, sortKey{"c.created_at", "", cursorText}, "c.id")
+	if err != nil {
+		return models.CommentPage{}, err
+	}
+	rows, err := db.Query(`
+		SELECT `+commentColumns+`
+		FROM comments c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.post_id = ?`+keys.seek+`
+		ORDER BY `+keys.order+`
+		LIMIT ?`, append(append([]any{viewer, postID}, keys.args...), PageSize+1)...)
+	if err != nil {
+		return models.CommentPage{}, err
+	}
+	defer rows.Close()
+
+	var comments []models.Comment
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return models.CommentPage{}, err
+		}
+		comments = append(comments, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return models.CommentPage{}, err
+	}
+
+	var result models.CommentPage
+	result.Comments, result.Next, result.Prev = pageOf(keys, comments, func(c models.Comment) string { return c.ComCursor })
+	return result, nil
+}
+
+// fetchPage loads one page of list
+func fetchPage(viewer int, page PageRequest, list postList) (models.PostPage, error) {
+	key, since := list.sort.key(time.Now().UTC())
+	keys, err := newKeyset(page, key, "p.id")
+	if err != nil {
+		return models.PostPage{}, err
+	}
+	where := list.where
+	args := append(append(append([]any{}, list.withArgs...), viewer), list.args...)
+	if !since.IsZero() {
+		where += " AND p.created_at >= ?"
+		args = append(args, since.Format(time.DateTime))
+	}
+	posts, err := queryPosts(viewer, list.with+`
+		SELECT `+postColumns+`, `+key.value+`
+		`+list.from+`
+		WHERE `+where+keys.seek+`
+		ORDER BY `+keys.order+`
+		LIMIT ?`, append(append(args, keys.args...), PageSize+1)...)
+	if err != nil {
+		return models.PostPage{}, err
+	}
+
+	var result models.PostPage
+	result.Posts, result.Next, result.Prev = pageOf(keys, posts, func(p models.Post) string { return p.Cursor })
+	return result, nil
+}
+
+// keyset is the part of a page query that depends on which page is asked for. Pages seek
+// straight to their cursor on the sort key and row ID rather than skipping rows, so later pages
+// cost as little as the first and rows added while someone reads are neither repeated nor skipped.
+type keyset struct {
+	// seek is " AND (p.created_at, p.id) < (?, ?)" or the like with its args, empty for the first page
+	seek  string
+	args  []any
+	order string
+	// backward pages towards the start of the list, fetching rows in reverse
+	backward bool
+	// fromCursor is set when the page starts at a cursor rather than at the start of the list
+	fromCursor bool
+}
+
+// newKeyset prepares the query of the page asked for, on a sort key and the row ID column.
+// The query fetches one row more than PageSize to learn whether there is another page.
+func newKeyset(page PageRequest, key sortKey, idColumn string) (keyset, error) {
+	if page.After != "" && page.Before != "" {
+		return keyset{}, ErrBadCursor
+	}
+	keys := keyset{backward: page.Before != ""}
+	direction, compare, cursor := "DESC", "<", page.After
+	if keys.backward {
+		direction, compare, cursor = "ASC", ">", page.Before
+	}
+	keys.order = key.column + " " + direction + ", " + idColumn + " " + direction
+	if cursor != "" {
+		value, id, err := decodeCursor(cursor, key.kind)
+		if err != nil {
+			return keyset{}, err
+		}
+		keys.seek = " AND (" + key.column + ", " + idColumn + ") " + compare + " (?, ?)"
+		keys.args = []any{value, id}
+		keys.fromCursor = true
+	}
+	return keys, nil
+}
+
+// pageOf drops the extra row fetched past a page and puts the rest in list order, returning
+// them with the cursors of the pages after and before them, empty where there is none
+func pageOf[T any](keys keyset, rows []T, cursor func(T) string) ([]T, string, string) {
+	more := len(rows) > PageSize
+	if more {
+		rows = rows[:PageSize]
+	}
+	if len(rows) == 0 {
+		return rows, "", ""
+	}
+	if keys.backward {
+		slices.Reverse(rows)
+	}
+
+	// Coming from a cursor means there were rows on its other side
+	var next, prev string
+	first, last := cursor(rows[0]), cursor(rows[len(rows)-1])
+	if keys.backward {
+		next = last
+		if more {
+			prev = first
+		}
+	} else {
+		if more {
+			next = last
+		}
+		if keys.fromCursor {
+			prev = first
+		}
+	}
+	return rows, next, prev
+}
+
+// encodeCursor makes the cursor of a row from the value of its sort key and its ID
+func encodeCursor(value any, id int) string {
+	var raw string
+	switch v := value.(type) {
+	case int64:
+		raw = string(cursorInt) + strconv.FormatInt(v, 10)
+	case float64:
+		raw = string(cursorFloat) + strconv.FormatFloat(v, 'g', -1, 64)
+	case []byte:
+		raw = string(cursorText) + string(v)
+	default:
+		raw = string(cursorText) + fmt.Sprint(v)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(raw + "|" + strconv.Itoa(id)))
+}
+
+// decodeCursor reads a cursor made by encodeCursor, which must hold a sort key of the given kind
+func decodeCursor(cursor string, kind byte) (any, int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, 0, ErrBadCursor
+	}
+	cut := bytes.LastIndexByte(raw, '|')
+	if cut < 1 || raw[0] != kind {
+		return nil, 0, ErrBadCursor
+	}
+	id, err := strconv.Atoi(string(raw[cut+1:]))
+	if err != nil || id < 1 {
+		return nil, 0, ErrBadCursor
+	}
+
+	text := string(raw[1:cut])
+	switch kind {
+	case cursorInt:
+		value, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, 0, ErrBadCursor
+		}
+		return value, id, nil
+	case cursorFloat:
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, 0, ErrBadCursor
+		}
+		return value, id, nil
+	default:
+		if text == "" {
+			return nil, 0, ErrBadCursor
+		}
+		return text, id, nil
+	}
+}
@@ -0,0 +1,68 @@
+package root
+
+import (
+	"time"
+)
+
+// PasswordResetLifetime is how long a password reset link stays valid
+const PasswordResetLifetime = time.Hour
+
+// CreatePasswordReset stores a reset token for the user, replacing any earlier one
+func CreatePasswordReset(userID int, token string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	if _, err := tx.Exec("DELETE FROM password_resets WHERE user_id = ? OR expires_at <= ?", userID, now); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO password_resets (token_hash, user_id, created_at, expires_at)
+		VALUES (?, ?, ?, ?)`,
+		hashToken(token), userID, now, now.Add(PasswordResetLifetime))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// FetchPasswordResetUserID returns the user a live reset token belongs to without using it up
+func FetchPasswordResetUserID(token string) (int, error) {
+	var userID int
+	err := db.QueryRow(`
+		SELECT user_id FROM password_resets
+		WHERE token_hash = ? AND expires_at > ?`, hashToken(token), time.Now().UTC()).Scan(&userID)
+	return userID, err
+}
+
+// ResetPassword consumes the reset token and stores the new password hash in one transaction.
+// Every session of the user is signed out, since the old password may have been compromised.
+func ResetPassword(token, passwordHash string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	err = tx.QueryRow(`
+		DELETE FROM password_resets
+		WHERE token_hash = ? AND expires_at > ?
+		RETURNING user_id`, hashToken(token), time.Now().UTC()).Scan(&userID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Following the emailed link proves the address is the user's
+	_, err = tx.Exec("UPDATE users SET password_hash = ?, email_verified_at = COALESCE(email_verified_at, ?) WHERE id = ?", passwordHash, time.Now().UTC(), userID)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", userID); err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
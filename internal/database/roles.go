@@ -0,0 +1,247 @@
+package root
+
+import (
+	"database/sql"
+	"root/internal/models"
+	"root/internal/roles"
+	"strings"
+	"time"
+)
+
+// FetchUserRole returns the site-wide role of a user
+func FetchUserRole(userID int) (roles.Role, error) {
+	var role string
+	err := db.QueryRow("SELECT role FROM users WHERE id = ?", userID).Scan(&role)
+	return roles.Role(role), err
+}
+
+// SetUserRole changes the site-wide role of a user
+func SetUserRole(userID int, role roles.Role) error {
+	res, err := db.Exec("UPDATE users SET role = ? WHERE id = ?", string(role), userID)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(res)
+}
+
+// SetUserRoleByUsername changes the site-wide role of the user with that username.
+// It returns sql.ErrNoRows when there is no such user.
+func SetUserRoleByUsername(username string, role roles.Role) error {
+	res, err := db.Exec("UPDATE users SET role = ? WHERE username = ?", string(role), username)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(res)
+}
+
+// expectOneRow turns an update that matched nothing into sql.ErrNoRows
+func expectOneRow(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// FetchModeratedCategoryIDs returns the categories a user moderates
+func FetchModeratedCategoryIDs(userID int) (map[int]bool, error) {
+	rows, err := db.Query("SELECT category_id FROM category_moderators WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := map[int]bool{}
+	for rows.Next() {
+		var categoryID int
+		if err := rows.Scan(&categoryID); err != nil {
+			return nil, err
+		}
+		categories[categoryID] = true
+	}
+	return categories, rows.Err()
+}
+
+// AddCategoryModerator lets a user moderate one category; adding them twice is not an error
+func AddCategoryModerator(userID, categoryID int) error {
+	_, err := db.Exec(`
+		INSERT OR IGNORE INTO category_moderators (user_id, category_id, created_at)
+		VALUES (?, ?, ?)`, userID, categoryID, time.Now().UTC())
+	return err
+}
+
+// RemoveCategoryModerator stops a user from moderating a category
+func RemoveCategoryModerator(userID, categoryID int) error {
+	_, err := db.Exec("DELETE FROM category_moderators WHERE user_id = ? AND category_id = ?", userID, categoryID)
+	return err
+}
+
+// FetchStaff lists the users with a role above user or with categories to moderate
+func FetchStaff() ([]models.StaffMember, error) {
+	rows, err := db.Query(`
+		SELECT u.id, u.username, u.role, c.id, c.name
+		FROM users u
+		LEFT JOIN category_moderators cm ON cm.user_id = u.id
+		LEFT JOIN categories c ON c.id = cm.category_id
+		WHERE u.role <> ? OR cm.user_id IS NOT NULL
+		ORDER BY u.username, c.id`, string(roles.User))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var staff []models.StaffMember
+	for rows.Next() {
+		var member models.StaffMember
+		var categoryID sql.NullInt64
+		var categoryName sql.NullString
+		if err := rows.Scan(&member.ID, &member.Username, &member.Role, &categoryID, &categoryName); err != nil {
+			return nil, err
+		}
+		if len(staff) == 0 || staff[len(staff)-1].ID != member.ID {
+			staff = append(staff, member)
+		}
+		if categoryID.Valid {
+			last := &staff[len(staff)-1]
+			last.Categories = append(last.Categories, models.Category{ID: int(categoryID.Int64), Name: categoryName.String})
+		}
+	}
+	return staff, rows.Err()
+}
+
+// FetchPostAuthor returns the author of a post
+func FetchPostAuthor(postID int) (int, error) {
+	var userID int
+	err := db.QueryRow("SELECT user_id FROM posts WHERE id = ?", postID).Scan(&userID)
+	return userID, err
+}
+
+// FetchCommentAuthor returns the author of a comment and the post it belongs to
+func FetchCommentAuthor(commentID int) (int, int, error) {
+	var userID, postID int
+	err := db.QueryRow("SELECT user_id, post_id FROM comments WHERE id = ?", commentID).Scan(&userID, &postID)
+	return userID, postID, err
+}
+
+// FetchPostCategoryIDs returns the categories a post is filed under
+func FetchPostCategoryIDs(postID int) ([]int, error) {
+	rows, err := db.Query("SELECT category_id FROM post_categories WHERE post_id = ?", postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categoryIDs []int
+	for rows.Next() {
+		var categoryID int
+		if err := rows.Scan(&categoryID); err != nil {
+			return nil, err
+		}
+		categoryIDs = append(categoryIDs, categoryID)
+	}
+	return categoryIDs, rows.Err()
+}
+
+// FetchPostsCategoryIDs returns the categories each of the posts is filed under, keyed by
+// post ID, in one query per detailBatch posts. Posts without a category are left out.
+func FetchPostsCategoryIDs(postIDs []int) (map[int][]int, error) {
+	categoryIDs := make(map[int][]int, len(postIDs))
+	for start := 0; start < len(postIDs); start += detailBatch {
+		batch := postIDs[start:min(start+detailBatch, len(postIDs))]
+		ids := make([]any, len(batch))
+		for i, postID := range batch {
+			ids[i] = postID
+		}
+		in := "(" + strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",") + ")"
+
+		rows, err := db.Query("SELECT post_id, category_id FROM post_categories WHERE post_id IN "+in, ids...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var postID, categoryID int
+			if err := rows.Scan(&postID, &categoryID); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			categoryIDs[postID] = append(categoryIDs[postID], categoryID)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return categoryIDs, nil
+}
+
+// DeletePost removes a post with its comments, reactions, categories and media records,
+// and returns the paths of the uploaded files that belonged to it
+func DeletePost(postID int) ([]string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT file_path FROM media WHERE post_id = ?", postID)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		files = append(files, path)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, query := range []string{
+		"DELETE FROM post_reactions WHERE post_id = ?",
+		"DELETE FROM comment_reactions WHERE comment_id IN (SELECT id FROM comments WHERE post_id = ?)",
+		"DELETE FROM comments WHERE post_id = ?",
+		"DELETE FROM post_categories WHERE post_id = ?",
+		"DELETE FROM media WHERE post_id = ?",
+	} {
+		if _, err := tx.Exec(query, postID); err != nil {
+			return nil, err
+		}
+	}
+	res, err := tx.Exec("DELETE FROM posts WHERE id = ?", postID)
+	if err != nil {
+		return nil, err
+	}
+	if err := expectOneRow(res); err != nil {
+		return nil, err
+	}
+	return files, tx.Commit()
+}
+
+// DeleteComment removes a comment and the reactions to it
+func DeleteComment(commentID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM comment_reactions WHERE comment_id = ?", commentID); err != nil {
+		return err
+	}
+	res, err := tx.Exec("DELETE FROM comments WHERE id = ?", commentID)
+	if err != nil {
+		return err
+	}
+	if err := expectOneRow(res); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
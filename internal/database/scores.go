@@ -0,0 +1,174 @@
+package root
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// driverName is the SQLite driver with the ranking functions below registered on every
+// connection, so migrations and queries can call them as hot_score, controversy_score and search_rank
+const driverName = "sqlite3_forum"
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			if err := conn.RegisterFunc("hot_score", HotScore, true); err != nil {
+				return err
+			}
+			if err := conn.RegisterFunc("controversy_score", ControversyScore, true); err != nil {
+				return err
+			}
+			return conn.RegisterFunc("search_rank", SearchRank, true)
+		},
+	})
+}
+
+// hotDecay is how many seconds newer a post must be to rank as high as one with ten times
+// its net votes; 45000 seconds is twelve and a half hours
+const hotDecay = 45000
+
+// HotScore ranks a post by its net votes on a logarithmic scale plus its age, so every
+// 12.5 hours of age weighs as much as a tenfold difference in votes. The score of a post
+// only changes when it is voted on, but newer posts keep climbing past older ones.
+func HotScore(likes, dislikes, createdUnix int64) float64 {
+	net := float64(likes - dislikes)
+	order := math.Log10(math.Max(math.Abs(net), 1))
+	sign := 0.0
+	if net > 0 {
+		sign = 1
+	} else if net < 0 {
+		sign = -1
+	}
+	return sign*order + float64(createdUnix)/hotDecay
+}
+
+// ControversyScore ranks a post by how many votes it has and how evenly they are split
+// between likes and dislikes. Posts with only likes or only dislikes score 0.
+func ControversyScore(likes, dislikes int64) float64 {
+	if likes <= 0 || dislikes <= 0 {
+		return 0
+	}
+	balance := float64(min(likes, dislikes)) / float64(max(likes, dislikes))
+	return math.Pow(float64(likes+dislikes), balance)
+}
+
+// searchVoteWeight is how far votes move a search match: each tenfold of net votes changes
+// its relevance by this fraction, up or down
+const searchVoteWeight = 0.2
+
+// SearchRank ranks a full-text match by its FTS5 bm25 relevance, where lower is better, and its
+// net votes on a logarithmic scale, so relevance leads and votes order matches of similar
+// relevance. Higher ranks are better.
+func SearchRank(bm25 float64, net int64) float64 {
+	weight := 1 + searchVoteWeight*math.Log10(1+math.Abs(float64(net)))
+	if net < 0 {
+		weight = 1 / weight
+	}
+	return -bm25 * weight
+}
+
+// Sort modes the feed and category pages can list posts in
+const (
+	SortNew           = "new"
+	SortTop           = "top"
+	SortHot           = "hot"
+	SortControversial = "controversial"
+)
+
+// Windows a top listing can look back over
+const (
+	WindowDay   = "day"
+	WindowWeek  = "week"
+	WindowMonth = "month"
+	WindowAll   = "all"
+)
+
+// SortModes and SortWindows list the sort modes and windows in the order they are offered
+var (
+	SortModes   = []string{SortHot, SortNew, SortTop, SortControversial}
+	SortWindows = []string{WindowDay, WindowWeek, WindowMonth, WindowAll}
+)
+
+// Sort is an order to list posts in. The zero Sort is newest first.
+type Sort struct {
+	Mode string
+	// Window limits a top listing to the posts written within it
+	Window string
+}
+
+// ParseSort checks a sort mode and window given by name. Empty names pick newest first
+// and, for top, all time.
+func ParseSort(mode, window string) (Sort, error) {
+	if mode == "" {
+		mode = SortNew
+	}
+	if !slices.Contains(SortModes, mode) {
+		return Sort{}, fmt.Errorf("unknown sort %q", mode)
+	}
+	if mode != SortTop {
+		if window != "" {
+			return Sort{}, fmt.Errorf("only the top sort takes a window")
+		}
+		return Sort{Mode: mode}, nil
+	}
+	if window == "" {
+		window = WindowAll
+	}
+	if !slices.Contains(SortWindows, window) {
+		return Sort{}, fmt.Errorf("unknown window %q", window)
+	}
+	return Sort{Mode: mode, Window: window}, nil
+}
+
+// key returns what a sort pages by and, for top over a window, the earliest creation time it lists
+func (s Sort) key(now time.Time) (sortKey, time.Time) {
+	switch s.Mode {
+	case SortTop:
+		var since time.Time
+		switch s.Window {
+		case WindowDay:
+			since = now.AddDate(0, 0, -1)
+		case WindowWeek:
+			since = now.AddDate(0, 0, -7)
+		case WindowMonth:
+			since = now.AddDate(0, -1, 0)
+		}
+		return sortKey{"p.score", "p.score", cursorInt}, since
+	case SortHot:
+		return sortKey{"p.hot", "p.hot", cursorFloat}, time.Time{}
+	case SortControversial:
+		return sortKey{"p.controversy", "p.controversy", cursorFloat}, time.Time{}
+	default:
+		return createdKey, time.Time{}
+	}
+}
+
+// execer is a *sql.DB or *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// refreshScores recomputes the score, hot and controversy columns from the votes of the
+// posts p matching where. It runs on every vote, so a listing sorted by them is a plain
+// index scan rather than a count of every post's votes.
+func refreshScores(tx execer, where string, args ...any) error {
+	_, err := tx.Exec(`
+		UPDATE posts SET
+			score = v.likes - v.dislikes,
+			hot = hot_score(v.likes, v.dislikes, CAST(strftime('%s', posts.created_at) AS INTEGER)),
+			controversy = controversy_score(v.likes, v.dislikes)
+		FROM (
+			SELECT p.id,
+				(SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = p.id AND r.is_like = 1) AS likes,
+				(SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = p.id AND r.is_like = 0) AS dislikes
+			FROM posts p
+			WHERE `+where+`
+		) v
+		WHERE posts.id = v.id`, args...)
+	return err
+}
@@ -0,0 +1,229 @@
+package root
+
+import (
+	"errors"
+	"fmt"
+	"root/internal/models"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// What a search looks through
+const (
+	SearchPosts    = "posts"
+	SearchComments = "comments"
+)
+
+// HighlightStart and HighlightEnd surround the matched terms in search snippets. They are
+// private-use characters posts have no reason to contain, so a snippet can be escaped as
+// plain text and the markers turned into highlights afterwards.
+const (
+	HighlightStart = "\uE000"
+	HighlightEnd   = "\uE001"
+)
+
+// snippetTokens is about how many words of text a search snippet shows around the matches
+const snippetTokens = 24
+
+// SearchQuery is a full-text search of posts or comments and the filters narrowing it
+type SearchQuery struct {
+	// Text holds the words to find. "Quoted words" must appear together as a phrase and a
+	// word ending in * matches every word starting with it.
+	Text string
+	// In is SearchPosts or SearchComments
+	In string
+	// CategoryID limits the search to posts filed under the category or one nested under
+	// it, and to comments on them; 0 searches every category
+	CategoryID int
+	// Author limits the search to what one user wrote; empty searches everyone's
+	Author string
+	// From and Until limit the search to what was written from From up to but not including
+	// Until; the zero time leaves that end open
+	From  time.Time
+	Until time.Time
+}
+
+// searchTarget is what searching posts or comments differs in. Its columns are the ID, post ID,
+// comment ID or 0, author, creation time and vote counts of a match; net is its net votes.
+type searchTarget struct {
+	fts     string
+	from    string
+	columns string
+	net     string
+	alias   string
+}
+
+var searchTargets = map[string]searchTarget{
+	SearchPosts: {
+		fts:  "posts_fts",
+		from: "posts_fts JOIN posts p ON p.id = posts_fts.rowid JOIN users u ON u.id = p.user_id",
+		columns: `p.id AS id, p.id AS post_id, 0 AS comment_id, u.username, u.profile_color, p.created_at,
+			(SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = p.id AND r.is_like = 1) AS likes,
+			(SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = p.id AND r.is_like = 0) AS dislikes`,
+		net:   "p.score",
+		alias: "p",
+	},
+	SearchComments: {
+		fts:  "comments_fts",
+		from: "comments_fts JOIN comments c ON c.id = comments_fts.rowid JOIN users u ON u.id = c.user_id",
+		columns: `c.id AS id, c.post_id AS post_id, c.id AS comment_id, u.username, u.profile_color, c.created_at,
+			(SELECT COUNT(*) FROM comment_reactions r WHERE r.comment_id = c.id AND r.is_like = 1) AS likes,
+			(SELECT COUNT(*) FROM comment_reactions r WHERE r.comment_id = c.id AND r.is_like = 0) AS dislikes`,
+		net: `(SELECT COUNT(*) FROM comment_reactions r WHERE r.comment_id = c.id AND r.is_like = 1) -
+			(SELECT COUNT(*) FROM comment_reactions r WHERE r.comment_id = c.id AND r.is_like = 0)`,
+		alias: "c",
+	},
+}
+
+// ErrNoFullTextSearch means the forum was built without the sqlite_fts5 build tag
+var ErrNoFullTextSearch = errors.New("this build has no full-text search, which the forum needs; build it with -tags sqlite_fts5, e.g. go run -tags sqlite_fts5 ./cmd")
+
+// checkFullTextSearch fails when the SQLite driver was built without FTS5, which search and its
+// migration need. The driver only compiles it in with the sqlite_fts5 build tag.
+func checkFullTextSearch() error {
+	if !FullTextSearch {
+		return ErrNoFullTextSearch
+	}
+	var enabled bool
+	if err := db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled); err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrNoFullTextSearch
+	}
+	return nil
+}
+
+// Search retrieves a page of the posts or comments matching query, best matches first.
+// How well a match ranks is its bm25 relevance weighed by its votes; see SearchRank.
+// A query without any words to look for finds nothing.
+func Search(query SearchQuery, page PageRequest) (models.SearchPage, error) {
+	target, ok := searchTargets[query.In]
+	if !ok {
+		return models.SearchPage{}, fmt.Errorf("unknown search target %q", query.In)
+	}
+	match := matchExpression(query.Text)
+	if match == "" {
+		return models.SearchPage{}, nil
+	}
+	keys, err := newKeyset(page, sortKey{"h.rank", "h.rank", cursorFloat}, "h.id")
+	if err != nil {
+		return models.SearchPage{}, err
+	}
+
+	var with string
+	var args []any
+	if query.CategoryID != 0 {
+		with = subtreeCTE
+		args = append(args, query.CategoryID)
+	}
+	args = append(args, HighlightStart, HighlightEnd, match)
+	where := target.fts + " MATCH ?"
+	if query.CategoryID != 0 {
+		postID := target.alias + ".id"
+		if query.In == SearchComments {
+			postID = "c.post_id"
+		}
+		where += " AND " + postID + " IN (SELECT post_id FROM post_categories WHERE category_id IN (SELECT id FROM subtree))"
+	}
+	if query.Author != "" {
+		where += " AND u.username = ? COLLATE NOCASE"
+		args = append(args, query.Author)
+	}
+	if !query.From.IsZero() {
+		where += " AND " + target.alias + ".created_at >= ?"
+		args = append(args, query.From.UTC().Format(time.DateTime))
+	}
+	if !query.Until.IsZero() {
+		where += " AND " + target.alias + ".created_at < ?"
+		args = append(args, query.Until.UTC().Format(time.DateTime))
+	}
+
+	// The hits are ranked in a subquery, as bm25 and snippet only work next to their MATCH
+	rows, err := db.Query(with+`
+		SELECT h.post_id, h.comment_id, h.username, h.profile_color, h.created_at, h.likes, h.dislikes, h.snippet, h.rank
+		FROM (
+			SELECT `+target.columns+`,
+				snippet(`+target.fts+`, 0, ?, ?, '…', `+fmt.Sprint(snippetTokens)+`) AS snippet,
+				search_rank(bm25(`+target.fts+`), `+target.net+`) AS rank
+			FROM `+target.from+`
+			WHERE `+where+`
+		) h
+		WHERE 1 = 1`+keys.seek+`
+		ORDER BY `+keys.order+`
+		LIMIT ?`, append(append(args, keys.args...), PageSize+1)...)
+	if err != nil {
+		return models.SearchPage{}, err
+	}
+	defer rows.Close()
+
+	var results []models.SearchResult
+	for rows.Next() {
+		var result models.SearchResult
+		var rank float64
+		err := rows.Scan(&result.PostID, &result.CommentID, &result.Username, &result.ProfileColor,
+			&result.CreatedAt, &result.Likes, &result.Dislikes, &result.Snippet, &rank)
+		if err != nil {
+			return models.SearchPage{}, err
+		}
+		result.FormatDate = FormatDate(result.CreatedAt)
+		result.Cursor = encodeCursor(rank, result.PostID)
+		if result.CommentID != 0 {
+			result.Cursor = encodeCursor(rank, result.CommentID)
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return models.SearchPage{}, err
+	}
+
+	var out models.SearchPage
+	out.Results, out.Next, out.Prev = pageOf(keys, results, func(r models.SearchResult) string { return r.Cursor })
+	return out, nil
+}
+
+// matchExpression turns what someone typed into an FTS5 query that cannot be malformed:
+// every word and "quoted phrase" is quoted for FTS5, keeping a trailing * as a prefix search,
+// and all of them must match. It returns "" when there is nothing to look for.
+func matchExpression(text string) string {
+	var terms []string
+	add := func(term string) {
+		prefix := strings.HasSuffix(term, "*")
+		term = strings.Trim(term, `*"`)
+		term = strings.ReplaceAll(term, `"`, "")
+		if !strings.ContainsFunc(term, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) {
+			return
+		}
+		term = `"` + term + `"`
+		if prefix {
+			term += "*"
+		}
+		terms = append(terms, term)
+	}
+
+	for text != "" {
+		text = strings.TrimLeftFunc(text, unicode.IsSpace)
+		if strings.HasPrefix(text, `"`) {
+			phrase, rest, found := strings.Cut(text[1:], `"`)
+			if !found {
+				phrase, rest = text[1:], ""
+			}
+			// A * right after the closing quote makes the phrase's last word a prefix
+			if strings.HasPrefix(rest, "*") {
+				phrase += "*"
+				rest = rest[1:]
+			}
+			add(strings.Join(strings.Fields(phrase), " "))
+			text = rest
+			continue
+		}
+		end := strings.IndexFunc(text, unicode.IsSpace)
+		if end < 0 {
+			end = len(text)
+		}
+		add(text[:end])
+		text = text[end:]
+	}
+	return strings.Join(terms, " ")
+}
@@ -0,0 +1,45 @@
+package root
+
+import "testing"
+
+func TestMatchExpression(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"nothing", "", ""},
+		{"only spaces", " \t\n ", ""},
+		{"one word", "golang", `"golang"`},
+		{"words must all match", "go  forum\tthreads", `"go" "forum" "threads"`},
+		{"letters of any script", "naïve café", `"naïve" "café"`},
+		{"phrase", `"hello world"`, `"hello world"`},
+		{"phrase spacing is collapsed", `"  hello   world " again`, `"hello world" "again"`},
+		{"phrase between words", `before "in between" after`, `"before" "in between" "after"`},
+		{"empty phrase", `""`, ""},
+		{"prefix", "prog*", `"prog"*`},
+		{"prefix of a phrase", `"hello wor"*`, `"hello wor"*`},
+		{"star inside a phrase", `"hello wor*"`, `"hello wor"*`},
+		{"lone star", "*", ""},
+		{"stars only", "** *", ""},
+		{"lone star next to a word", "* go *", `"go"`},
+		{"star in the middle", "go*lang", `"go*lang"`},
+		{"NEAR is a word", "go NEAR forum", `"go" "NEAR" "forum"`},
+		{"NEAR group", "NEAR(go forum, 5)", `"NEAR(go" "forum," "5)"`},
+		{"AND and OR are words", "cats AND dogs OR birds", `"cats" "AND" "dogs" "OR" "birds"`},
+		{"NOT is a word", "NOT spam", `"NOT" "spam"`},
+		{"column filter", "content:secret", `"content:secret"`},
+		{"lone quote", `"`, ""},
+		{"unbalanced quote runs to the end", `say "hello there`, `"say" "hello there"`},
+		{"unbalanced quote after a phrase", `"one" "two three`, `"one" "two three"`},
+		{"quote inside a word", `it"s`, `"its"`},
+		{"punctuation only", `- + ( ) ^ :`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchExpression(tt.text); got != tt.want {
+				t.Fatalf("matchExpression(%q) = %s, want %s", tt.text, got, tt.want)
+			}
+		})
+	}
+}
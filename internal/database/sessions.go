@@ -0,0 +1,123 @@
+package root
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"root/internal/models"
+	"time"
+)
+
+const (
+	// SessionIdleTimeout is how long a session survives without any activity
+	SessionIdleTimeout = 24 * time.Hour
+	// SessionMaxLifetime is the hard cap on a session, no matter how active it is
+	SessionMaxLifetime = 30 * 24 * time.Hour
+	// sessionRenewInterval limits how often last_seen_at is written for a busy session
+	sessionRenewInterval = time.Minute
+)
+
+// hashToken returns the value stored in the database for a raw session or one-time token.
+// Only the hash is persisted so a leaked database cannot be replayed as cookies or links.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateSession stores a new session for the user and returns its expiry time
+func CreateSession(userID int, token, userAgent, ipAddress string) (time.Time, error) {
+	now := time.Now().UTC()
+	expiresAt := now.Add(SessionIdleTimeout)
+
+	_, err := db.Exec(`
+		INSERT INTO sessions (token_hash, user_id, created_at, last_seen_at, expires_at, user_agent, ip_address)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		hashToken(token), userID, now, now, expiresAt, userAgent, ipAddress)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return expiresAt, nil
+}
+
+// FetchUserIDBySessionToken retrieves the user ID for a given session token.
+// Expired sessions are rejected, and live ones have their expiry pushed forward.
+func FetchUserIDBySessionToken(sessionToken string) (int, error) {
+	var userID int
+	var createdAt, lastSeenAt time.Time
+	now := time.Now().UTC()
+	tokenHash := hashToken(sessionToken)
+
+	err := db.QueryRow(`
+		SELECT user_id, created_at, last_seen_at
+		FROM sessions
+		WHERE token_hash = ? AND expires_at > ?`, tokenHash, now).Scan(&userID, &createdAt, &lastSeenAt)
+	if err != nil {
+		return 0, err
+	}
+
+	// Sliding renewal, capped by the session's absolute lifetime
+	if now.Sub(lastSeenAt) >= sessionRenewInterval {
+		expiresAt := now.Add(SessionIdleTimeout)
+		if hardLimit := createdAt.Add(SessionMaxLifetime); expiresAt.After(hardLimit) {
+			expiresAt = hardLimit
+		}
+		_, err = db.Exec("UPDATE sessions SET last_seen_at = ?, expires_at = ? WHERE token_hash = ?", now, expiresAt, tokenHash)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return userID, nil
+}
+
+// DeleteSession removes a session token from the sessions table
+func DeleteSession(sessionToken string) error {
+	_, err := db.Exec("DELETE FROM sessions WHERE token_hash = ?", hashToken(sessionToken))
+	return err
+}
+
+// DeleteUserSessions removes every session belonging to a user (sign out everywhere)
+func DeleteUserSessions(userID int) error {
+	_, err := db.Exec("DELETE FROM sessions WHERE user_id = ?", userID)
+	return err
+}
+
+// DeleteExpiredSessions purges sessions whose expiry has passed
+func DeleteExpiredSessions() error {
+	_, err := db.Exec("DELETE FROM sessions WHERE expires_at <= ?", time.Now().UTC())
+	return err
+}
+
+// FetchUserSessions lists the live sessions of a user, most recently active first.
+// The session matching currentToken is flagged so the page can label it.
+func FetchUserSessions(userID int, currentToken string) ([]models.Session, error) {
+	rows, err := db.Query(`
+		SELECT id, token_hash, user_agent, ip_address, created_at, last_seen_at
+		FROM sessions
+		WHERE user_id = ? AND expires_at > ?
+		ORDER BY last_seen_at DESC`, userID, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	currentHash := hashToken(currentToken)
+	var sessions []models.Session
+	for rows.Next() {
+		var session models.Session
+		var tokenHash string
+		err := rows.Scan(&session.ID, &tokenHash, &session.UserAgent, &session.IPAddress, &session.CreatedAt, &session.LastSeenAt)
+		if err != nil {
+			return nil, err
+		}
+		session.FormatLastSeen = session.LastSeenAt.Local().Format("02 Jan 2006, 15:04")
+		session.Current = tokenHash == currentHash
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// DeleteUserSession revokes a single session, scoped to its owner so users can only revoke their own
+func DeleteUserSession(userID, sessionID int) error {
+	_, err := db.Exec("DELETE FROM sessions WHERE id = ? AND user_id = ?", sessionID, userID)
+	return err
+}
@@ -0,0 +1,174 @@
+package root
+
+import (
+	"database/sql"
+	"errors"
+	"root/internal/models"
+	"time"
+)
+
+const (
+	// LoginChallengeLifetime is how long the second login step waits for a code
+	LoginChallengeLifetime = 5 * time.Minute
+	// MaxLoginChallengeAttempts is how many codes may be tried before the login starts over
+	MaxLoginChallengeAttempts = 5
+)
+
+// ErrTOTPAlreadyEnabled is returned when enrolling a user who already has two-factor enabled
+var ErrTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+
+// FetchTOTP returns the user's TOTP secret, whether enrollment is finished and the last used time step
+func FetchTOTP(userID int) (string, bool, int64, error) {
+	var secret string
+	var enabledAt sql.NullTime
+	var lastStep int64
+	err := db.QueryRow("SELECT secret, enabled_at, last_step FROM totp_secrets WHERE user_id = ?", userID).
+		Scan(&secret, &enabledAt, &lastStep)
+	if err != nil {
+		return "", false, 0, err
+	}
+	return secret, enabledAt.Valid, lastStep, nil
+}
+
+// SavePendingTOTP stores a secret for an enrollment that still has to be confirmed
+func SavePendingTOTP(userID int, secret string) error {
+	res, err := db.Exec(`
+		INSERT INTO totp_secrets (user_id, secret) VALUES (?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret WHERE enabled_at IS NULL`, userID, secret)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+	return err
+}
+
+// EnableTOTP finishes enrollment once the first code has been checked and stores the
+// hashed recovery codes, replacing any earlier ones
+func EnableTOTP(userID int, step int64, recoveryCodeHashes []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("UPDATE totp_secrets SET enabled_at = ?, last_step = ? WHERE user_id = ? AND enabled_at IS NULL",
+		time.Now().UTC(), step, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = ErrTOTPAlreadyEnabled
+		}
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	for _, hash := range recoveryCodeHashes {
+		if _, err := tx.Exec("INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)", userID, hash); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UseTOTPStep records a matched time step. It returns false when that step (or a later one)
+// was already used, so the same code cannot log in twice.
+func UseTOTPStep(userID int, step int64) (bool, error) {
+	res, err := db.Exec("UPDATE totp_secrets SET last_step = ? WHERE user_id = ? AND last_step < ? AND enabled_at IS NOT NULL",
+		step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// DisableTOTP removes the user's second factor and recovery codes
+func DisableTOTP(userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM totp_secrets WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// FetchUnusedRecoveryCodes lists the recovery code hashes the user can still use
+func FetchUnusedRecoveryCodes(userID int) ([]models.RecoveryCode, error) {
+	rows, err := db.Query("SELECT id, code_hash FROM recovery_codes WHERE user_id = ? AND used_at IS NULL", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var codes []models.RecoveryCode
+	for rows.Next() {
+		var code models.RecoveryCode
+		if err := rows.Scan(&code.ID, &code.Hash); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, rows.Err()
+}
+
+// UseRecoveryCode marks a recovery code as used. It returns false if it was used in the meantime.
+func UseRecoveryCode(codeID int) (bool, error) {
+	res, err := db.Exec("UPDATE recovery_codes SET used_at = ? WHERE id = ? AND used_at IS NULL", time.Now().UTC(), codeID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// CreateLoginChallenge remembers a user who passed the password check and still owes a code
+func CreateLoginChallenge(userID int, token string) error {
+	now := time.Now().UTC()
+	if _, err := db.Exec("DELETE FROM login_challenges WHERE expires_at <= ?", now); err != nil {
+		return err
+	}
+	_, err := db.Exec("INSERT INTO login_challenges (token_hash, user_id, expires_at) VALUES (?, ?, ?)",
+		hashToken(token), userID, now.Add(LoginChallengeLifetime))
+	return err
+}
+
+// FetchLoginChallenge returns the user behind a live login challenge
+func FetchLoginChallenge(token string) (int, error) {
+	var userID int
+	err := db.QueryRow(`
+		SELECT user_id FROM login_challenges
+		WHERE token_hash = ? AND expires_at > ? AND attempts < ?`,
+		hashToken(token), time.Now().UTC(), MaxLoginChallengeAttempts).Scan(&userID)
+	return userID, err
+}
+
+// RecordLoginChallengeAttempt counts a code attempt against the challenge and returns its user.
+// Once MaxLoginChallengeAttempts is reached the challenge stops working.
+func RecordLoginChallengeAttempt(token string) (int, error) {
+	var userID int
+	err := db.QueryRow(`
+		UPDATE login_challenges SET attempts = attempts + 1
+		WHERE token_hash = ? AND expires_at > ? AND attempts < ?
+		RETURNING user_id`,
+		hashToken(token), time.Now().UTC(), MaxLoginChallengeAttempts).Scan(&userID)
+	return userID, err
+}
+
+// DeleteLoginChallenge removes a login challenge once it has been answered
+func DeleteLoginChallenge(token string) error {
+	_, err := db.Exec("DELETE FROM login_challenges WHERE token_hash = ?", hashToken(token))
+	return err
+}
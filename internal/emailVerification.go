@@ -0,0 +1,202 @@
+package root
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"root/internal/config"
+	database "root/internal/database"
+	"root/internal/mail"
+
+	"github.com/gofrs/uuid"
+)
+
+// unverifiedRestrictions holds the actions an account may not take before its email is verified
+var unverifiedRestrictions = map[string]bool{}
+
+// setupEmailVerification loads the unverified account policy from the configuration
+func setupEmailVerification(cfg *config.Config) {
+	unverifiedRestrictions = map[string]bool{}
+	for _, action := range cfg.EmailVerification.Restrict {
+		unverifiedRestrictions[action] = true
+	}
+}
+
+// errVerificationTooSoon is returned when a verification email was sent moments ago
+var errVerificationTooSoon = errors.New("a verification email was sent less than a minute ago")
+
+// sendVerificationEmail mails a fresh verification link for the user's email
+func sendVerificationEmail(userID int, email string) error {
+	verificationToken, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+
+	created, err := database.CreateEmailVerification(userID, email, verificationToken.String())
+	if err != nil {
+		return err
+	}
+	if !created {
+		return errVerificationTooSoon
+	}
+
+	return mailer.Send(mail.Message{
+		To:      email,
+		Subject: "Confirm your Stellar Forum email",
+		Body: "Welcome to Stellar Forum!\n\n" +
+			"Open this link within 24 hours to confirm your email address:\n" +
+			absoluteURL("/email/verify?token="+url.QueryEscape(verificationToken.String())) + "\n\n" +
+			"If you did not create an account, you can ignore this email.\n",
+	})
+}
+
+// VerifyEmail confirms the email address a verification link was sent to
+func VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	_, err := database.VerifyEmail(r.URL.Query().Get("token"))
+	if err == sql.ErrNoRows {
+		renderVerifyPage(w, r, http.StatusOK, false, "This verification link is invalid or has expired.")
+		return
+	}
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	renderVerifyPage(w, r, http.StatusOK, true, "")
+}
+
+// ResendVerification mails the signed-in user a new verification link
+func ResendVerification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	cookie, err := r.Cookie("session_token")
+	if err != nil || cookie.Value == "" {
+		http.Redirect(w, r, "/auth", http.StatusSeeOther)
+		return
+	}
+
+	userID, err := database.FetchUserIDBySessionToken(cookie.Value)
+	if err != nil {
+		http.Redirect(w, r, "/auth", http.StatusSeeOther)
+		return
+	}
+
+	email, verified, err := database.FetchUserEmail(userID)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	if verified {
+		renderVerifyPage(w, r, http.StatusOK, true, "")
+		return
+	}
+
+	err = sendVerificationEmail(userID, email)
+	if err == errVerificationTooSoon {
+		renderVerifyPage(w, r, http.StatusTooManyRequests, false, "A verification email was just sent. Please wait a minute before asking for another one.")
+		return
+	}
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	renderVerifyPage(w, r, http.StatusOK, false, "")
+}
+
+// requireVerifiedEmail stops signed-in users with an unverified email from taking a
+// restricted action. Guests are left to the handler, which already sends them to /auth.
+func requireVerifiedEmail(action string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !unverifiedRestrictions[action] {
+			next(w, r)
+			return
+		}
+
+		cookie, err := r.Cookie("session_token")
+		if err != nil || cookie.Value == "" {
+			next(w, r)
+			return
+		}
+		userID, err := database.FetchUserIDBySessionToken(cookie.Value)
+		if err != nil {
+			next(w, r)
+			return
+		}
+
+		blocked, err := blockedByEmailVerification(userID, action)
+		if err != nil {
+			http.Redirect(w, r, "/500", http.StatusSeeOther)
+			return
+		}
+		if blocked {
+			renderVerifyPage(w, r, http.StatusForbidden, false, "Please confirm your email address before you "+restrictedActionName(action)+".")
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// blockedByEmailVerification reports whether the user may not take the action until their email is verified
+func blockedByEmailVerification(userID int, action string) (bool, error) {
+	if !unverifiedRestrictions[action] {
+		return false, nil
+	}
+	_, verified, err := database.FetchUserEmail(userID)
+	if err != nil {
+		return false, err
+	}
+	return !verified, nil
+}
+
+// restrictedActionName describes a restricted action for the verification page
+func restrictedActionName(action string) string {
+	switch action {
+	case "post":
+		return "create posts"
+	case "comment":
+		return "comment"
+	case "react":
+		return "like or dislike"
+	default:
+		return action
+	}
+}
+
+// renderVerifyPage renders the email verification page.
+// With neither verified nor an error message, it confirms that a new link was sent.
+func renderVerifyPage(w http.ResponseWriter, r *http.Request, status int, verified bool, errorMessage string) {
+	signedIn := false
+	if cookie, err := r.Cookie("session_token"); err == nil && cookie.Value != "" {
+		_, err := database.FetchUserIDBySessionToken(cookie.Value)
+		signedIn = err == nil
+	}
+
+	data := struct {
+		CSRFToken    string
+		Verified     bool
+		SignedIn     bool
+		ErrorMessage string
+	}{
+		CSRFToken:    csrfToken(r),
+		Verified:     verified,
+		SignedIn:     signedIn,
+		ErrorMessage: errorMessage,
+	}
+
+	w.WriteHeader(status)
+	err := templates.ExecuteTemplate(w, "verify.html", data)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+	}
+}
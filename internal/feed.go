@@ -0,0 +1,191 @@
+package root
+
+import (
+	"net/http"
+	"net/url"
+	database "root/internal/database"
+	"root/internal/models"
+)
+
+// pageRequest reads the after and before cursors of a paged post list from the query string
+func pageRequest(r *http.Request) database.PageRequest {
+	query := r.URL.Query()
+	return database.PageRequest{After: query.Get("after"), Before: query.Get("before")}
+}
+
+// sortLabels and windowLabels name the sort modes and top windows on the sort tabs
+var (
+	sortLabels = map[string]string{
+		database.SortHot:           "Hot",
+		database.SortNew:           "New",
+		database.SortTop:           "Top",
+		database.SortControversial: "Controversial",
+	}
+	windowLabels = map[string]string{
+		database.WindowDay:   "Today",
+		database.WindowWeek:  "This week",
+		database.WindowMonth: "This month",
+		database.WindowAll:   "All time",
+	}
+)
+
+// sortRequest reads the sort mode and top window of a post list from ?sort= and ?t=
+func sortRequest(r *http.Request) (database.Sort, error) {
+	query := r.URL.Query()
+	return database.ParseSort(query.Get("sort"), query.Get("t"))
+}
+
+// listURL is the address of path listing posts in sort, with params such as a page cursor.
+// Newest first is the default order, so it adds nothing to the address.
+func listURL(path string, sort database.Sort, params url.Values) string {
+	query := url.Values{}
+	for key, values := range params {
+		query[key] = values
+	}
+	if sort.Mode != "" && sort.Mode != database.SortNew {
+		query.Set("sort", sort.Mode)
+	}
+	if sort.Mode == database.SortTop {
+		query.Set("t", sort.Window)
+	}
+	if len(query) == 0 {
+		return path
+	}
+	return path + "?" + query.Encode()
+}
+
+// listNav links the pages around page of the list at path, sorted by sort. fragment is the
+// path of the handler that renders the next page for loading in place, or empty for none.
+func listNav(path, fragment string, sort database.Sort, page models.PostPage) models.ListNav {
+	var nav models.ListNav
+	if page.Next != "" {
+		after := url.Values{"after": {page.Next}}
+		nav.NextURL = listURL(path, sort, after)
+		if fragment != "" {
+			nav.NextFragment = listURL(fragment, sort, after)
+		}
+	}
+	if page.Prev != "" {
+		nav.PrevURL = listURL(path, sort, url.Values{"before": {page.Prev}})
+	}
+
+	for _, mode := range database.SortModes {
+		nav.SortModes = append(nav.SortModes, models.SortLink{
+			Label:  sortLabels[mode],
+			URL:    listURL(path, database.Sort{Mode: mode, Window: database.WindowAll}, nil),
+			Active: mode == sort.Mode,
+		})
+	}
+	if sort.Mode == database.SortTop {
+		for _, window := range database.SortWindows {
+			nav.SortWindows = append(nav.SortWindows, models.SortLink{
+				Label:  windowLabels[window],
+				URL:    listURL(path, database.Sort{Mode: database.SortTop, Window: window}, nil),
+				Active: window == sort.Window,
+			})
+		}
+	}
+	return nav
+}
+
+// uniquePosts joins lists of posts, keeping the first copy of a post that is in several
+func uniquePosts(lists ...[]models.Post) []models.Post {
+	var posts []models.Post
+	seen := map[int]bool{}
+	for _, list := range lists {
+		for _, post := range list {
+			if !seen[post.ID] {
+				seen[post.ID] = true
+				posts = append(posts, post)
+			}
+		}
+	}
+	return posts
+}
+
+// FeedPage renders a page of the home feed in the order picked with ?sort= and ?t=, or of the
+// signed-in user's created, liked or disliked posts with ?list=, as an HTML fragment the home
+// page appends when asked for more
+func FeedPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	userID := sessionUserID(r)
+	page := pageRequest(r)
+	list := r.URL.Query().Get("list")
+	sort, err := sortRequest(r)
+	if err != nil {
+		http.Redirect(w, r, "/400", http.StatusSeeOther)
+		return
+	}
+
+	var posts models.PostPage
+	switch list {
+	case "":
+		posts, err = database.FetchFeedPage(userID, sort, page)
+	case "created", "liked", "disliked":
+		if _, ok := requireSession(w, r); !ok {
+			return
+		}
+		switch list {
+		case "created":
+			posts, err = database.FetchCreatedPostsPage(userID, page)
+		case "liked":
+			posts, err = database.FetchLikedPostsPage(userID, page)
+		default:
+			posts, err = database.FetchDislikedPostsPage(userID, page)
+		}
+	default:
+		http.Redirect(w, r, "/400", http.StatusSeeOther)
+		return
+	}
+	if err == database.ErrBadCursor {
+		http.Redirect(w, r, "/400", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	if userID != 0 {
+		perms, err := loadPermissions(userID)
+		if err != nil {
+			http.Redirect(w, r, "/500", http.StatusSeeOther)
+			return
+		}
+		if err := perms.markDeletable(posts.Posts); err != nil {
+			http.Redirect(w, r, "/500", http.StatusSeeOther)
+			return
+		}
+	}
+
+	// The link to the page after this one loads it in place; readers without scripts
+	// follow it to the full home page instead, where there is one
+	data := struct {
+		CSRFToken    string
+		SignedIn     bool
+		Posts        []models.Post
+		MoreURL      string
+		MoreFragment string
+	}{
+		CSRFToken: csrfToken(r),
+		SignedIn:  userID != 0,
+		Posts:     posts.Posts,
+	}
+	if list == "" {
+		nav := listNav("/", "/feed", sort, posts)
+		data.MoreURL, data.MoreFragment = nav.NextURL, nav.NextFragment
+	} else if posts.Next != "" {
+		data.MoreFragment = "/feed?" + url.Values{"after": {posts.Next}, "list": {list}}.Encode()
+		data.MoreURL = data.MoreFragment
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	err = templates.ExecuteTemplate(w, "feedpage.html", data)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+	}
+}
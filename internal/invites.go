@@ -0,0 +1,148 @@
+package root
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"net/http"
+	"net/url"
+	database "root/internal/database"
+	"root/internal/models"
+	"root/internal/roles"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxInviteUses caps how many accounts a single invite may create
+	maxInviteUses = 1000
+	// maxInviteDays caps how long an invite may stay valid
+	maxInviteDays = 365
+)
+
+// AdminInvites lists the invites
+func AdminInvites(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	if _, ok := requirePermission(w, r, roles.ManageInvites); !ok {
+		return
+	}
+
+	renderInvitesPage(w, r, "", "")
+}
+
+// CreateInvite creates an invite code and shows its link once
+func CreateInvite(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	userID, ok := requirePermission(w, r, roles.ManageInvites)
+	if !ok {
+		return
+	}
+
+	maxUses, err := strconv.Atoi(r.FormValue("max_uses"))
+	if err != nil || maxUses < 1 || maxUses > maxInviteUses {
+		renderInvitesPage(w, r, "", "Uses must be a number between 1 and "+strconv.Itoa(maxInviteUses)+".")
+		return
+	}
+	days, err := strconv.Atoi(r.FormValue("expires_in_days"))
+	if err != nil || days < 0 || days > maxInviteDays {
+		renderInvitesPage(w, r, "", "Expiry must be between 0 (never) and "+strconv.Itoa(maxInviteDays)+" days.")
+		return
+	}
+	note := strings.TrimSpace(r.FormValue("note"))
+	if len(note) > 100 {
+		renderInvitesPage(w, r, "", "The note can be at most 100 characters.")
+		return
+	}
+
+	var expiresAt time.Time
+	if days > 0 {
+		expiresAt = time.Now().UTC().AddDate(0, 0, days)
+	}
+
+	code, err := generateInviteCode()
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	if err := database.CreateInvite(userID, code, note, maxUses, expiresAt); err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	// The code is stored hashed, so this response is the only place it appears
+	renderInvitesPage(w, r, code, "")
+}
+
+// RevokeInvite stops an invite from being used again
+func RevokeInvite(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	if _, ok := requirePermission(w, r, roles.ManageInvites); !ok {
+		return
+	}
+
+	inviteID, err := strconv.Atoi(r.FormValue("invite_id"))
+	if err != nil {
+		http.Redirect(w, r, "/400", http.StatusSeeOther)
+		return
+	}
+	if err := database.RevokeInvite(inviteID); err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/invites", http.StatusSeeOther)
+}
+
+// renderInvitesPage renders the invite management page; newCode is only passed right after creation
+func renderInvitesPage(w http.ResponseWriter, r *http.Request, newCode, errorMessage string) {
+	invites, err := database.FetchInvites()
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	data := struct {
+		CSRFToken    string
+		Invites      []models.Invite
+		NewCode      string
+		NewLink      string
+		ErrorMessage string
+	}{
+		CSRFToken:    csrfToken(r),
+		Invites:      invites,
+		NewCode:      newCode,
+		ErrorMessage: errorMessage,
+	}
+	if newCode != "" {
+		data.NewLink = absoluteURL("/auth?invite=" + url.QueryEscape(newCode) + "#container2")
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	err = templates.ExecuteTemplate(w, "invites.html", data)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+	}
+}
+
+// generateInviteCode returns a random invite code formatted as xxxx-xxxx-xxxx-xxxx, already
+// in the normalized form redemption compares against
+func generateInviteCode() (string, error) {
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	code := base32.StdEncoding.EncodeToString(buf)
+	return database.NormalizeInviteCode(code[:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]), nil
+}
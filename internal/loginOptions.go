@@ -1,323 +1,423 @@
 package root
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
+	"database/sql"
+	"log"
 	"net/http"
 	"net/url"
+	"root/internal/config"
 	database "root/internal/database"
+	"root/internal/models"
+	"root/internal/oauth"
+	"sort"
 	"strings"
-	"time"
 
 	"github.com/gofrs/uuid"
 )
 
-var (
-	clientID        = ""
-	clientSecret    = ""
-	redirectURI     = "https://localhost:8080/auth/callback"
-	gitclientID     = ""
-	gitclientSecret = ""
-	gitRedirectURI  = "https://localhost:8080/auth/github/callback"
-)
+// oauthProviders holds every configured login provider keyed by its short name
+var oauthProviders = map[string]*oauth.Provider{}
 
-func handleGoogleLogin(w http.ResponseWriter, r *http.Request) {
-	authURL := fmt.Sprintf("https://accounts.google.com/o/oauth2/auth?client_id=%s&redirect_uri=%s&response_type=code&scope=email profile&state=%s",
-		url.QueryEscape(clientID), url.QueryEscape(redirectURI), "random")
-	http.Redirect(w, r, authURL, http.StatusTemporaryRedirect)
+// setupOAuthProviders builds the provider layer from the loaded configuration
+func setupOAuthProviders(cfg *config.Config) {
+	oauthProviders = map[string]*oauth.Provider{}
+	for name, providerCfg := range cfg.OAuth {
+		provider := oauth.NewProvider(name, providerCfg)
+		if !provider.Enabled() {
+			log.Printf("OAuth provider %q has no client ID configured, login with it is disabled", name)
+		}
+		oauthProviders[name] = provider
+	}
 }
 
-func handleGoogleCallback(w http.ResponseWriter, r *http.Request) {
-	// Verify the state parameter to protect against CSRF attacks
-	if r.URL.Query().Get("state") != "random" {
-		http.Error(w, "Invalid OAuth state", http.StatusBadRequest)
+// handleOAuthLogin starts the authorization code flow for the provider named in the URL
+func handleOAuthLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
 		return
 	}
 
-	code := r.URL.Query().Get("code")
-	if code == "" {
-		http.Redirect(w, r, "/auth", http.StatusSeeOther)
+	redirectToProvider(w, r, r.PathValue("provider"), 0)
+}
+
+// redirectToProvider sends the browser to the provider's consent screen.
+// A non-zero linkUserID marks the flow as linking the provider to that signed-in user.
+func redirectToProvider(w http.ResponseWriter, r *http.Request, name string, linkUserID int) {
+	provider, ok := oauthProviders[name]
+	if !ok || !provider.Enabled() {
+		http.Redirect(w, r, "/404", http.StatusFound)
+		return
+	}
+	if err := provider.Discover(r.Context()); err != nil {
+		log.Printf("OAuth %s discovery failed: %v", name, err)
+		http.Error(w, "Login provider is unavailable", http.StatusBadGateway)
+		return
 	}
 
-	// Exchange the code for a token
-	tokenURL := "https://oauth2.googleapis.com/token"
-	data := url.Values{}
-	data.Set("code", code)
-	data.Set("client_id", clientID)
-	data.Set("client_secret", clientSecret)
-	data.Set("redirect_uri", redirectURI)
-	data.Set("grant_type", "authorization_code")
+	// A random state ties the callback to this browser, and PKCE ties the code to this server
+	state, err := oauth.RandomString(32)
+	if err != nil {
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+	codeVerifier, err := oauth.NewPKCEVerifier()
+	if err != nil {
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+
+	// The nonce binds the ID token of an OpenID Connect provider to this login attempt
+	var extra url.Values
+	var nonce string
+	if provider.IsOIDC() {
+		nonce, err = oauth.RandomString(32)
+		if err != nil {
+			http.Error(w, "Failed to start login", http.StatusInternalServerError)
+			return
+		}
+		extra = url.Values{"nonce": {nonce}}
+	}
 
-	resp, err := http.PostForm(tokenURL, data)
+	err = database.SaveOAuthState(state, models.OAuthState{
+		Provider:     name,
+		CodeVerifier: codeVerifier,
+		LinkUserID:   linkUserID,
+		Nonce:        nonce,
+	})
 	if err != nil {
-		http.Error(w, "Failed to request token", http.StatusInternalServerError)
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
 		return
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	http.SetCookie(w, &http.Cookie{
+		Name:     "oauth_state",
+		Value:    state,
+		Path:     "/auth",
+		MaxAge:   int(database.OAuthStateLifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, provider.AuthCodeURL(state, codeVerifier, extra), http.StatusSeeOther)
+}
+
+// handleOAuthCallback finishes the login once the provider redirects back with a code
+func handleOAuthCallback(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("provider")
+	if name == "" {
+		// Google was registered with the original /auth/callback redirect URI
+		name = "google"
+	}
+	provider, ok := oauthProviders[name]
+	if !ok || !provider.Enabled() {
+		http.Redirect(w, r, "/404", http.StatusFound)
+		return
+	}
+
+	// Verify the state parameter to protect against CSRF attacks
+	state, err := oauth.CallbackState(r, "oauth_state")
 	if err != nil {
-		http.Error(w, "Failed to read response body", http.StatusInternalServerError)
+		http.Error(w, "Invalid OAuth state", http.StatusBadRequest)
 		return
 	}
+	http.SetCookie(w, &http.Cookie{Name: "oauth_state", Value: "", Path: "/auth", MaxAge: -1})
 
-	// Parse the JSON response to get the access token
-	var tokenResp map[string]interface{}
-	if err := json.Unmarshal(body, &tokenResp); err != nil {
-		http.Error(w, "Failed to parse token response", http.StatusInternalServerError)
+	pending, err := database.ConsumeOAuthState(state)
+	if err != nil || pending.Provider != name {
+		http.Error(w, "Invalid OAuth state", http.StatusBadRequest)
 		return
 	}
 
-	accessToken, ok := tokenResp["access_token"].(string)
-	if !ok {
-		http.Error(w, "Access token not found", http.StatusInternalServerError)
+	// The user declined on the consent screen
+	code := r.URL.Query().Get("code")
+	if r.URL.Query().Get("error") != "" || code == "" {
+		if pending.LinkUserID != 0 {
+			http.Redirect(w, r, "/account", http.StatusSeeOther)
+			return
+		}
+		http.Redirect(w, r, "/auth", http.StatusSeeOther)
 		return
 	}
 
-	setGoogleUserInfo(w, r, accessToken)
-}
+	if err := provider.Discover(r.Context()); err != nil {
+		log.Printf("OAuth %s discovery failed: %v", name, err)
+		http.Error(w, "Login provider is unavailable", http.StatusBadGateway)
+		return
+	}
 
-func setGoogleUserInfo(w http.ResponseWriter, r *http.Request, accessToken string) {
-	userInfoURL := "https://www.googleapis.com/oauth2/v2/userinfo?access_token=" + url.QueryEscape(accessToken)
-	resp, err := http.Get(userInfoURL)
+	token, err := provider.Exchange(r.Context(), code, pending.CodeVerifier)
 	if err != nil {
-		http.Error(w, "Failed to get user info", http.StatusInternalServerError)
+		log.Printf("OAuth %s token exchange failed: %v", name, err)
+		http.Error(w, "Failed to get token", http.StatusInternalServerError)
 		return
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	userInfo, err := provider.Identify(r.Context(), token, pending.Nonce)
 	if err != nil {
-		http.Error(w, "Failed to read user info", http.StatusInternalServerError)
+		log.Printf("OAuth %s identification failed: %v", name, err)
+		http.Error(w, "Failed to get user info", http.StatusInternalServerError)
 		return
 	}
 
-	var userInfo map[string]interface{}
-	if err := json.Unmarshal(body, &userInfo); err != nil {
-		http.Error(w, "Failed to parse user info", http.StatusInternalServerError)
+	if pending.LinkUserID != 0 {
+		completeOAuthLink(w, r, name, pending.LinkUserID, userInfo)
 		return
 	}
+	completeOAuthLogin(w, r, name, userInfo)
+}
 
-	email := userInfo["email"].(string)
-	username := userInfo["name"].(string)
-
-	// Check if user already exists in the database
-	exists, err := database.CheckEmailExists(email)
-	if err != nil {
+// completeOAuthLogin signs in the user linked to a provider identity.
+// Unknown identities are never matched to an account by email or username; they go
+// through the username-picking signup step instead.
+func completeOAuthLogin(w http.ResponseWriter, r *http.Request, providerName string, userInfo *oauth.UserInfo) {
+	userID, err := database.FetchUserIDByIdentity(providerName, userInfo.Subject)
+	if err != nil && err != sql.ErrNoRows {
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
 
-	if !exists {
-		err = database.InsertUser(email, username, "")
+	if err == sql.ErrNoRows {
+		// Accounts created by the old email-matched OAuth login have no identity yet
+		userID, err = database.AdoptLegacyOAuthUser(providerName, userInfo.Subject, userInfo.Email)
 		if err != nil {
-			http.Error(w, "Username already taken", http.StatusInternalServerError)
+			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
 	}
 
-	/// Create a unique session token using gofrs/uuid
-	sessionToken, err := uuid.NewV4() // This generates a new UUID version 4
-	if err != nil {
+	if userID == 0 {
+		exists, err := database.CheckEmailExists(userInfo.Email)
+		if err != nil {
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		if exists {
+			renderLoginPage(w, r, "An account already uses this email. Log in with your password and link "+providerDisplayName(providerName)+" from your account page.")
+			return
+		}
+		if msg := checkRegistrationEmail(userInfo.Email); msg != "" {
+			renderLoginPage(w, r, msg)
+			return
+		}
+
+		startOAuthSignup(w, r, providerName, userInfo)
+		return
+	}
+
+	startOAuthSession(w, r, userID)
+}
+
+// startOAuthSession signs in a user who came back from a provider. Like a password login,
+// an account with two-factor enabled still owes a code before a session is created.
+func startOAuthSession(w http.ResponseWriter, r *http.Request, userID int) {
+	_, twoFactorEnabled, _, err := database.FetchTOTP(userID)
+	if err != nil && err != sql.ErrNoRows {
 		http.Error(w, "Error creating session", http.StatusInternalServerError)
 		return
 	}
+	if twoFactorEnabled {
+		startLoginChallenge(w, r, userID)
+		return
+	}
 
-	// Convert UUID to string for storage
-	err = database.StoreSessionToken(username, sessionToken.String())
+	err = startSession(w, r, userID)
 	if err != nil {
 		http.Error(w, "Error creating session", http.StatusInternalServerError)
 		return
 	}
 
-	// Set the session cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_token",
-		Value:    sessionToken.String(),
-		Expires:  time.Now().Add(1 * time.Hour), // 1 hour only
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   true,                    // Set Secure flag for HTTPS
-	})
-
-
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
-func handleGitHubLogin(w http.ResponseWriter, r *http.Request) {
-	authURL := fmt.Sprintf(
-		"https://github.com/login/oauth/authorize?client_id=%s&redirect_uri=%s&scope=user:email&state=%s",
-		url.QueryEscape(gitclientID),
-		url.QueryEscape(gitRedirectURI),
-		"random",
-	)
-	http.Redirect(w, r, authURL, http.StatusTemporaryRedirect)
-}
-
-func handleGitHubCallback(w http.ResponseWriter, r *http.Request) {
-	if r.URL.Query().Get("state") != "random" {
-		http.Error(w, "Invalid OAuth state", http.StatusBadRequest)
+// completeOAuthLink links a provider identity to the signed-in user who started the flow
+func completeOAuthLink(w http.ResponseWriter, r *http.Request, providerName string, linkUserID int, userInfo *oauth.UserInfo) {
+	cookie, err := r.Cookie("session_token")
+	if err != nil || cookie.Value == "" {
+		http.Redirect(w, r, "/auth", http.StatusSeeOther)
 		return
 	}
-
-	code := r.URL.Query().Get("code")
-	if code == "" {
+	userID, err := database.FetchUserIDBySessionToken(cookie.Value)
+	if err != nil || userID != linkUserID {
 		http.Redirect(w, r, "/auth", http.StatusSeeOther)
+		return
 	}
 
-	tokenURL := "https://github.com/login/oauth/access_token"
-	data := url.Values{}
-	data.Set("client_id", gitclientID)
-	data.Set("client_secret", gitclientSecret)
-	data.Set("code", code)
-	data.Set("redirect_uri", gitRedirectURI)
-
-	req, err := http.NewRequest("POST", tokenURL, strings.NewReader(data.Encode()))
-	if err != nil {
-		http.Error(w, "Failed to create request", http.StatusInternalServerError)
+	err = database.LinkIdentity(userID, providerName, userInfo.Subject, userInfo.Email)
+	if err == database.ErrIdentityTaken {
+		renderAccountPage(w, r, userID, "This "+providerDisplayName(providerName)+" account is already linked to another user.")
 		return
 	}
-	req.Header.Set("Accept", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
 	if err != nil {
-		http.Error(w, "Failed to get token", http.StatusInternalServerError)
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
 		return
 	}
-	defer resp.Body.Close()
 
-	var tokenResp map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
-		http.Error(w, "Failed to parse token response", http.StatusInternalServerError)
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+// startOAuthSignup parks a first-time provider login and asks the user to pick a username
+func startOAuthSignup(w http.ResponseWriter, r *http.Request, providerName string, userInfo *oauth.UserInfo) {
+	signupToken, err := uuid.NewV4()
+	if err != nil {
+		http.Error(w, "Error creating account", http.StatusInternalServerError)
 		return
 	}
 
-	accessToken, ok := tokenResp["access_token"].(string)
-	if !ok {
-		http.Error(w, "Access token not found", http.StatusInternalServerError)
+	err = database.SavePendingSignup(signupToken.String(), models.PendingSignup{
+		Provider:          providerName,
+		Subject:           userInfo.Subject,
+		Email:             userInfo.Email,
+		SuggestedUsername: suggestUsername(userInfo),
+	})
+	if err != nil {
+		http.Error(w, "Error creating account", http.StatusInternalServerError)
 		return
 	}
 
-	// Fetch GitHub user info
-	setGitHubUserInfo(w, r, accessToken)
+	http.SetCookie(w, &http.Cookie{
+		Name:     "signup_token",
+		Value:    signupToken.String(),
+		Path:     "/auth/signup",
+		MaxAge:   int(database.PendingSignupLifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, "/auth/signup", http.StatusSeeOther)
 }
 
-func setGitHubUserInfo(w http.ResponseWriter, r *http.Request, accessToken string) {
-	userInfoURL := "https://api.github.com/user"
-	req, err := http.NewRequest("GET", userInfoURL, nil)
-	if err != nil {
-		http.Error(w, "Failed to create user info request", http.StatusInternalServerError)
+// OAuthSignup lets a first-time OAuth user choose their username before the account is created
+func OAuthSignup(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie("signup_token")
+	if err != nil || cookie.Value == "" {
+		http.Redirect(w, r, "/auth", http.StatusSeeOther)
 		return
 	}
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	signup, err := database.FetchPendingSignup(cookie.Value)
 	if err != nil {
-		http.Error(w, "Failed to get user info", http.StatusInternalServerError)
+		http.Redirect(w, r, "/auth", http.StatusSeeOther)
 		return
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		http.Error(w, "Failed to read user info", http.StatusInternalServerError)
+	if r.Method == http.MethodGet {
+		renderSignupPage(w, r, signup, signup.SuggestedUsername, "")
 		return
 	}
-
-	var userInfo map[string]interface{}
-	if err := json.Unmarshal(body, &userInfo); err != nil {
-		http.Error(w, "Failed to parse user info", http.StatusInternalServerError)
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
 		return
 	}
 
-	username, ok := userInfo["login"].(string)
-	if !ok {
-		http.Error(w, "Username not found", http.StatusInternalServerError)
+	username := strings.TrimSpace(r.FormValue("username"))
+	if valid, msg := ValidateUsername(username); !valid {
+		renderSignupPage(w, r, signup, username, msg)
 		return
 	}
-
-	email, ok := userInfo["email"].(string)
-	if !ok || email == "" {
-		// Optionally fetch the email directly from GitHub API if it's not public
-		email, err = fetchGitHubEmail(accessToken)
-		if err != nil {
-			http.Error(w, "Failed to retrieve email", http.StatusInternalServerError)
-			return
-		}
+	if msg := checkRegistration(signup.Email, r.FormValue("invite_code")); msg != "" {
+		renderSignupPage(w, r, signup, username, msg)
+		return
 	}
 
-	exists, err := database.CheckEmailExists(email)
+	exists, err := database.CheckUsernameExists(username)
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
 		return
 	}
-
-	if !exists {
-		err = database.InsertUser(email, username, "")
-		if err != nil {
-			http.Error(w, "Username already taken", http.StatusInternalServerError)
-			return
-		}
+	if exists {
+		renderSignupPage(w, r, signup, username, "Username already taken")
+		return
 	}
 
-	/// Create a unique session token using gofrs/uuid
-	sessionToken, err := uuid.NewV4() // This generates a new UUID version 4
-	if err != nil {
-		http.Error(w, "Error creating session", http.StatusInternalServerError)
+	userID, err := database.CreateOAuthUser(signup.Email, username, signup.Provider, signup.Subject, signupInviteCode(r.FormValue("invite_code")))
+	if err == database.ErrInviteInvalid {
+		renderSignupPage(w, r, signup, username, "This invite code is not valid, or it has expired or been used up.")
 		return
 	}
-
-	// Convert UUID to string for storage
-	err = database.StoreSessionToken(username, sessionToken.String())
 	if err != nil {
-		http.Error(w, "Error creating session", http.StatusInternalServerError)
+		renderSignupPage(w, r, signup, username, "Could not create the account, the email or username may already be in use")
 		return
 	}
 
-	// Set the session cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_token",
-		Value:    sessionToken.String(),
-		Expires:  time.Now().Add(1 * time.Hour), // 1 hour only
-		Path:     "/",
-		HttpOnly: true,
-	})
+	if err := database.DeletePendingSignup(cookie.Value); err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: "signup_token", Value: "", Path: "/auth/signup", MaxAge: -1})
 
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	startOAuthSession(w, r, userID)
 }
 
-func fetchGitHubEmail(accessToken string) (string, error) {
-	req, err := http.NewRequest("GET", "https://api.github.com/user/emails", nil)
-	if err != nil {
-		return "", err
-	}
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// renderSignupPage renders the username-picking step of an OAuth signup
+func renderSignupPage(w http.ResponseWriter, r *http.Request, signup models.PendingSignup, username, errorMessage string) {
+	data := struct {
+		ProviderName string
+		Email        string
+		Username     string
+		ErrorMessage string
+		Registration registrationView
+	}{
+		ProviderName: providerDisplayName(signup.Provider),
+		Email:        signup.Email,
+		Username:     username,
+		ErrorMessage: errorMessage,
+		Registration: registrationPageData(r),
+	}
+
+	err := templates.ExecuteTemplate(w, "signup.html", data)
 	if err != nil {
-		return "", err
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
 	}
-	defer resp.Body.Close()
+}
 
-	var emails []struct {
-		Email    string `json:"email"`
-		Primary  bool   `json:"primary"`
-		Verified bool   `json:"verified"`
+// suggestUsername derives a valid username from the provider profile, falling back to the email
+func suggestUsername(userInfo *oauth.UserInfo) string {
+	clean := func(s string) string {
+		var b strings.Builder
+		for _, c := range s {
+			if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '.' {
+				b.WriteRune(c)
+			}
+		}
+		if b.Len() > 50 {
+			return b.String()[:50]
+		}
+		return b.String()
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&emails); err != nil {
-		return "", err
+	if username := clean(userInfo.Username); len(username) >= 3 {
+		return username
 	}
+	localPart, _, _ := strings.Cut(userInfo.Email, "@")
+	return clean(localPart)
+}
 
-	// Check for the first verified, primary email
-	for _, email := range emails {
-		if email.Primary && email.Verified {
-			return email.Email, nil
+// loginProviders lists the enabled providers as buttons for the authentication page
+func loginProviders() []models.LoginProvider {
+	var providers []models.LoginProvider
+	for name, provider := range oauthProviders {
+		if !provider.Enabled() {
+			continue
+		}
+		icon := provider.Config.Icon
+		if icon == "" {
+			icon = "bx-log-in-circle"
 		}
+		providers = append(providers, models.LoginProvider{
+			Name:        name,
+			DisplayName: providerDisplayName(name),
+			Icon:        icon,
+		})
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i].DisplayName < providers[j].DisplayName })
+	return providers
+}
+
+// providerDisplayName returns the human readable name of a provider
+func providerDisplayName(name string) string {
+	if provider, ok := oauthProviders[name]; ok && provider.Config.DisplayName != "" {
+		return provider.Config.DisplayName
 	}
-	return "", fmt.Errorf("no primary verified email found")
+	return name
 }
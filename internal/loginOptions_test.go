@@ -0,0 +1,215 @@
+package root
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"root/internal/config"
+	database "root/internal/database"
+	"root/internal/oauth"
+	"root/internal/oauth/oauthtest"
+	"strings"
+	"testing"
+)
+
+const fakeRedirectURL = "https://forum.test/auth/fake/callback"
+
+// openScratchDB points the database package at a migrated scratch database in a temporary
+// directory. The migrations are read relative to the repository root.
+func openScratchDB(t *testing.T) {
+	t.Helper()
+	if !database.FullTextSearch {
+		t.Skip("the login handler tests need the FTS5 driver; run them with -tags sqlite_fts5")
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(".."); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	database.OpenFile(filepath.Join(t.TempDir(), "forum.db"))
+	if _, err := database.MigrateUp(false, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// useFakeProvider makes the fake the only login provider, called "fake", for the test
+func useFakeProvider(t *testing.T, f *oauthtest.Provider, cfg config.OAuthProvider) {
+	t.Helper()
+	provider := oauth.NewProvider("fake", cfg)
+	provider.HTTPClient = f.Server.Client()
+
+	previous := oauthProviders
+	oauthProviders = map[string]*oauth.Provider{"fake": provider}
+	t.Cleanup(func() { oauthProviders = previous })
+}
+
+// startOAuthLogin runs handleOAuthLogin and the fake consent screen like a browser, and
+// returns the callback the provider sends the browser to and the state cookie it was given
+func startOAuthLogin(t *testing.T, f *oauthtest.Provider) (*url.URL, *http.Cookie) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/auth/fake/login", nil)
+	r.SetPathValue("provider", "fake")
+	w := httptest.NewRecorder()
+	handleOAuthLogin(w, r)
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("login answered %d, want a redirect to the provider", resp.StatusCode)
+	}
+	var state *http.Cookie
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == "oauth_state" {
+			state = cookie
+		}
+	}
+	if state == nil {
+		t.Fatal("login set no state cookie")
+	}
+	return f.Authorize(resp.Header.Get("Location")), state
+}
+
+// finishOAuthLogin runs handleOAuthCallback for the browser's request to callback
+func finishOAuthLogin(callback *url.URL, state *http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, callback.String(), nil)
+	r.SetPathValue("provider", "fake")
+	if state != nil {
+		r.AddCookie(&http.Cookie{Name: state.Name, Value: state.Value})
+	}
+	w := httptest.NewRecorder()
+	handleOAuthCallback(w, r)
+	return w
+}
+
+// expectSignup checks that a callback went on to the username-picking step for email
+func expectSignup(t *testing.T, w *httptest.ResponseRecorder, email string) {
+	t.Helper()
+	resp := w.Result()
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/auth/signup" {
+		t.Fatalf("callback answered %d to %q: %s", resp.StatusCode, resp.Header.Get("Location"), w.Body)
+	}
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name != "signup_token" {
+			continue
+		}
+		signup, err := database.FetchPendingSignup(cookie.Value)
+		if err != nil {
+			t.Fatalf("FetchPendingSignup: %v", err)
+		}
+		if signup.Email != email {
+			t.Fatalf("signing up with %q, want %q", signup.Email, email)
+		}
+		return
+	}
+	t.Fatal("callback set no signup cookie")
+}
+
+// expectRefused checks that a callback was answered with status and an error mentioning want
+func expectRefused(t *testing.T, w *httptest.ResponseRecorder, status int, want string) {
+	t.Helper()
+	if w.Code != status || !strings.Contains(w.Body.String(), want) {
+		t.Fatalf("callback answered %d %q, want %d %q", w.Code, strings.TrimSpace(w.Body.String()), status, want)
+	}
+}
+
+func TestOAuthCallbackCannotBeReplayed(t *testing.T) {
+	openScratchDB(t)
+	f := oauthtest.New(t)
+	useFakeProvider(t, f, f.OIDCConfig(fakeRedirectURL))
+
+	callback, state := startOAuthLogin(t, f)
+	expectSignup(t, finishOAuthLogin(callback, state), "ada@example.com")
+
+	// The state was consumed, so the forum refuses before the provider is asked about the code
+	expectRefused(t, finishOAuthLogin(callback, state), http.StatusBadRequest, "Invalid OAuth state")
+}
+
+func TestOAuthCallbackStateMismatch(t *testing.T) {
+	openScratchDB(t)
+	f := oauthtest.New(t)
+	useFakeProvider(t, f, f.OIDCConfig(fakeRedirectURL))
+
+	callback, state := startOAuthLogin(t, f)
+	_, otherState := startOAuthLogin(t, f)
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+	}{
+		{"state cookie of another login", otherState},
+		{"no state cookie", nil},
+		{"state cookie that was never issued", &http.Cookie{Name: "oauth_state", Value: "forged"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectRefused(t, finishOAuthLogin(callback, tt.cookie), http.StatusBadRequest, "Invalid OAuth state")
+		})
+	}
+
+	// The refused callbacks did not use up the login they tried to hijack
+	expectSignup(t, finishOAuthLogin(callback, state), "ada@example.com")
+}
+
+func TestOAuthCallbackGitHubEmails(t *testing.T) {
+	tests := []struct {
+		name     string
+		userInfo map[string]any
+		emails   []oauthtest.Email
+		want     string
+	}{
+		{
+			name:     "public email",
+			userInfo: map[string]any{"id": 42, "login": "ada", "email": "ada@example.com"},
+			want:     "ada@example.com",
+		},
+		{
+			name:     "private email from the primary verified address",
+			userInfo: map[string]any{"id": 42, "login": "ada", "email": nil},
+			emails: []oauthtest.Email{
+				{Email: "old@example.com", Verified: true},
+				{Email: "ada@example.com", Primary: true, Verified: true},
+			},
+			want: "ada@example.com",
+		},
+		{
+			name:     "unverified public email",
+			userInfo: map[string]any{"id": 42, "login": "ada", "email": "ada@example.com", "email_verified": false},
+			emails:   []oauthtest.Email{{Email: "ada@example.org", Primary: true, Verified: true}},
+			want:     "ada@example.org",
+		},
+		{
+			name:     "primary address not verified",
+			userInfo: map[string]any{"id": 42, "login": "ada", "email": nil},
+			emails: []oauthtest.Email{
+				{Email: "ada@example.com", Primary: true},
+				{Email: "old@example.com", Verified: true},
+			},
+		},
+		{
+			name:     "no addresses",
+			userInfo: map[string]any{"id": 42, "login": "ada"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openScratchDB(t)
+			f := oauthtest.New(t)
+			f.UserInfo = tt.userInfo
+			f.Emails = tt.emails
+			useFakeProvider(t, f, f.GitHubConfig(fakeRedirectURL))
+
+			w := finishOAuthLogin(startOAuthLogin(t, f))
+			if tt.want == "" {
+				expectRefused(t, w, http.StatusInternalServerError, "Failed to get user info")
+				return
+			}
+			expectSignup(t, w, tt.want)
+		})
+	}
+}
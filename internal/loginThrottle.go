@@ -0,0 +1,110 @@
+package root
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	database "root/internal/database"
+	"root/internal/throttle"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ipLoginThrottle slows down a single address guessing passwords for many accounts
+	ipLoginThrottle = throttle.New(throttle.Policy{
+		FreeAttempts:    10,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		LockoutAfter:    50,
+		LockoutDuration: time.Hour,
+		ForgetAfter:     time.Hour,
+	}, throttle.SystemClock{})
+
+	// usernameLoginThrottle slows down guessing the password of one account from many addresses
+	usernameLoginThrottle = throttle.New(throttle.Policy{
+		FreeAttempts:    3,
+		BaseDelay:       2 * time.Second,
+		MaxDelay:        5 * time.Minute,
+		LockoutAfter:    10,
+		LockoutDuration: 15 * time.Minute,
+		ForgetAfter:     time.Hour,
+	}, throttle.SystemClock{})
+)
+
+// loginThrottleKey normalizes a username so case variations share one counter
+func loginThrottleKey(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// reserveLoginAttempt tells whether a login for username from this request may be tried now,
+// counting it as a failed attempt against the address and the username before the password
+// is checked, so parallel guesses cannot all get through before the first one is counted.
+// When it may not, it answers with 429 and an explanation on the login page.
+func reserveLoginAttempt(w http.ResponseWriter, r *http.Request, username string) bool {
+	wait, locked := ipLoginThrottle.Attempt(clientIP(r))
+	if wait <= 0 {
+		wait, locked = usernameLoginThrottle.Attempt(loginThrottleKey(username))
+		if wait > 0 {
+			// Only attempts that get through are counted
+			ipLoginThrottle.Refund(clientIP(r))
+		}
+	}
+	if wait <= 0 {
+		return true
+	}
+
+	auditFailedLogin(r, username, "throttled")
+
+	message := "Too many failed login attempts. Please wait " + describeWait(wait) + " before trying again."
+	if locked {
+		message = "Too many failed login attempts, logins are locked for " + describeWait(wait) + "."
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	w.WriteHeader(http.StatusTooManyRequests)
+	renderLoginPage(w, r, message)
+	return false
+}
+
+// passwordAccepted gives back the attempt reserveLoginAttempt counted once the password
+// turns out to be right; a second factor that is still owed is counted on its own
+func passwordAccepted(r *http.Request, username string) {
+	ipLoginThrottle.Refund(clientIP(r))
+	usernameLoginThrottle.Refund(loginThrottleKey(username))
+}
+
+// loginFailed counts a failed attempt that was not reserved, such as a wrong second factor,
+// against both the address and the username
+func loginFailed(r *http.Request, username, reason string) {
+	ipLoginThrottle.Failure(clientIP(r))
+	usernameLoginThrottle.Failure(loginThrottleKey(username))
+	auditFailedLogin(r, username, reason)
+}
+
+// loginSucceeded clears the username's failures. The address keeps its count, so one
+// working account cannot be used to reset the counter while guessing others.
+func loginSucceeded(username string) {
+	usernameLoginThrottle.Success(loginThrottleKey(username))
+}
+
+// auditFailedLogin writes the audit record of a rejected attempt
+func auditFailedLogin(r *http.Request, username, reason string) {
+	if err := database.RecordFailedLogin(username, clientIP(r), r.UserAgent(), reason); err != nil {
+		log.Printf("Recording failed login failed: %v", err)
+	}
+}
+
+// describeWait formats a wait for people, rounding up to whole seconds or minutes
+func describeWait(d time.Duration) string {
+	if d <= time.Minute {
+		seconds := int(math.Ceil(d.Seconds()))
+		if seconds == 1 {
+			return "1 second"
+		}
+		return fmt.Sprintf("%d seconds", seconds)
+	}
+	minutes := int(math.Ceil(d.Minutes()))
+	return fmt.Sprintf("%d minutes", minutes)
+}
@@ -0,0 +1,30 @@
+package root
+
+import (
+	"root/internal/config"
+	"root/internal/mail"
+	"strings"
+)
+
+var (
+	// mailer sends the forum's account emails
+	mailer mail.Mailer
+	// baseURL is the public address used to build links in emails and link previews
+	baseURL string
+)
+
+// setupMailer builds the mail transport from the loaded configuration
+func setupMailer(cfg *config.Config) error {
+	m, err := mail.New(cfg.Mail)
+	if err != nil {
+		return err
+	}
+	mailer = m
+	baseURL = strings.TrimSuffix(cfg.BaseURL, "/")
+	return nil
+}
+
+// absoluteURL turns a site path into a link that works outside the forum, such as in an email
+func absoluteURL(path string) string {
+	return baseURL + path
+}
@@ -0,0 +1,248 @@
+// Package migrate applies numbered SQL migrations to a database and records them in
+// the schema_migrations table. Migrations live in a directory as pairs of files named
+// <version>_<name>.up.sql and <version>_<name>.down.sql, e.g. 0002_add_roles.up.sql.
+package migrate
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Migration is one numbered schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	// Down undoes Up; it is empty when the migration cannot be rolled back
+	Down string
+}
+
+// ID returns the version and name as they appear in the file names, e.g. "0002_add_roles"
+func (m Migration) ID() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// Checksum identifies the up script, so edits to an applied migration can be noticed
+func (m Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+// State is a migration together with whether and when it was applied
+type State struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+	// Modified is set when the up script changed after it was applied
+	Modified bool
+}
+
+// fileName matches migration files such as 0002_add_roles.up.sql
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Load reads the migrations in dir, ordered by version
+func Load(dir string) ([]Migration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migrate: unexpected file %s in %s", entry.Name(), dir)
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migrate: bad version in %s", entry.Name())
+		}
+		body, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migrate: version %d is used by both %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migrate: %s has no up script", m.ID())
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Initialized reports whether the schema_migrations table exists yet
+func Initialized(db *sql.DB) (bool, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'").Scan(&n)
+	return n > 0, err
+}
+
+// ensureTable creates the schema_migrations table
+func ensureTable(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			applied_at DATETIME NOT NULL
+		)`)
+	return err
+}
+
+// Status returns every known migration with its state, plus the IDs of migrations
+// recorded in the database that no longer have a file
+func Status(db *sql.DB, migrations []Migration) ([]State, []string, error) {
+	initialized, err := Initialized(db)
+	if err != nil || !initialized {
+		states := make([]State, len(migrations))
+		for i, m := range migrations {
+			states[i] = State{Migration: m}
+		}
+		return states, nil, err
+	}
+
+	rows, err := db.Query("SELECT version, name, checksum, applied_at FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	type applied struct {
+		name, checksum string
+		at             time.Time
+	}
+	done := map[int]applied{}
+	for rows.Next() {
+		var version int
+		var a applied
+		if err := rows.Scan(&version, &a.name, &a.checksum, &a.at); err != nil {
+			return nil, nil, err
+		}
+		done[version] = a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	states := make([]State, len(migrations))
+	for i, m := range migrations {
+		states[i] = State{Migration: m}
+		if a, ok := done[m.Version]; ok {
+			states[i].Applied = true
+			states[i].AppliedAt = a.at
+			states[i].Modified = a.checksum != m.Checksum()
+			delete(done, m.Version)
+		}
+	}
+
+	var unknown []string
+	for version, a := range done {
+		unknown = append(unknown, fmt.Sprintf("%04d_%s", version, a.name))
+	}
+	sort.Strings(unknown)
+	return states, unknown, nil
+}
+
+// Pending returns the migrations that have not been applied, oldest first
+func Pending(db *sql.DB, migrations []Migration) ([]Migration, error) {
+	states, _, err := Status(db, migrations)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, s := range states {
+		if !s.Applied {
+			pending = append(pending, s.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// Applied returns the applied migrations, newest first, which is the order they are rolled back in
+func Applied(db *sql.DB, migrations []Migration) ([]Migration, error) {
+	states, unknown, err := Status(db, migrations)
+	if err != nil {
+		return nil, err
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("migrate: the database has migrations without files: %v", unknown)
+	}
+	var applied []Migration
+	for i := len(states) - 1; i >= 0; i-- {
+		if states[i].Applied {
+			applied = append(applied, states[i].Migration)
+		}
+	}
+	return applied, nil
+}
+
+// Apply runs the up script of m and records it, all in one transaction
+func Apply(db *sql.DB, m Migration) error {
+	if err := ensureTable(db); err != nil {
+		return err
+	}
+	return inTx(db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(m.Up); err != nil {
+			return fmt.Errorf("migrate: applying %s: %w", m.ID(), err)
+		}
+		_, err := tx.Exec("INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)",
+			m.Version, m.Name, m.Checksum(), time.Now().UTC())
+		return err
+	})
+}
+
+// Revert runs the down script of m and forgets it, all in one transaction
+func Revert(db *sql.DB, m Migration) error {
+	if m.Down == "" {
+		return fmt.Errorf("migrate: %s has no down script and cannot be rolled back", m.ID())
+	}
+	return inTx(db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(m.Down); err != nil {
+			return fmt.Errorf("migrate: rolling back %s: %w", m.ID(), err)
+		}
+		_, err := tx.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version)
+		return err
+	})
+}
+
+// inTx runs fn in a transaction, committing only when it succeeds
+func inTx(db *sql.DB, fn func(*sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
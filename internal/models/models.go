@@ -3,37 +3,21 @@ package models
 import "time"
 
 type Data struct {
-	UserProfile     []UserProfile
-	Post            []Post
-	MemesPosts      []MemesPosts
-	GamingPosts     []GamingPosts
-	EducationPosts  []EducationPosts
-	TechnologyPosts []TechnologyPosts
-	SciencePosts    []SciencePosts
-	SportsPosts     []SportsPosts
+	CSRFToken   string
+	UserProfile []UserProfile
+	Post        []Post
+	// Feed links the feed pages around Post and the feed in other orders
+	Feed ListNav
+	// Threads are the posts shown anywhere on the page, each with comments that open over it
+	Threads    []Post
+	Categories []Category
+	// PostCategories are the categories a new post can be filed under
+	PostCategories []Category
 }
 
 // Post represents a post with user and content information
 type Post struct {
-	ID         int
-	UserID     int
-	Username   string
-	Content    string
-	CreatedAt  time.Time
-	FormatDate string
-	Media      []Media
-	Likes      int
-	Dislikes   int
-	LikeIcon string
-	DislikeIcon string
-	ProfileColor string
-	ComCount   int
-	Comment    []Comment
-}
-
-type MemesPosts struct {
-	CategoriesID int
-	PostID       int
+	ID           int
 	UserID       int
 	Username     string
 	Content      string
@@ -42,115 +26,91 @@ type MemesPosts struct {
 	Media        []Media
 	Likes        int
 	Dislikes     int
-	LikeIcon string
-	DislikeIcon string
+	LikeIcon     string
+	DislikeIcon  string
 	ProfileColor string
 	ComCount     int
 	Comment      []Comment
+	CanDelete    bool
+	// Cursor marks the post's place in a list; the pages before and after it start there
+	Cursor string
 }
 
-type GamingPosts struct {
-	CategoriesID int
-	PostID       int
-	UserID       int
-	Username     string
-	Content      string
-	CreatedAt    time.Time
-	FormatDate   string
-	Media        []Media
-	Likes        int
-	Dislikes     int
-	LikeIcon string
-	DislikeIcon string
-	ProfileColor string
-	ComCount     int
-	Comment      []Comment
+// PostPage is one page of a post list. Next and Prev are the cursors of the pages of older
+// and newer posts, empty when there is none.
+type PostPage struct {
+	Posts []Post
+	Next  string
+	Prev  string
 }
 
-type EducationPosts struct {
-	CategoriesID int
-	PostID       int
-	UserID       int
-	Username     string
-	Content      string
-	CreatedAt    time.Time
-	FormatDate   string
-	Media        []Media
-	Likes        int
-	Dislikes     int
-	LikeIcon string
-	DislikeIcon string
-	ProfileColor string
-	ComCount     int
-	Comment      []Comment
+// ListNav is what a page of a sortable post list links to: the pages before and after it in
+// the same order, empty when there is none, the address of the fragment that loads the next
+// page in place, and tabs listing the posts in other orders
+type ListNav struct {
+	NextURL      string
+	PrevURL      string
+	NextFragment string
+	SortModes    []SortLink
+	SortWindows  []SortLink
 }
 
-type TechnologyPosts struct {
-	CategoriesID int
-	PostID       int
-	UserID       int
-	Username     string
-	Content      string
-	CreatedAt    time.Time
-	FormatDate   string
-	Media        []Media
-	Likes        int
-	Dislikes     int
-	LikeIcon string
-	DislikeIcon string
-	ProfileColor string
-	ComCount     int
-	Comment      []Comment
+// SortLink is a tab that lists posts in a sort mode or over a top window
+type SortLink struct {
+	Label  string
+	URL    string
+	Active bool
 }
 
-type SciencePosts struct {
-	CategoriesID int
-	PostID       int
-	UserID       int
+// SearchResult is a post or comment matching a search, with a snippet of its text in which
+// the matched words are marked
+type SearchResult struct {
+	PostID int
+	// CommentID is 0 when the match is the post itself
+	CommentID    int
 	Username     string
-	Content      string
+	ProfileColor string
+	Snippet      string
 	CreatedAt    time.Time
 	FormatDate   string
-	Media        []Media
 	Likes        int
 	Dislikes     int
-	LikeIcon string
-	DislikeIcon string
-	ProfileColor string
-	ComCount     int
-	Comment      []Comment
+	// Cursor marks the result's place among the results
+	Cursor string
 }
 
-type SportsPosts struct {
-	CategoriesID int
-	PostID       int
-	UserID       int
-	Username     string
-	Content      string
-	CreatedAt    time.Time
-	FormatDate   string
-	Media        []Media
-	Likes        int
-	Dislikes     int
-	LikeIcon string
-	DislikeIcon string
-	ProfileColor string
-	ComCount     int
-	Comment      []Comment
+// SearchPage is one page of search results, best first. Next and Prev are the cursors of the
+// pages of worse and better matches, empty when there is none.
+type SearchPage struct {
+	Results []SearchResult
+	Next    string
+	Prev    string
 }
 
 type Comment struct {
-	ComID         int
-	PostID        int
-	ComUsername   string
-	ComContent    string
-	ComCreatedAt  time.Time
-	ComFormatDate string
-	ComLikes      int
-	ComDislikes   int
-	ComLikeIcon 	  string
+	ComID          int
+	PostID         int
+	ComUsername    string
+	ComContent     string
+	ComCreatedAt   time.Time
+	ComFormatDate  string
+	ComLikes       int
+	ComDislikes    int
+	ComLikeIcon    string
 	ComDislikeIcon string
-	ComProfile string
+	ComProfile     string
+	ComUserID      int
+	ComCanDelete   bool
+	// ComCursor marks the comment's place among the post's comments
+	ComCursor string
+}
+
+// CommentPage is one page of the comments on a post. Next and Prev are the cursors of the
+// pages of older and newer comments, empty when there is none.
+type CommentPage struct {
+	Comments []Comment
+	Next     string
+	Prev     string
 }
 
 // UserProfile struct to hold user profile data, including posts liked, created, and disliked
@@ -158,9 +118,9 @@ type UserProfile struct {
 	UserID        int
 	Username      string
 	ProfileColor  string
-	LikedPosts    []Post
-	CreatedPosts  []Post
-	DislikedPosts []Post
+	LikedPosts    PostPage
+	CreatedPosts  PostPage
+	DislikedPosts PostPage
 }
 
 // Media represents a media file linked to a post
@@ -168,3 +128,116 @@ type Media struct {
 	FilePath string
 	FileType string
 }
+
+// Session represents one signed-in device of a user
+type Session struct {
+	ID             int
+	UserAgent      string
+	Device         string
+	IPAddress      string
+	CreatedAt      time.Time
+	LastSeenAt     time.Time
+	FormatLastSeen string
+	Current        bool
+}
+
+// OAuthState is a pending OAuth login, remembered between the redirect and the callback
+type OAuthState struct {
+	Provider     string
+	CodeVerifier string
+	// LinkUserID is set when a signed-in user is linking the provider to their account
+	LinkUserID int
+	// Nonce is echoed back in the ID token of OpenID Connect providers
+	Nonce string
+}
+
+// RecoveryCode is a hashed two-factor recovery code that has not been used yet
+type RecoveryCode struct {
+	ID   int
+	Hash string
+}
+
+// LoginProvider is a login button on the authentication page
+type LoginProvider struct {
+	Name        string
+	DisplayName string
+	Icon        string
+}
+
+// Identity is an external login (Google, GitHub, ...) linked to a forum account
+type Identity struct {
+	Provider        string
+	ProviderName    string
+	Email           string
+	Linked          bool
+	FormatCreatedAt string
+}
+
+// PendingSignup is a first-time OAuth login waiting for the user to pick a username
+type PendingSignup struct {
+	Provider          string
+	Subject           string
+	Email             string
+	SuggestedUsername string
+}
+
+// Invite is an invite code as listed on the admin invite page. The code itself is only
+// shown when it is created; CodeHint is enough to tell invites apart afterwards.
+type Invite struct {
+	ID            int
+	CodeHint      string
+	Note          string
+	CreatedBy     string
+	MaxUses       int
+	Uses          int
+	ExpiresAt     time.Time
+	Revoked       bool
+	CreatedAt     time.Time
+	FormatCreated string
+	FormatExpires string
+	Status        string
+	Invitees      []string
+}
+
+// APIToken is a personal access token as listed on the account page; the token itself is only shown once
+type APIToken struct {
+	ID             int
+	Name           string
+	Scopes         []string
+	CreatedAt      time.Time
+	FormatCreated  string
+	FormatLastUsed string
+	FormatExpires  string
+	Expired        bool
+}
+
+// Category is a post category; Posts is only filled in where the category's posts are shown
+type Category struct {
+	ID          int
+	Name        string
+	Slug        string
+	Description string
+	Icon        string
+	// Color is a CSS hex color for the icon, or empty for the theme's color
+	Color     string
+	SortOrder int
+	// Archived categories keep their posts but take no new ones, and posts filed
+	// only under archived categories take no new comments or votes
+	Archived bool
+	// ParentID is the category this one is nested under, or 0 at the top level
+	ParentID int
+	Posts    []Post
+	// PostCount and LastActivity cover the category and everything nested under it;
+	// they are only filled in where they are shown
+	PostCount          int
+	LastActivity       time.Time
+	FormatLastActivity string
+}
+
+// StaffMember is an account with a role above user or with categories to moderate
+type StaffMember struct {
+	ID         int
+	Username   string
+	Role       string
+	Categories []Category
+}
@@ -0,0 +1,368 @@
+package oauth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"root/internal/config"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Provider is an OAuth2 authorization code provider configured from config.OAuthProvider.
+// Providers with an issuer are OpenID Connect providers; call Discover before using them.
+type Provider struct {
+	Name   string
+	Config config.OAuthProvider
+	// HTTPClient is used for the back-channel token and user info requests
+	HTTPClient *http.Client
+
+	mu            sync.Mutex
+	discovered    bool
+	endpoints     endpoints
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+}
+
+// endpoints are the URLs in use, either configured or discovered
+type endpoints struct {
+	auth, token, userInfo, jwks string
+}
+
+// Token is the part of a token endpoint response the forum cares about
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+}
+
+// UserInfo is the normalized identity returned by a provider
+type UserInfo struct {
+	Subject  string
+	Email    string
+	Username string
+}
+
+// NewProvider returns a provider with a client that times out slow identity providers
+func NewProvider(name string, cfg config.OAuthProvider) *Provider {
+	if cfg.Issuer != "" {
+		// Standard OpenID Connect claims, unless the config says otherwise
+		if cfg.SubjectField == "" {
+			cfg.SubjectField = "sub"
+		}
+		if cfg.EmailField == "" {
+			cfg.EmailField = "email"
+		}
+		if cfg.UsernameField == "" {
+			cfg.UsernameField = "preferred_username"
+		}
+		if len(cfg.Scopes) == 0 {
+			cfg.Scopes = []string{"openid", "email", "profile"}
+		}
+	}
+
+	return &Provider{
+		Name:       name,
+		Config:     cfg,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		endpoints: endpoints{
+			auth:     cfg.AuthURL,
+			token:    cfg.TokenURL,
+			userInfo: cfg.UserInfoURL,
+		},
+	}
+}
+
+// Enabled reports whether the provider has enough configuration to be offered to users
+func (p *Provider) Enabled() bool {
+	if p.IsOIDC() {
+		return p.Config.ClientID != ""
+	}
+	return p.Config.ClientID != "" && p.Config.AuthURL != "" && p.Config.TokenURL != ""
+}
+
+// RandomString returns n random bytes encoded as unpadded base64url
+func RandomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// NewPKCEVerifier returns a fresh RFC 7636 code verifier
+func NewPKCEVerifier() (string, error) {
+	return RandomString(32)
+}
+
+// PKCEChallenge derives the S256 code challenge for a verifier
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL builds the URL the browser is sent to in order to start the login.
+// Extra parameters (e.g. an OpenID Connect nonce) are appended as given.
+func (p *Provider) AuthCodeURL(state, codeVerifier string, extra url.Values) string {
+	params := url.Values{}
+	params.Set("client_id", p.Config.ClientID)
+	params.Set("redirect_uri", p.Config.RedirectURL)
+	params.Set("response_type", "code")
+	params.Set("scope", strings.Join(p.Config.Scopes, " "))
+	params.Set("state", state)
+	params.Set("code_challenge", PKCEChallenge(codeVerifier))
+	params.Set("code_challenge_method", "S256")
+	for key, values := range extra {
+		for _, v := range values {
+			params.Add(key, v)
+		}
+	}
+
+	separator := "?"
+	if strings.Contains(p.endpoints.auth, "?") {
+		separator = "&"
+	}
+	return p.endpoints.auth + separator + params.Encode()
+}
+
+// ErrInvalidState means a callback's state is missing or is not the one its browser was given
+var ErrInvalidState = errors.New("invalid OAuth state")
+
+// CallbackState returns the state of a provider's callback request once it matches the state
+// cookie set in the browser when the login started. A state that matches must still be
+// looked up and consumed, so it cannot be replayed.
+func CallbackState(r *http.Request, cookieName string) (string, error) {
+	state := r.URL.Query().Get("state")
+	cookie, err := r.Cookie(cookieName)
+	if state == "" || err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		return "", ErrInvalidState
+	}
+	return state, nil
+}
+
+// Exchange trades an authorization code for a token, proving possession of the PKCE verifier
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (*Token, error) {
+	data := url.Values{}
+	data.Set("grant_type", "authorization_code")
+	data.Set("code", code)
+	data.Set("redirect_uri", p.Config.RedirectURL)
+	data.Set("client_id", p.Config.ClientID)
+	data.Set("client_secret", p.Config.ClientSecret)
+	data.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoints.token, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	status, body, err := p.send(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+
+	var tokenResp struct {
+		Token
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	// Error responses carry a JSON body too (GitHub even uses a 200 status for them)
+	decodeErr := json.Unmarshal(body, &tokenResp)
+	if tokenResp.Error != "" {
+		return nil, fmt.Errorf("token request rejected: %s %s", tokenResp.Error, tokenResp.ErrorDescription)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("token request failed: unexpected status %d", status)
+	}
+	if decodeErr != nil {
+		return nil, fmt.Errorf("token response is not valid JSON: %w", decodeErr)
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, errors.New("token response has no access token")
+	}
+	return &tokenResp.Token, nil
+}
+
+// Identify returns the identity of the user who just logged in.
+// OpenID Connect providers are identified by their verified ID token, which must carry
+// the nonce sent with the authorization request; other providers by their user info endpoint.
+func (p *Provider) Identify(ctx context.Context, token *Token, nonce string) (*UserInfo, error) {
+	if !p.IsOIDC() {
+		return p.FetchUserInfo(ctx, token)
+	}
+
+	if token.IDToken == "" {
+		return nil, errors.New("token response has no ID token")
+	}
+	claims, err := p.VerifyIDToken(ctx, token.IDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	info := p.userInfoFromClaims(claims)
+	if info.Subject == "" {
+		return nil, errors.New("ID token has no subject")
+	}
+
+	// Many providers keep the ID token small and only return the email from user info
+	if info.Email == "" && p.endpoints.userInfo != "" {
+		claims, err := p.fetchUserInfoClaims(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		extra := p.userInfoFromClaims(claims)
+		if extra.Subject != info.Subject {
+			return nil, errors.New("user info subject does not match the ID token")
+		}
+		info.Email = extra.Email
+		if info.Username == "" {
+			info.Username = extra.Username
+		}
+	}
+	if info.Email == "" {
+		return nil, errors.New("user info has no verified email")
+	}
+	return info, nil
+}
+
+// FetchUserInfo loads the user's identity from the provider's user info endpoint
+func (p *Provider) FetchUserInfo(ctx context.Context, token *Token) (*UserInfo, error) {
+	claims, err := p.fetchUserInfoClaims(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	info := p.userInfoFromClaims(claims)
+	if info.Subject == "" {
+		return nil, errors.New("user info has no subject")
+	}
+
+	if info.Email == "" && p.Config.EmailsURL != "" {
+		info.Email, err = p.fetchPrimaryEmail(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if info.Email == "" {
+		return nil, errors.New("user info has no email")
+	}
+	return info, nil
+}
+
+// fetchUserInfoClaims calls the user info endpoint with the access token
+func (p *Provider) fetchUserInfoClaims(ctx context.Context, token *Token) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.endpoints.userInfo, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	req.Header.Set("Accept", "application/json")
+
+	var claims map[string]interface{}
+	if err := p.doJSON(req, &claims); err != nil {
+		return nil, fmt.Errorf("user info request failed: %w", err)
+	}
+	return claims, nil
+}
+
+// userInfoFromClaims maps provider claims onto a UserInfo using the configured field names.
+// An email the provider explicitly reports as unverified is ignored.
+func (p *Provider) userInfoFromClaims(claims map[string]interface{}) *UserInfo {
+	info := &UserInfo{
+		Subject:  claimString(claims, p.Config.SubjectField),
+		Email:    claimString(claims, p.Config.EmailField),
+		Username: claimString(claims, p.Config.UsernameField),
+	}
+	if verified, ok := claims["email_verified"].(bool); ok && !verified {
+		info.Email = ""
+	}
+	return info
+}
+
+// fetchPrimaryEmail reads a GitHub style list of emails and returns the primary verified one
+func (p *Provider) fetchPrimaryEmail(ctx context.Context, token *Token) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.Config.EmailsURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	req.Header.Set("Accept", "application/json")
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := p.doJSON(req, &emails); err != nil {
+		return "", fmt.Errorf("email request failed: %w", err)
+	}
+
+	// Check for the first verified, primary email
+	for _, email := range emails {
+		if email.Primary && email.Verified {
+			return email.Email, nil
+		}
+	}
+	return "", errors.New("no primary verified email found")
+}
+
+// doJSON sends the request and decodes a successful JSON response into v
+func (p *Provider) doJSON(req *http.Request, v interface{}) error {
+	status, body, err := p.send(req)
+	if err != nil {
+		return err
+	}
+	if status < 200 || status > 299 {
+		return fmt.Errorf("unexpected status %d", status)
+	}
+	// Keep numeric IDs exact instead of decoding them as float64
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// send performs a back-channel request and returns the status code and a size-limited body
+func (p *Provider) send(req *http.Request) (int, []byte, error) {
+	client := p.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, nil, err
+	}
+	return resp.StatusCode, body, nil
+}
+
+// claimString reads a claim as a string, accepting numeric IDs such as GitHub's
+func claimString(claims map[string]interface{}, field string) string {
+	if field == "" {
+		return ""
+	}
+	switch v := claims[field].(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,207 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"root/internal/oauth/oauthtest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRedirectURL = "https://forum.test/auth/fake/callback"
+
+// provider returns a forum provider configured for the fake through discovery
+func provider(t *testing.T, f *oauthtest.Provider) *Provider {
+	t.Helper()
+	p := NewProvider("fake", f.OIDCConfig(testRedirectURL))
+	p.HTTPClient = f.Server.Client()
+	if err := p.Discover(context.Background()); err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	return p
+}
+
+// authorize starts a login the way the forum does and returns the callback the fake
+// provider redirects the browser to
+func authorize(t *testing.T, f *oauthtest.Provider, p *Provider, state, verifier, nonce string) *url.URL {
+	t.Helper()
+	return f.Authorize(p.AuthCodeURL(state, verifier, url.Values{"nonce": {nonce}}))
+}
+
+// callbackRequest is the browser's request to callback, carrying the state cookie when not empty
+func callbackRequest(callback *url.URL, cookie string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, callback.String(), nil)
+	if cookie != "" {
+		r.AddCookie(&http.Cookie{Name: "oauth_state", Value: cookie})
+	}
+	return r
+}
+
+func TestCallbackStateMismatch(t *testing.T) {
+	f := oauthtest.New(t)
+	p := provider(t, f)
+	callback := authorize(t, f, p, "state-from-this-browser", "verifier-verifier-verifier-verifier-verif", "nonce")
+
+	if state, err := CallbackState(callbackRequest(callback, "state-from-this-browser"), "oauth_state"); err != nil || state != "state-from-this-browser" {
+		t.Fatalf("matching state: got %q, %v", state, err)
+	}
+
+	tests := []struct {
+		name   string
+		cookie string
+		query  string
+	}{
+		{"state of another browser", "state-from-another-browser", callback.RawQuery},
+		{"no state cookie", "", callback.RawQuery},
+		{"no state parameter", "state-from-this-browser", "code=" + callback.Query().Get("code")},
+		{"empty state and cookie", "", "code=" + callback.Query().Get("code") + "&state="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := *callback
+			tampered.RawQuery = tt.query
+			if _, err := CallbackState(callbackRequest(&tampered, tt.cookie), "oauth_state"); err != ErrInvalidState {
+				t.Fatalf("got %v, want ErrInvalidState", err)
+			}
+		})
+	}
+}
+
+func TestReplayedCallbackIsRejected(t *testing.T) {
+	f := oauthtest.New(t)
+	p := provider(t, f)
+	verifier, err := NewPKCEVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	callback := authorize(t, f, p, "state", verifier, "nonce")
+	code := callback.Query().Get("code")
+
+	if _, err := p.Exchange(context.Background(), code, verifier); err != nil {
+		t.Fatalf("first exchange: %v", err)
+	}
+	_, err = p.Exchange(context.Background(), code, verifier)
+	if err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("replayed exchange: got %v, want an invalid_grant rejection", err)
+	}
+}
+
+func TestExchangeRejectsWrongPKCEVerifier(t *testing.T) {
+	f := oauthtest.New(t)
+	p := provider(t, f)
+	verifier, err := NewPKCEVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewPKCEVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	callback := authorize(t, f, p, "state", verifier, "nonce")
+
+	_, err = p.Exchange(context.Background(), callback.Query().Get("code"), other)
+	if err == nil || !strings.Contains(err.Error(), "PKCE verification failed") {
+		t.Fatalf("got %v, want the token endpoint to reject the verifier", err)
+	}
+}
+
+func TestLoginSucceeds(t *testing.T) {
+	f := oauthtest.New(t)
+	p := provider(t, f)
+	verifier, err := NewPKCEVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce, err := RandomString(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	callback := authorize(t, f, p, "state", verifier, nonce)
+	if _, err := CallbackState(callbackRequest(callback, "state"), "oauth_state"); err != nil {
+		t.Fatalf("CallbackState: %v", err)
+	}
+
+	token, err := p.Exchange(context.Background(), callback.Query().Get("code"), verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	info, err := p.Identify(context.Background(), token, nonce)
+	if err != nil {
+		t.Fatalf("Identify: %v", err)
+	}
+	want := UserInfo{Subject: "user-42", Email: "ada@example.com", Username: "ada"}
+	if *info != want {
+		t.Fatalf("got %+v, want %+v", *info, want)
+	}
+}
+
+func TestVerifyIDTokenRejectsBadTokens(t *testing.T) {
+	f := oauthtest.New(t)
+	p := provider(t, f)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := f.IDToken(f.Key, oauthtest.KeyID, f.StandardClaims("nonce"))
+	if _, err := p.VerifyIDToken(context.Background(), valid, "nonce"); err != nil {
+		t.Fatalf("valid token: %v", err)
+	}
+
+	with := func(change func(claims map[string]any)) string {
+		claims := f.StandardClaims("nonce")
+		change(claims)
+		return f.IDToken(f.Key, oauthtest.KeyID, claims)
+	}
+	parts := strings.Split(valid, ".")
+	tests := []struct {
+		name  string
+		token string
+		nonce string
+		want  string
+	}{
+		{"signed with another key", f.IDToken(otherKey, oauthtest.KeyID, f.StandardClaims("nonce")), "nonce", "signature is invalid"},
+		{"claims changed after signing", parts[0] + "." + strings.Split(with(func(c map[string]any) { c["sub"] = "admin" }), ".")[1] + "." + parts[2], "nonce", "signature is invalid"},
+		{"unsigned", base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"key-1"}`)) + "." + parts[1] + ".", "nonce", "algorithm"},
+		{"another issuer", with(func(c map[string]any) { c["iss"] = "https://evil.test" }), "nonce", "another issuer"},
+		{"another audience", with(func(c map[string]any) { c["aud"] = "someone-else" }), "nonce", "not meant for this client"},
+		{"expired", with(func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() }), "nonce", "expired"},
+		{"no expiry", with(func(c map[string]any) { delete(c, "exp") }), "nonce", "expired"},
+		{"issued in the future", with(func(c map[string]any) { c["iat"] = time.Now().Add(time.Hour).Unix() }), "nonce", "future"},
+		{"another nonce", valid, "other-nonce", "nonce does not match"},
+		{"no nonce expected", valid, "", "nonce does not match"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := p.VerifyIDToken(context.Background(), tt.token, tt.nonce)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got %v, want an error about %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdentifyRejectsBadIDTokenFromTokenEndpoint(t *testing.T) {
+	f := oauthtest.New(t)
+	p := provider(t, f)
+	f.Claims = func(claims map[string]any) { claims["aud"] = "someone-else" }
+
+	verifier, err := NewPKCEVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	callback := authorize(t, f, p, "state", verifier, "nonce")
+	token, err := p.Exchange(context.Background(), callback.Query().Get("code"), verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if _, err := p.Identify(context.Background(), token, "nonce"); err == nil {
+		t.Fatal("Identify accepted an ID token meant for another client")
+	}
+}
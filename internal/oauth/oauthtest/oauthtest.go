@@ -0,0 +1,295 @@
+// Package oauthtest runs a fake login provider on an httptest server, so the OAuth client
+// and the forum's login handlers can be tested against real HTTP round trips. It speaks
+// OpenID Connect with discovery and signed ID tokens, and serves a GitHub style user info
+// and emails endpoint for plain OAuth2 providers.
+package oauthtest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"root/internal/config"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The credentials the fake provider accepts and the ID of the key it signs ID tokens with
+const (
+	ClientID     = "forum-client"
+	ClientSecret = "forum-secret"
+	KeyID        = "key-1"
+)
+
+// Provider is an OAuth2 and OpenID Connect provider on an httptest server. It issues one-time
+// authorization codes bound to their PKCE challenge and nonce, and signs ID tokens with an
+// RSA key it publishes in its JWKS.
+type Provider struct {
+	Server *httptest.Server
+	Key    *rsa.PrivateKey
+
+	// Claims, when set, changes the claims of the ID tokens the token endpoint issues
+	Claims func(claims map[string]any)
+	// UserInfo, when set, is what the user info endpoint answers instead of the identity
+	// of the ID tokens
+	UserInfo map[string]any
+	// Emails is what the GitHub style emails endpoint answers
+	Emails []Email
+
+	t     testing.TB
+	mu    sync.Mutex
+	codes map[string]grant
+}
+
+// Email is one address in the answer of the emails endpoint
+type Email struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+// grant is what an authorization code was issued for
+type grant struct {
+	challenge string
+	nonce     string
+	used      bool
+}
+
+// New starts a fake provider that is shut down when the test ends
+func New(t testing.TB) *Provider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &Provider{t: t, Key: key, codes: map[string]grant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", f.discovery)
+	mux.HandleFunc("GET /authorize", f.authorize)
+	mux.HandleFunc("POST /token", f.token)
+	mux.HandleFunc("GET /userinfo", f.userInfo)
+	mux.HandleFunc("GET /emails", f.emails)
+	mux.HandleFunc("GET /jwks", f.jwks)
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Server.Close)
+	return f
+}
+
+// OIDCConfig configures a forum provider to use the fake as an OpenID Connect issuer
+func (f *Provider) OIDCConfig(redirectURL string) config.OAuthProvider {
+	return config.OAuthProvider{
+		Issuer:       f.Server.URL,
+		ClientID:     ClientID,
+		ClientSecret: ClientSecret,
+		RedirectURL:  redirectURL,
+	}
+}
+
+// GitHubConfig configures a forum provider to use the fake like GitHub: plain OAuth2, with
+// the user read from the user info endpoint and a private email from the emails endpoint
+func (f *Provider) GitHubConfig(redirectURL string) config.OAuthProvider {
+	return config.OAuthProvider{
+		ClientID:      ClientID,
+		ClientSecret:  ClientSecret,
+		AuthURL:       f.Server.URL + "/authorize",
+		TokenURL:      f.Server.URL + "/token",
+		UserInfoURL:   f.Server.URL + "/userinfo",
+		EmailsURL:     f.Server.URL + "/emails",
+		RedirectURL:   redirectURL,
+		Scopes:        []string{"user:email"},
+		SubjectField:  "id",
+		EmailField:    "email",
+		UsernameField: "login",
+	}
+}
+
+// Authorize follows an authorization URL the way a browser would and returns the callback
+// the fake provider redirects back to
+func (f *Provider) Authorize(authURL string) *url.URL {
+	f.t.Helper()
+	client := f.Server.Client()
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse }
+
+	resp, err := client.Get(authURL)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		f.t.Fatalf("authorize answered %d, want a redirect", resp.StatusCode)
+	}
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return callback
+}
+
+func (f *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 f.Server.URL,
+		"authorization_endpoint": f.Server.URL + "/authorize",
+		"token_endpoint":         f.Server.URL + "/token",
+		"userinfo_endpoint":      f.Server.URL + "/userinfo",
+		"jwks_uri":               f.Server.URL + "/jwks",
+	})
+}
+
+// authorize skips the consent screen and sends the browser straight back with a code
+func (f *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("client_id") != ClientID || query.Get("response_type") != "code" ||
+		query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "bad authorization request", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString(16)
+	f.mu.Lock()
+	f.codes[code] = grant{challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+	f.mu.Unlock()
+
+	back := url.Values{"code": {code}, "state": {query.Get("state")}}
+	http.Redirect(w, r, query.Get("redirect_uri")+"?"+back.Encode(), http.StatusFound)
+}
+
+// token redeems a code once, for the verifier of the challenge it was issued with
+func (f *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	if r.PostForm.Get("client_id") != ClientID || r.PostForm.Get("client_secret") != ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	f.mu.Lock()
+	g, ok := f.codes[code]
+	reused := g.used
+	if ok {
+		g.used = true
+		f.codes[code] = g
+	}
+	f.mu.Unlock()
+	if !ok || reused {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "unknown code"})
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": "access-" + code,
+		"token_type":   "Bearer",
+		"id_token":     f.IDToken(f.Key, KeyID, f.StandardClaims(g.nonce)),
+	})
+}
+
+func (f *Provider) userInfo(w http.ResponseWriter, r *http.Request) {
+	if !authorized(w, r) {
+		return
+	}
+	if f.UserInfo != nil {
+		writeJSON(w, http.StatusOK, f.UserInfo)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"sub": "user-42", "email": "ada@example.com", "email_verified": true})
+}
+
+func (f *Provider) emails(w http.ResponseWriter, r *http.Request) {
+	if !authorized(w, r) {
+		return
+	}
+	emails := f.Emails
+	if emails == nil {
+		emails = []Email{}
+	}
+	writeJSON(w, http.StatusOK, emails)
+}
+
+func (f *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": KeyID,
+		"use": "sig",
+		"alg": "RS256",
+		"n":   base64.RawURLEncoding.EncodeToString(f.Key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(f.Key.E)).Bytes()),
+	}}})
+}
+
+// StandardClaims are the claims of a valid ID token for nonce, changed by f.Claims when set
+func (f *Provider) StandardClaims(nonce string) map[string]any {
+	now := time.Now()
+	claims := map[string]any{
+		"iss":                f.Server.URL,
+		"sub":                "user-42",
+		"aud":                ClientID,
+		"exp":                now.Add(time.Hour).Unix(),
+		"iat":                now.Unix(),
+		"nonce":              nonce,
+		"email":              "ada@example.com",
+		"email_verified":     true,
+		"preferred_username": "ada",
+	}
+	if f.Claims != nil {
+		f.Claims(claims)
+	}
+	return claims
+}
+
+// IDToken signs claims as an RS256 JWT with key
+func (f *Provider) IDToken(key *rsa.PrivateKey, kid string, claims map[string]any) string {
+	f.t.Helper()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// authorized answers 401 unless the request carries an access token the fake issued
+func authorized(w http.ResponseWriter, r *http.Request) bool {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer access-") {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_token"})
+		return false
+	}
+	return true
+}
+
+// randomString returns n random bytes encoded as unpadded base64url
+func randomString(n int) string {
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
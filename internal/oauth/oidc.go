@@ -0,0 +1,354 @@
+package oauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// clockSkew is the leeway given to exp and iat when checking an ID token
+	clockSkew = time.Minute
+	// jwksRefreshInterval limits how often an unknown key ID triggers a JWKS refetch
+	jwksRefreshInterval = time.Minute
+)
+
+// discoveryDocument is the part of .well-known/openid-configuration the forum uses
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// IsOIDC reports whether the provider is configured through OpenID Connect discovery
+func (p *Provider) IsOIDC() bool {
+	return p.Config.Issuer != ""
+}
+
+// Discover loads the provider's OpenID Connect configuration the first time it is needed.
+// Endpoints set explicitly in the config take precedence over the discovered ones.
+func (p *Provider) Discover(ctx context.Context) error {
+	if !p.IsOIDC() {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovered {
+		return nil
+	}
+
+	issuer := strings.TrimSuffix(p.Config.Issuer, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	var doc discoveryDocument
+	if err := p.doJSON(req, &doc); err != nil {
+		return fmt.Errorf("discovery failed: %w", err)
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != issuer {
+		return fmt.Errorf("discovery issuer %q does not match configured issuer %q", doc.Issuer, p.Config.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return errors.New("discovery document is missing required endpoints")
+	}
+
+	pick := func(configured, discovered string) string {
+		if configured != "" {
+			return configured
+		}
+		return discovered
+	}
+	p.endpoints = endpoints{
+		auth:     pick(p.Config.AuthURL, doc.AuthorizationEndpoint),
+		token:    pick(p.Config.TokenURL, doc.TokenEndpoint),
+		userInfo: pick(p.Config.UserInfoURL, doc.UserInfoEndpoint),
+		jwks:     doc.JWKSURI,
+	}
+	p.discovered = true
+	return nil
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce of an ID token
+// and returns its claims
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (map[string]interface{}, error) {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("ID token is not a compact JWS")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("ID token header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("ID token signature: %w", err)
+	}
+
+	key, err := p.signingKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("ID token claims: %w", err)
+	}
+
+	if strings.TrimSuffix(claimString(claims, "iss"), "/") != strings.TrimSuffix(p.Config.Issuer, "/") {
+		return nil, errors.New("ID token was issued by another issuer")
+	}
+	audiences := claimStrings(claims, "aud")
+	if !contains(audiences, p.Config.ClientID) {
+		return nil, errors.New("ID token is not meant for this client")
+	}
+	if len(audiences) > 1 && claimString(claims, "azp") != p.Config.ClientID {
+		return nil, errors.New("ID token has an unexpected authorized party")
+	}
+
+	now := time.Now()
+	exp, ok := claimTime(claims, "exp")
+	if !ok || now.After(exp.Add(clockSkew)) {
+		return nil, errors.New("ID token has expired")
+	}
+	if iat, ok := claimTime(claims, "iat"); ok && iat.After(now.Add(clockSkew)) {
+		return nil, errors.New("ID token was issued in the future")
+	}
+	if nonce == "" || claimString(claims, "nonce") != nonce {
+		return nil, errors.New("ID token nonce does not match")
+	}
+
+	return claims, nil
+}
+
+// signingKey returns the JWKS key with the given ID, refetching the key set when the
+// provider has rotated to a key we have not seen yet
+func (p *Provider) signingKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("ID token is signed with unknown key %q", kid)
+	}
+
+	keys, err := p.fetchJWKS(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("ID token is signed with unknown key %q", kid)
+}
+
+// lookupKey finds a cached key; a token without a key ID is accepted when the set has one key
+func (p *Provider) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+// fetchJWKS downloads the provider's signing keys, skipping key types we cannot use
+func (p *Provider) fetchJWKS(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	if p.endpoints.jwks == "" {
+		return nil, errors.New("provider has no JWKS endpoint")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.endpoints.jwks, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := p.doJSON(req, &set); err != nil {
+		return nil, fmt.Errorf("JWKS request failed: %w", err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		switch jwk.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+			e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+			if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+				continue
+			}
+			keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch jwk.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+			y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[jwk.Kid] = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS has no usable signing keys")
+	}
+	return keys, nil
+}
+
+// verifySignature checks a JWS signature. Only asymmetric algorithms are accepted, so
+// neither "none" nor an HMAC keyed with the public key can slip through.
+func verifySignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported ID token algorithm %q", alg)
+	}
+	var h hash.Hash
+	var hashID crypto.Hash
+	switch alg[2:] {
+	case "256":
+		h, hashID = sha256.New(), crypto.SHA256
+	case "384":
+		h, hashID = sha512.New384(), crypto.SHA384
+	case "512":
+		h, hashID = sha512.New(), crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported ID token algorithm %q", alg)
+	}
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			if rsa.VerifyPKCS1v15(k, hashID, digest, signature) == nil {
+				return nil
+			}
+		case "PS":
+			if rsa.VerifyPSS(k, hashID, digest, signature, nil) == nil {
+				return nil
+			}
+		default:
+			return fmt.Errorf("unsupported ID token algorithm %q for an RSA key", alg)
+		}
+	case *ecdsa.PublicKey:
+		if alg[:2] != "ES" {
+			return fmt.Errorf("unsupported ID token algorithm %q for an EC key", alg)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("ID token signature has the wrong length")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if ecdsa.Verify(k, digest, r, s) {
+			return nil
+		}
+	}
+	return errors.New("ID token signature is invalid")
+}
+
+// decodeSegment decodes one base64url JSON part of a JWT
+func decodeSegment(segment string, v interface{}) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(raw)))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// claimStrings reads a claim that may be a single string or a list of strings, such as aud
+func claimStrings(claims map[string]interface{}, field string) []string {
+	switch v := claims[field].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// claimTime reads a NumericDate claim such as exp or iat
+func claimTime(claims map[string]interface{}, field string) (time.Time, bool) {
+	number, ok := claims[field].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	seconds, err := number.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(seconds), 0), true
+}
+
+// contains reports whether values holds s
+func contains(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
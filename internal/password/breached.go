@@ -0,0 +1,135 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+)
+
+// prefixLength is the number of SHA-1 hex characters used to look up a range, as in
+// the k-anonymity model of the Pwned Passwords API
+const prefixLength = 5
+
+// BreachedList looks up breached password hashes by SHA-1 prefix.
+// Range returns the remaining 35 hex characters of every breached hash starting with prefix,
+// so only the prefix ever has to leave the caller.
+type BreachedList interface {
+	Range(prefix string) ([]string, error)
+}
+
+// IsBreached reports whether the password appears in the list
+func IsBreached(list BreachedList, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	suffixes, err := list.Range(hash[:prefixLength])
+	if err != nil {
+		return false, err
+	}
+	for _, suffix := range suffixes {
+		if suffix == hash[prefixLength:] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// HashFile is a breached password list stored as a file of uppercase SHA-1 hashes sorted
+// in ascending order, one per line, optionally followed by ":count". This is the layout of
+// the "ordered by hash" Pwned Passwords download, so the shipped list can be swapped for it.
+// Lookups binary search the file instead of loading it, so large lists stay on disk.
+type HashFile struct {
+	Path string
+}
+
+// searchWindow is the file span below which the binary search switches to a linear scan
+const searchWindow = 4096
+
+// Range returns the hash suffixes in the file that share the prefix
+func (f *HashFile) Range(prefix string) ([]string, error) {
+	prefix = strings.ToUpper(prefix)
+
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// Narrow [lo, hi) down to a small window that contains the first line >= prefix
+	lo, hi := int64(0), info.Size()
+	for hi-lo > searchWindow {
+		mid := lo + (hi-lo)/2
+		key, err := firstKeyAfter(file, mid)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if err == io.EOF || key >= prefix {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+
+	if _, err := file.Seek(lo, io.SeekStart); err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(file)
+	if lo > 0 {
+		// lo falls inside a line that sorts before the prefix
+		if _, err := reader.ReadString('\n'); err != nil {
+			return nil, nil
+		}
+	}
+
+	var suffixes []string
+	for {
+		line, err := reader.ReadString('\n')
+		hash, _, _ := strings.Cut(strings.TrimSpace(line), ":")
+		hash = strings.ToUpper(hash)
+		if len(hash) == 40 {
+			switch {
+			case hash[:prefixLength] == prefix:
+				suffixes = append(suffixes, hash[prefixLength:])
+			case hash[:prefixLength] > prefix:
+				return suffixes, nil
+			}
+		}
+		if err == io.EOF {
+			return suffixes, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// firstKeyAfter returns the prefix of the first complete line that starts after offset
+func firstKeyAfter(file *os.File, offset int64) (string, error) {
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return "", err
+	}
+	reader := bufio.NewReader(file)
+	if _, err := reader.ReadString('\n'); err != nil {
+		return "", err
+	}
+	line, err := reader.ReadString('\n')
+	line = strings.TrimSpace(line)
+	if line == "" {
+		if err == nil {
+			err = io.EOF
+		}
+		return "", err
+	}
+	if len(line) < prefixLength {
+		return strings.ToUpper(line), nil
+	}
+	return strings.ToUpper(line[:prefixLength]), nil
+}
@@ -0,0 +1,94 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// BcryptMaxBytes is the longest input bcrypt uses; anything past it would be silently ignored
+const BcryptMaxBytes = 72
+
+// Policy decides which new passwords are acceptable
+type Policy struct {
+	// MinLength and MaxLength count characters (runes), not bytes
+	MinLength int
+	MaxLength int
+	// MinClasses is how many of lowercase, uppercase, digits and symbols must appear
+	MinClasses int
+	// Breached, when set, rejects passwords known from data breaches
+	Breached BreachedList
+}
+
+// Check returns a user-facing reason the password is refused, or "" when it is acceptable.
+// The error is only set when the breached list could not be read.
+func (p *Policy) Check(password, username, email string) (string, error) {
+	if !utf8.ValidString(password) {
+		return "Password contains invalid characters", nil
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength || length > p.MaxLength {
+		return fmt.Sprintf("Password must be between %d-%d characters", p.MinLength, p.MaxLength), nil
+	}
+	if len(password) > BcryptMaxBytes {
+		return fmt.Sprintf("Password is too long: it may use at most %d bytes, and accented letters or emoji take more than one", BcryptMaxBytes), nil
+	}
+
+	if classes := countClasses(password); classes < p.MinClasses {
+		return fmt.Sprintf("Password must mix at least %d of: lowercase letters, uppercase letters, digits and symbols", p.MinClasses), nil
+	}
+
+	lower := strings.ToLower(password)
+	localPart, _, _ := strings.Cut(strings.ToLower(email), "@")
+	if (username != "" && lower == strings.ToLower(username)) || (localPart != "" && (lower == localPart || lower == strings.ToLower(email))) {
+		return "Password must not be your username or email", nil
+	}
+
+	if p.Breached != nil {
+		breached, err := IsBreached(p.Breached, password)
+		if err != nil {
+			return "", err
+		}
+		if breached {
+			return "This password has appeared in a data breach and can't be used. Please choose another one.", nil
+		}
+	}
+
+	return "", nil
+}
+
+// Hint describes the policy for the registration form
+func (p *Policy) Hint() string {
+	hint := fmt.Sprintf("Use %d-%d characters", p.MinLength, p.MaxLength)
+	if p.MinClasses > 1 {
+		hint += fmt.Sprintf(" mixing at least %d of lowercase, uppercase, digits and symbols", p.MinClasses)
+	}
+	return hint
+}
+
+// countClasses counts the character classes present in a password
+func countClasses(password string) int {
+	var lower, upper, digit, symbol bool
+	for _, c := range password {
+		switch {
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsDigit(c):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	count := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			count++
+		}
+	}
+	return count
+}
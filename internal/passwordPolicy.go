@@ -0,0 +1,43 @@
+package root
+
+import (
+	"log"
+	"os"
+	"root/internal/config"
+	"root/internal/password"
+)
+
+// maxPasswordBytes is the longest password bcrypt can verify
+const maxPasswordBytes = password.BcryptMaxBytes
+
+// passwordPolicy is the policy new passwords are checked against
+var passwordPolicy = &password.Policy{MinLength: 8, MaxLength: 64}
+
+// setupPasswordPolicy builds the password policy from the configuration
+func setupPasswordPolicy(cfg *config.Config) {
+	passwordPolicy = &password.Policy{
+		MinLength:  cfg.Password.MinLength,
+		MaxLength:  cfg.Password.MaxLength,
+		MinClasses: cfg.Password.MinClasses,
+	}
+
+	if cfg.Password.BreachedList == nil || *cfg.Password.BreachedList == "" {
+		return
+	}
+	path := *cfg.Password.BreachedList
+	if _, err := os.Stat(path); err != nil {
+		log.Printf("Breached password list unavailable, skipping the check: %v", err)
+		return
+	}
+	passwordPolicy.Breached = &password.HashFile{Path: path}
+}
+
+// checkNewPassword returns why a new password is refused, or "" when it is acceptable.
+// A breached list that cannot be read does not block the user; it is only logged.
+func checkNewPassword(newPassword, username, email string) string {
+	msg, err := passwordPolicy.Check(newPassword, username, email)
+	if err != nil {
+		log.Printf("Breached password check failed: %v", err)
+	}
+	return msg
+}
@@ -0,0 +1,221 @@
+package root
+
+import (
+	"database/sql"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	database "root/internal/database"
+	"root/internal/mail"
+	"root/internal/throttle"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// resetEmailThrottle spaces out the reset links mailed to one address, so the form
+	// cannot be used to flood someone's inbox
+	resetEmailThrottle = throttle.New(throttle.Policy{
+		BaseDelay:   time.Minute,
+		MaxDelay:    15 * time.Minute,
+		ForgetAfter: time.Hour,
+	}, throttle.SystemClock{})
+
+	// resetIPThrottle slows down a single address asking for reset links for many emails
+	resetIPThrottle = throttle.New(throttle.Policy{
+		FreeAttempts: 5,
+		BaseDelay:    time.Minute,
+		MaxDelay:     time.Hour,
+		ForgetAfter:  time.Hour,
+	}, throttle.SystemClock{})
+)
+
+// ForgotPassword asks for an email address and mails a password reset link to it
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		renderForgotPage(w, r, false, "")
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	email := strings.TrimSpace(r.FormValue("email"))
+	if email == "" {
+		renderForgotPage(w, r, false, "Enter the email you registered with")
+		return
+	}
+
+	if wait := reserveResetRequest(r, email); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		w.WriteHeader(http.StatusTooManyRequests)
+		renderForgotPage(w, r, false, "Too many reset links were asked for. Please wait "+describeWait(wait)+" before asking for another one.")
+		return
+	}
+
+	userID, err := database.FetchUserIDByEmail(email)
+	if err == sql.ErrNoRows {
+		// Answer the same way whether or not the email is registered
+		renderForgotPage(w, r, true, "")
+		return
+	}
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	resetToken, err := uuid.NewV4()
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	if err := database.CreatePasswordReset(userID, resetToken.String()); err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	msg := mail.Message{
+		To:      email,
+		Subject: "Reset your Stellar Forum password",
+		Body: "Someone asked to reset the password of your Stellar Forum account.\n\n" +
+			"Open this link within an hour to choose a new password:\n" +
+			absoluteURL("/password/reset?token="+url.QueryEscape(resetToken.String())) + "\n\n" +
+			"If it wasn't you, you can ignore this email.\n",
+	}
+	// Send in the background so the response time does not reveal whether the email exists
+	go func() {
+		if err := mailer.Send(msg); err != nil {
+			log.Printf("Sending password reset email failed: %v", err)
+		}
+	}()
+
+	renderForgotPage(w, r, true, "")
+}
+
+// reserveResetRequest counts a reset request against the address it comes from and the email
+// it is for, and returns how long to wait when either has asked too often. Requests are
+// counted whether or not the email is registered, so being limited reveals nothing.
+func reserveResetRequest(r *http.Request, email string) time.Duration {
+	wait, _ := resetIPThrottle.Attempt(clientIP(r))
+	if wait > 0 {
+		return wait
+	}
+	wait, _ = resetEmailThrottle.Attempt(strings.ToLower(email))
+	if wait > 0 {
+		// Only requests that get through are counted
+		resetIPThrottle.Refund(clientIP(r))
+	}
+	return wait
+}
+
+// ResetPassword lets the holder of a reset link choose a new password
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("token")
+
+	if r.Method == http.MethodGet {
+		if _, err := database.FetchPasswordResetUserID(token); err != nil {
+			renderResetPage(w, r, "", false, "This reset link is invalid or has expired.")
+			return
+		}
+		renderResetPage(w, r, token, false, "")
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	password, secondpass := r.FormValue("password"), r.FormValue("secondpass")
+	if secondpass != password {
+		renderResetPage(w, r, token, false, "Passwords do not match")
+		return
+	}
+
+	userID, err := database.FetchPasswordResetUserID(token)
+	if err != nil {
+		renderResetPage(w, r, "", false, "This reset link is invalid or has expired.")
+		return
+	}
+	username, err := database.FetchUsernameByUserID(userID)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	email, _, err := database.FetchUserEmail(userID)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	if msg := checkNewPassword(password, username, email); msg != "" {
+		renderResetPage(w, r, token, false, msg)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	_, err = database.ResetPassword(token, string(hashedPassword))
+	if err == sql.ErrNoRows {
+		renderResetPage(w, r, "", false, "This reset link is invalid or has expired.")
+		return
+	}
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	// Every session was signed out, including this browser's
+	clearSessionCookie(w)
+	renderResetPage(w, r, "", true, "")
+}
+
+// renderForgotPage renders the forgot password page
+func renderForgotPage(w http.ResponseWriter, r *http.Request, sent bool, errorMessage string) {
+	data := struct {
+		CSRFToken    string
+		Sent         bool
+		ErrorMessage string
+	}{
+		CSRFToken:    csrfToken(r),
+		Sent:         sent,
+		ErrorMessage: errorMessage,
+	}
+
+	err := templates.ExecuteTemplate(w, "forgot.html", data)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+	}
+}
+
+// renderResetPage renders the choose a new password page
+func renderResetPage(w http.ResponseWriter, r *http.Request, token string, done bool, errorMessage string) {
+	data := struct {
+		CSRFToken    string
+		Token        string
+		Done         bool
+		ErrorMessage string
+		PasswordHint string
+		PasswordMax  int
+	}{
+		CSRFToken:    csrfToken(r),
+		Token:        token,
+		Done:         done,
+		ErrorMessage: errorMessage,
+		PasswordHint: passwordPolicy.Hint(),
+		PasswordMax:  passwordPolicy.MaxLength,
+	}
+
+	err := templates.ExecuteTemplate(w, "reset.html", data)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,150 @@
+package root
+
+import (
+	"net/http"
+	database "root/internal/database"
+	"root/internal/models"
+	"root/internal/roles"
+)
+
+// permissions is what one user may do: their site-wide role plus the categories they moderate.
+// It lives for one request and remembers the categories of the posts it has been asked about.
+type permissions struct {
+	userID     int
+	role       roles.Role
+	categories map[int]bool
+	// postCategories caches the category IDs of posts by post ID
+	postCategories map[int][]int
+}
+
+// loadPermissions reads the role and moderated categories of a user
+func loadPermissions(userID int) (permissions, error) {
+	role, err := database.FetchUserRole(userID)
+	if err != nil {
+		return permissions{}, err
+	}
+	categories, err := database.FetchModeratedCategoryIDs(userID)
+	if err != nil {
+		return permissions{}, err
+	}
+	return permissions{userID: userID, role: role, categories: categories, postCategories: map[int][]int{}}, nil
+}
+
+// moderatesByCategory reports whether perm may come from moderating a post's category
+// rather than from the user's role, so that the post's categories need to be looked up
+func (p permissions) moderatesByCategory(perm roles.Permission) bool {
+	return !p.role.Has(perm) && len(p.categories) > 0 && roles.GrantedToCategoryModerators(perm)
+}
+
+// can reports whether the user holds perm. Site-wide permissions come from the role;
+// when postID is not 0, moderating one of the post's categories is enough as well.
+func (p permissions) can(perm roles.Permission, postID int) (bool, error) {
+	if p.role.Has(perm) {
+		return true, nil
+	}
+	if postID == 0 || !p.moderatesByCategory(perm) {
+		return false, nil
+	}
+
+	categoryIDs, cached := p.postCategories[postID]
+	if !cached {
+		var err error
+		categoryIDs, err = database.FetchPostCategoryIDs(postID)
+		if err != nil {
+			return false, err
+		}
+		p.postCategories[postID] = categoryIDs
+	}
+	for _, categoryID := range categoryIDs {
+		if p.categories[categoryID] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// canDelete reports whether the user may delete content by authorID on the post with postID:
+// their own, or anything they moderate
+func (p permissions) canDelete(authorID, postID int) (bool, error) {
+	if authorID == p.userID {
+		return true, nil
+	}
+	return p.can(roles.ModeratePosts, postID)
+}
+
+// loadPostCategories looks up the categories of the posts in one go, so checking a page of
+// posts and their comments does not query the categories of every post on its own
+func (p permissions) loadPostCategories(posts []models.Post) error {
+	var postIDs []int
+	for _, post := range posts {
+		if _, cached := p.postCategories[post.ID]; !cached {
+			postIDs = append(postIDs, post.ID)
+		}
+	}
+	if len(postIDs) == 0 {
+		return nil
+	}
+
+	categoryIDs, err := database.FetchPostsCategoryIDs(postIDs)
+	if err != nil {
+		return err
+	}
+	for _, postID := range postIDs {
+		p.postCategories[postID] = categoryIDs[postID]
+	}
+	return nil
+}
+
+// markDeletable sets CanDelete on the posts and comments the user may delete
+func (p permissions) markDeletable(posts []models.Post) error {
+	if p.moderatesByCategory(roles.ModeratePosts) {
+		if err := p.loadPostCategories(posts); err != nil {
+			return err
+		}
+	}
+	for i := range posts {
+		post := &posts[i]
+		var err error
+		post.CanDelete, err = p.canDelete(post.UserID, post.ID)
+		if err != nil {
+			return err
+		}
+		for j := range post.Comment {
+			comment := &post.Comment[j]
+			comment.ComCanDelete, err = p.canDelete(comment.ComUserID, post.ID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// can reports whether a user holds perm, either site-wide or on the post with postID (0 for none)
+func can(userID int, perm roles.Permission, postID int) (bool, error) {
+	perms, err := loadPermissions(userID)
+	if err != nil {
+		return false, err
+	}
+	return perms.can(perm, postID)
+}
+
+// requirePermission returns the signed-in user when they hold perm site-wide,
+// sending guests to the login page and everyone else to /403
+func requirePermission(w http.ResponseWriter, r *http.Request, perm roles.Permission) (int, bool) {
+	userID, ok := requireSession(w, r)
+	if !ok {
+		return 0, false
+	}
+
+	allowed, err := can(userID, perm, 0)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return 0, false
+	}
+	if !allowed {
+		http.Redirect(w, r, "/403", http.StatusSeeOther)
+		return 0, false
+	}
+	return userID, true
+}
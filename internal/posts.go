@@ -0,0 +1,129 @@
+package root
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	database "root/internal/database"
+	"root/internal/models"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// previewLength is how many characters of a post a link preview shows
+const previewLength = 200
+
+// linkPreview is what the OpenGraph tags of a post's page say about it
+type linkPreview struct {
+	Title       string
+	Description string
+	URL         string
+	Image       string
+}
+
+// PostPage is the page of a single post at /posts/{id}, with a page of its comments
+func PostPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	// Answer missing posts here rather than redirecting, so the post's address itself is a 404
+	postID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || postID < 1 {
+		NotFound(w, r)
+		return
+	}
+	userID := sessionUserID(r)
+	post, err := database.FetchPostSummary(postID, userID)
+	if err == sql.ErrNoRows {
+		NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	comments, err := database.FetchCommentsPage(postID, userID, pageRequest(r))
+	if err == database.ErrBadCursor {
+		http.Redirect(w, r, "/400", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	post.Comment = comments.Comments
+
+	if userID != 0 {
+		perms, err := loadPermissions(userID)
+		if err != nil {
+			http.Redirect(w, r, "/500", http.StatusSeeOther)
+			return
+		}
+		posts := []models.Post{post}
+		if err := perms.markDeletable(posts); err != nil {
+			http.Redirect(w, r, "/500", http.StatusSeeOther)
+			return
+		}
+		post = posts[0]
+	}
+
+	data := struct {
+		CSRFToken    string
+		SignedIn     bool
+		Post         models.Post
+		CommentsNext string
+		CommentsPrev string
+		Preview      linkPreview
+	}{
+		CSRFToken:    csrfToken(r),
+		SignedIn:     userID != 0,
+		Post:         post,
+		CommentsNext: comments.Next,
+		CommentsPrev: comments.Prev,
+		Preview:      postPreview(post),
+	}
+
+	err = templates.ExecuteTemplate(w, "post.html", data)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+	}
+}
+
+// postPreview describes a post for the link previews of chat apps and social sites
+func postPreview(post models.Post) linkPreview {
+	description := strings.Join(strings.Fields(post.Content), " ")
+	if utf8.RuneCountInString(description) > previewLength {
+		description = string([]rune(description)[:previewLength-1]) + "…"
+	}
+	preview := linkPreview{
+		Title:       "@" + post.Username + " on Stellar Forum",
+		Description: description,
+		URL:         absoluteURL(fmt.Sprintf("/posts/%d", post.ID)),
+	}
+	for _, media := range post.Media {
+		if media.FileType == "image" {
+			preview.Image = absoluteURL("/" + media.FilePath)
+			break
+		}
+	}
+	return preview
+}
+
+// redirectToPost sends the browser back to the page of the post with the ID in postID,
+// at the comment with commentID when it is not 0
+func redirectToPost(w http.ResponseWriter, r *http.Request, postID string, commentID int) {
+	id, err := strconv.Atoi(postID)
+	if err != nil || id < 1 {
+		http.Redirect(w, r, "/400", http.StatusSeeOther)
+		return
+	}
+	target := fmt.Sprintf("/posts/%d", id)
+	if commentID > 0 {
+		target += fmt.Sprintf("#comment=%d", commentID)
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
@@ -0,0 +1,127 @@
+package registration
+
+import (
+	"bufio"
+	"fmt"
+	"net/mail"
+	"os"
+	"strings"
+)
+
+// Mode decides who may create an account
+type Mode string
+
+const (
+	// Open lets anyone with an acceptable email register
+	Open Mode = "open"
+	// InviteOnly additionally requires an invite code
+	InviteOnly Mode = "invite"
+	// Closed refuses every new account
+	Closed Mode = "closed"
+)
+
+// ValidMode reports whether mode is one of the known modes
+func ValidMode(mode Mode) bool {
+	return mode == Open || mode == InviteOnly || mode == Closed
+}
+
+// Policy decides which new accounts are accepted
+type Policy struct {
+	Mode Mode
+	// AllowDomains, when not empty, is the only set of email domains accepted
+	AllowDomains []string
+	// DenyDomains are refused even when allowed
+	DenyDomains []string
+	// Disposable holds throwaway mail domains, which are always refused
+	Disposable map[string]bool
+}
+
+// CheckEmail returns a user-facing reason the email may not register, or "" when it may.
+// A domain entry also covers its subdomains.
+func (p *Policy) CheckEmail(email string) string {
+	domain, ok := emailDomain(email)
+	if !ok {
+		return "Please enter a valid email address."
+	}
+
+	if len(p.AllowDomains) > 0 && !matchesAny(domain, p.AllowDomains) {
+		return "Registration is limited to email addresses at " + strings.Join(p.AllowDomains, ", ") + "."
+	}
+	if matchesAny(domain, p.DenyDomains) {
+		return "Email addresses at " + domain + " can't be used to register."
+	}
+	for d := domain; d != ""; d = parentDomain(d) {
+		if p.Disposable[d] {
+			return "Disposable email addresses can't be used to register."
+		}
+	}
+	return ""
+}
+
+// ValidEmail reports whether email is a bare address with a dotted domain
+func ValidEmail(email string) bool {
+	_, ok := emailDomain(email)
+	return ok
+}
+
+// emailDomain validates a bare address and returns its lowercased domain
+func emailDomain(email string) (string, bool) {
+	if len(email) > 254 {
+		return "", false
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Name != "" || addr.Address != email {
+		return "", false
+	}
+
+	_, domain, _ := strings.Cut(addr.Address, "@")
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, "[") {
+		return "", false
+	}
+	return domain, true
+}
+
+// matchesAny reports whether domain is one of domains or a subdomain of one
+func matchesAny(domain string, domains []string) bool {
+	for _, d := range domains {
+		d = strings.TrimSuffix(strings.ToLower(d), ".")
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// parentDomain strips the first label of a domain, returning "" for a top-level label
+func parentDomain(domain string) string {
+	_, parent, found := strings.Cut(domain, ".")
+	if !found {
+		return ""
+	}
+	return parent
+}
+
+// LoadDomainList reads a list of domains, one per line; blank lines and # comments are skipped
+func LoadDomainList(path string) (map[string]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	domains := map[string]bool{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		entry, _, _ := strings.Cut(scanner.Text(), "#")
+		entry = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(entry)), ".")
+		if entry == "" {
+			continue
+		}
+		if strings.ContainsAny(entry, " \t@") {
+			return nil, fmt.Errorf("%s:%d: invalid domain %q", path, line, entry)
+		}
+		domains[entry] = true
+	}
+	return domains, scanner.Err()
+}
@@ -0,0 +1,121 @@
+package root
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"root/internal/config"
+	database "root/internal/database"
+	"root/internal/registration"
+	"strings"
+)
+
+// registrationPolicy decides who may create an account
+var registrationPolicy = &registration.Policy{Mode: registration.Open}
+
+// inviteCodes are the codes accepted while registration is invite-only
+var inviteCodes []string
+
+// setupRegistrationPolicy builds the registration policy from the configuration
+func setupRegistrationPolicy(cfg *config.Config) error {
+	registrationPolicy = &registration.Policy{
+		Mode:         registration.Mode(cfg.Registration.Mode),
+		AllowDomains: cfg.Registration.AllowDomains,
+		DenyDomains:  cfg.Registration.DenyDomains,
+	}
+	inviteCodes = cfg.Registration.InviteCodes
+
+	if cfg.Registration.DisposableList == nil || *cfg.Registration.DisposableList == "" {
+		return nil
+	}
+	disposable, err := registration.LoadDomainList(*cfg.Registration.DisposableList)
+	if err != nil {
+		return err
+	}
+	registrationPolicy.Disposable = disposable
+	return nil
+}
+
+// checkRegistration returns why a new account with this email is refused, or "" when it may
+// be created. inviteCode is only looked at while registration is invite-only.
+func checkRegistration(email, inviteCode string) string {
+	if msg := checkRegistrationEmail(email); msg != "" {
+		return msg
+	}
+	if registrationPolicy.Mode != registration.InviteOnly {
+		return ""
+	}
+	if strings.TrimSpace(inviteCode) == "" {
+		return "Registration is invite-only. Please enter your invite code."
+	}
+	if isConfiguredInviteCode(inviteCode) {
+		return ""
+	}
+	valid, err := database.ValidInvite(inviteCode)
+	if err != nil {
+		log.Printf("Checking invite code failed: %v", err)
+		return "Could not check the invite code, please try again."
+	}
+	if !valid {
+		return "This invite code is not valid, or it has expired or been used up."
+	}
+	return ""
+}
+
+// signupInviteCode returns the invite code an account creation has to redeem: the submitted
+// code while registration is invite-only, unless it is one of the configured codes
+func signupInviteCode(inviteCode string) string {
+	if registrationPolicy.Mode != registration.InviteOnly || isConfiguredInviteCode(inviteCode) {
+		return ""
+	}
+	return database.NormalizeInviteCode(inviteCode)
+}
+
+// checkRegistrationEmail applies the registration mode and email rules, leaving the
+// invite code for later; OAuth signups are checked with it before the username step
+func checkRegistrationEmail(email string) string {
+	if registrationPolicy.Mode == registration.Closed {
+		return "Registration is currently closed."
+	}
+	return registrationPolicy.CheckEmail(email)
+}
+
+// isConfiguredInviteCode reports whether code is one of the invite codes from the configuration,
+// ignoring case and surrounding spaces like the codes created by admins
+func isConfiguredInviteCode(code string) bool {
+	code = database.NormalizeInviteCode(code)
+	if code == "" {
+		return false
+	}
+	valid := false
+	for _, inviteCode := range inviteCodes {
+		if subtle.ConstantTimeCompare([]byte(code), []byte(database.NormalizeInviteCode(inviteCode))) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// requestInviteCode returns the invite code submitted with a form or carried by an invite link
+func requestInviteCode(r *http.Request) string {
+	if code := r.PostFormValue("invite_code"); code != "" {
+		return code
+	}
+	return r.URL.Query().Get("invite")
+}
+
+// registrationView is what the registration forms need to know about the policy
+type registrationView struct {
+	InviteOnly bool
+	Closed     bool
+	InviteCode string
+}
+
+// registrationPageData describes the registration policy for the templates
+func registrationPageData(r *http.Request) registrationView {
+	return registrationView{
+		InviteOnly: registrationPolicy.Mode == registration.InviteOnly,
+		Closed:     registrationPolicy.Mode == registration.Closed,
+		InviteCode: requestInviteCode(r),
+	}
+}
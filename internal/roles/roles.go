@@ -0,0 +1,67 @@
+// Package roles defines the forum's roles and what each of them is allowed to do.
+package roles
+
+// Role is the site-wide role of an account, stored in users.role
+type Role string
+
+const (
+	// User is the default role: members can only manage their own posts and comments
+	User Role = "user"
+	// Moderator can remove any post or comment
+	Moderator Role = "moderator"
+	// Admin can do everything, including handing out roles
+	Admin Role = "admin"
+)
+
+// All lists the roles from least to most privileged
+var All = []Role{User, Moderator, Admin}
+
+// Permission is something a role may be allowed to do
+type Permission string
+
+const (
+	// ModeratePosts allows deleting posts and comments written by others
+	ModeratePosts Permission = "moderate_posts"
+	// ManageInvites allows creating and revoking invite codes
+	ManageInvites Permission = "manage_invites"
+	// ManageRoles allows changing roles and assigning category moderators
+	ManageRoles Permission = "manage_roles"
+	// ManageCategories allows creating, editing, archiving and deleting categories
+	ManageCategories Permission = "manage_categories"
+)
+
+// grants lists the permissions of each role
+var grants = map[Role][]Permission{
+	User:      nil,
+	Moderator: {ModeratePosts},
+	Admin:     {ModeratePosts, ManageInvites, ManageRoles, ManageCategories},
+}
+
+// CategoryPermissions are the permissions a category moderator holds within their categories
+var CategoryPermissions = []Permission{ModeratePosts}
+
+// Valid reports whether role is a known role
+func Valid(role Role) bool {
+	_, ok := grants[role]
+	return ok
+}
+
+// Has reports whether the role holds perm. Unknown roles hold nothing.
+func (role Role) Has(perm Permission) bool {
+	for _, p := range grants[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// GrantedToCategoryModerators reports whether category moderators hold perm within their categories
+func GrantedToCategoryModerators(perm Permission) bool {
+	for _, p := range CategoryPermissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
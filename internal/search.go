@@ -0,0 +1,193 @@
+package root
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"net/url"
+	database "root/internal/database"
+	"root/internal/models"
+	"strings"
+	"time"
+)
+
+// searchDateLayout is how the date filters of a search are written, as <input type="date"> sends them
+const searchDateLayout = "2006-01-02"
+
+// searchParams are the query parameters a search is made of, kept on links to its other pages
+var searchParams = []string{"q", "in", "category", "author", "from", "to"}
+
+// searchTargetLabels name what a search can look through on the search page's tabs
+var searchTargetLabels = map[string]string{
+	database.SearchPosts:    "Posts",
+	database.SearchComments: "Comments",
+}
+
+// searchHit is a search result as the search page shows it
+type searchHit struct {
+	models.SearchResult
+	Excerpt template.HTML
+	URL     string
+}
+
+// searchRequest reads a search from the query string: the words in q, posts or comments
+// with in, and the category (by slug or name), author and from and to dates it is limited
+// to. Both dates are included.
+func searchRequest(r *http.Request) (database.SearchQuery, error) {
+	params := r.URL.Query()
+	query := database.SearchQuery{
+		Text:   params.Get("q"),
+		In:     params.Get("in"),
+		Author: strings.TrimSpace(params.Get("author")),
+	}
+	switch query.In {
+	case "":
+		query.In = database.SearchPosts
+	case database.SearchPosts, database.SearchComments:
+	default:
+		return query, fmt.Errorf("in must be %s or %s", database.SearchPosts, database.SearchComments)
+	}
+
+	if value := params.Get("category"); value != "" {
+		categories, err := database.FetchCategories()
+		if err != nil {
+			return query, err
+		}
+		category, ok := findCategory(categories, value)
+		if !ok {
+			return query, errors.New("unknown category " + value)
+		}
+		query.CategoryID = category.ID
+	}
+
+	if value := params.Get("from"); value != "" {
+		from, err := time.Parse(searchDateLayout, value)
+		if err != nil {
+			return query, errors.New("from must be a date like 2024-01-31")
+		}
+		query.From = from
+	}
+	if value := params.Get("to"); value != "" {
+		to, err := time.Parse(searchDateLayout, value)
+		if err != nil {
+			return query, errors.New("to must be a date like 2024-01-31")
+		}
+		query.Until = to.AddDate(0, 0, 1)
+	}
+	return query, nil
+}
+
+// searchURL is the address of the search in r, without its page cursor, with the parameters
+// in changes set as well
+func searchURL(r *http.Request, changes url.Values) string {
+	params := url.Values{}
+	for _, name := range searchParams {
+		if value := r.URL.Query().Get(name); value != "" {
+			params.Set(name, value)
+		}
+	}
+	for name, values := range changes {
+		params[name] = values
+	}
+	return "/search?" + params.Encode()
+}
+
+// highlight escapes a search snippet and marks the words it matched
+func highlight(snippet string) template.HTML {
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, database.HighlightStart, "<mark>")
+	escaped = strings.ReplaceAll(escaped, database.HighlightEnd, "</mark>")
+	return template.HTML(escaped)
+}
+
+// searchResultURL is the address of the post or comment a search result is
+func searchResultURL(result models.SearchResult) string {
+	if result.CommentID != 0 {
+		return fmt.Sprintf("/posts/%d#comment=%d", result.PostID, result.CommentID)
+	}
+	return fmt.Sprintf("/posts/%d", result.PostID)
+}
+
+// SearchPage searches posts or comments at /search and shows a page of the best matches
+func SearchPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	query, err := searchRequest(r)
+	if err != nil {
+		http.Redirect(w, r, "/400", http.StatusSeeOther)
+		return
+	}
+	results, err := database.Search(query, pageRequest(r))
+	if err == database.ErrBadCursor {
+		http.Redirect(w, r, "/400", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	categories, err := database.FetchCategories()
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	params := r.URL.Query()
+	data := struct {
+		CSRFToken  string
+		SignedIn   bool
+		Text       string
+		In         string
+		Category   string
+		Author     string
+		From       string
+		To         string
+		Categories []models.Category
+		Targets    []models.SortLink
+		Searched   bool
+		Results    []searchHit
+		NextURL    string
+		PrevURL    string
+	}{
+		CSRFToken:  csrfToken(r),
+		SignedIn:   sessionUserID(r) != 0,
+		Text:       query.Text,
+		In:         query.In,
+		Category:   params.Get("category"),
+		Author:     query.Author,
+		From:       params.Get("from"),
+		To:         params.Get("to"),
+		Categories: categories,
+		Searched:   strings.TrimSpace(query.Text) != "",
+	}
+	for _, target := range []string{database.SearchPosts, database.SearchComments} {
+		data.Targets = append(data.Targets, models.SortLink{
+			Label:  searchTargetLabels[target],
+			URL:    searchURL(r, url.Values{"in": {target}}),
+			Active: target == query.In,
+		})
+	}
+	for _, result := range results.Results {
+		data.Results = append(data.Results, searchHit{
+			SearchResult: result,
+			Excerpt:      highlight(result.Snippet),
+			URL:          searchResultURL(result),
+		})
+	}
+	if results.Next != "" {
+		data.NextURL = searchURL(r, url.Values{"after": {results.Next}})
+	}
+	if results.Prev != "" {
+		data.PrevURL = searchURL(r, url.Values{"before": {results.Prev}})
+	}
+
+	err = templates.ExecuteTemplate(w, "search.html", data)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+	}
+}
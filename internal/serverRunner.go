@@ -1,48 +1,105 @@
 package root
 
 import (
+	"database/sql"
 	"fmt"
 	"html/template"
 	"io"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"root/internal/config"
 	database "root/internal/database"
 	"root/internal/models"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/gofrs/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func ServerRunner() {
-	http.HandleFunc("/", RootHandler)                  // Home page
-	http.HandleFunc("/auth", Auth)                     // Authentication page
-	http.HandleFunc("/register", Register)             // Registration form
-	http.HandleFunc("/login", Login)                   // Login form
-	http.HandleFunc("/logout", Logout)                 // Logout
-	http.HandleFunc("/createpost", CreatePost)         // Post Handler
-	http.HandleFunc("/createcomment", CreateComment)   // Comment Handler
-	http.HandleFunc("/auth/google", handleGoogleLogin) // Google login
-	http.HandleFunc("/auth/callback", handleGoogleCallback)
-	http.HandleFunc("/auth/github", handleGitHubLogin) // GitHub login
-	http.HandleFunc("/auth/github/callback", handleGitHubCallback)
-	http.HandleFunc("/like", LikePost)                 // Like Handler
-	http.HandleFunc("/dislike", DislikePost)           // Dislike Handler
-	http.HandleFunc("/Commentlike", LikeComment)       // Comment Like Handler
-	http.HandleFunc("/Commentdislike", DislikeComment) // Comment Dislike Handler
-	http.HandleFunc("/inPostlike", inLikePost)
-	http.HandleFunc("/inPostdislike", inDislikePost)
-	http.HandleFunc("/profilePicture", UpdateProfileColor)
-	http.HandleFunc("/redirect", Redirect)
+func ServerRunner(cfg *config.Config) {
+	templates = template.Must(template.ParseGlob("./assets/templates/*.html"))
+	setupOAuthProviders(cfg)
+	if err := setupMailer(cfg); err != nil {
+		fmt.Println("Mail error:", err)
+		return
+	}
+	setupEmailVerification(cfg)
+	setupPasswordPolicy(cfg)
+	if err := setupRegistrationPolicy(cfg); err != nil {
+		fmt.Println("Registration policy error:", err)
+		return
+	}
+
+	http.HandleFunc("/", RootHandler)                   // Home page
+	http.HandleFunc("/auth", Auth)                      // Authentication page
+	http.HandleFunc("/register", Register)              // Registration form
+	http.HandleFunc("/login", Login)                    // Login form
+	http.HandleFunc("/logout", withCSRF(Logout))        // Logout
+	http.HandleFunc("/logout/all", withCSRF(LogoutAll)) // Sign out everywhere
+	http.HandleFunc("/account", Account)
+	http.HandleFunc("/account/identities/link", withCSRF(LinkProvider))
+	http.HandleFunc("/account/identities/unlink", withCSRF(UnlinkProvider))
+	http.HandleFunc("/account/2fa", TwoFactor)
+	http.HandleFunc("/account/2fa/enable", withCSRF(EnableTwoFactor))
+	http.HandleFunc("/account/2fa/disable", withCSRF(DisableTwoFactor))
+	http.HandleFunc("/login/2fa", withCSRF(LoginTwoFactor)) // Second login step
+	http.HandleFunc("/account/sessions", AccountSessions)
+	http.HandleFunc("/account/sessions/revoke", withCSRF(RevokeSession))
+	http.HandleFunc("/account/tokens", APITokens) // Personal access tokens
+	http.HandleFunc("/account/tokens/create", withCSRF(CreateAPIToken))
+	http.HandleFunc("/account/tokens/revoke", withCSRF(RevokeAPIToken))
+	http.HandleFunc("/admin/invites", AdminInvites) // Invite management
+	http.HandleFunc("/admin/invites/create", withCSRF(CreateInvite))
+	http.HandleFunc("/admin/invites/revoke", withCSRF(RevokeInvite))
+	http.HandleFunc("/admin/roles", AdminRoles) // Roles and category moderators
+	http.HandleFunc("/admin/roles/set", withCSRF(SetRole))
+	http.HandleFunc("/admin/roles/categories/add", withCSRF(AddCategoryModerator))
+	http.HandleFunc("/admin/roles/categories/remove", withCSRF(RemoveCategoryModerator))
+	http.HandleFunc("/admin/categories", AdminCategories) // Category management
+	http.HandleFunc("/admin/categories/create", withCSRF(CreateCategory))
+	http.HandleFunc("/admin/categories/update", withCSRF(UpdateCategory))
+	http.HandleFunc("/admin/categories/delete", withCSRF(DeleteCategory))
+	http.HandleFunc("GET /c/{slug}", CategoryPage)                                              // Category landing page
+	http.HandleFunc("GET /posts/{id}", PostPage)                                                // Single post with its comments
+	http.HandleFunc("GET /feed", FeedPage)                                                      // Next page of a post list, as HTML
+	http.HandleFunc("GET /search", SearchPage)                                                  // Full-text search of posts and comments
+	http.HandleFunc("/createpost", withCSRF(requireVerifiedEmail("post", CreatePost)))          // Post Handler
+	http.HandleFunc("/createcomment", withCSRF(requireVerifiedEmail("comment", CreateComment))) // Comment Handler
+	http.HandleFunc("/auth/{provider}", handleOAuthLogin)                                       // OAuth login (Google, GitHub, ...)
+	http.HandleFunc("/auth/{provider}/callback", handleOAuthCallback)
+	http.HandleFunc("/auth/callback", handleOAuthCallback)        // Google's original redirect URI
+	http.HandleFunc("/auth/signup", OAuthSignup)                  // Username step for first-time OAuth users
+	http.HandleFunc("/password/forgot", withCSRF(ForgotPassword)) // Request a password reset link
+	http.HandleFunc("/password/reset", withCSRF(ResetPassword))   // Choose a new password
+	http.HandleFunc("/email/verify", VerifyEmail)                 // Confirm an email address
+	http.HandleFunc("/email/verify/resend", withCSRF(ResendVerification))
+	http.HandleFunc("/like", withCSRF(requireVerifiedEmail("react", LikePost)))                 // Like Handler
+	http.HandleFunc("/dislike", withCSRF(requireVerifiedEmail("react", DislikePost)))           // Dislike Handler
+	http.HandleFunc("/Commentlike", withCSRF(requireVerifiedEmail("react", LikeComment)))       // Comment Like Handler
+	http.HandleFunc("/Commentdislike", withCSRF(requireVerifiedEmail("react", DislikeComment))) // Comment Dislike Handler
+	http.HandleFunc("/inPostlike", withCSRF(requireVerifiedEmail("react", inLikePost)))
+	http.HandleFunc("/inPostdislike", withCSRF(requireVerifiedEmail("react", inDislikePost)))
+	http.HandleFunc("/profilePicture", withCSRF(UpdateProfileColor))
+	http.HandleFunc("/deletepost", withCSRF(DeletePost))       // Delete own or moderated post
+	http.HandleFunc("/deletecomment", withCSRF(DeleteComment)) // Delete own or moderated comment
+	http.HandleFunc("GET /api/me", withAPIToken("", APIMe))    // JSON API for personal access tokens
+	http.HandleFunc("GET /api/posts", withAPIToken("read", APIListPosts))
+	http.HandleFunc("POST /api/posts", withAPIToken("post", APICreatePost))
+	http.HandleFunc("GET /api/posts/{id}", withAPIToken("read", APIGetPost))
+	http.HandleFunc("POST /api/posts/{id}/comments", withAPIToken("comment", APICreateComment))
+	http.HandleFunc("POST /api/posts/{id}/like", withAPIToken("react", APILikePost))
+	http.HandleFunc("POST /api/posts/{id}/dislike", withAPIToken("react", APIDislikePost))
+	http.HandleFunc("GET /api/search", withAPIToken("read", APISearch))
 	http.HandleFunc("/assets/uploads", NotFound)
 	http.HandleFunc("/assets/images", NotFound)
 	http.HandleFunc("/assets/static", InternalServerError)
 	http.HandleFunc("/404", NotFound)
 	http.HandleFunc("/500", InternalServerError)
 	http.HandleFunc("/400", BadRequest)
+	http.HandleFunc("/403", Forbidden)
 	http.HandleFunc("/405", Mnotallowed)
 	fs := http.FileServer(http.Dir("./assets/static"))
 	http.Handle("/assets/static/", http.StripPrefix("/assets/static/", fs))
@@ -64,15 +121,6 @@ var (
 	maxPosts = 0
 )
 
-func Redirect(w http.ResponseWriter, r *http.Request) {
-	postID := r.URL.Query().Get("post_id")
-	if postID == "" {
-		http.Redirect(w, r, "/400", http.StatusSeeOther)
-		return
-	}
-	http.Redirect(w, r, fmt.Sprintf("/#post=%s", postID), http.StatusSeeOther)
-}
-
 // RootHandler checks if a user is logged in and redirects accordingly
 func RootHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -99,52 +147,50 @@ func RootHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Initialize post variables
-	var posts []models.Post
-	var memesPosts []models.MemesPosts
-	var gamingPosts []models.GamingPosts
-	var educationPosts []models.EducationPosts
-	var technologyPosts []models.TechnologyPosts
-	var sciencePosts []models.SciencePosts
-	var sportsPosts []models.SportsPosts
-
-	// Fetch posts and categories for both guests and logged-in users
-	posts, err = database.FetchPosts(userID)
-	if err != nil {
-		http.Redirect(w, r, "/500", http.StatusSeeOther)
-		return
-	}
-
-	// Fetch category posts
-	memesPosts, err = database.FetchMemesPostsByCategoryID(2, userID)
-	if err != nil {
-		http.Redirect(w, r, "/500", http.StatusSeeOther)
-		return
-	}
-	gamingPosts, err = database.FetchGamingPostsByCategoryID(3, userID)
+	// Fetch a page of the feed in the order asked for and the categories for both guests and logged-in users
+	sort, err := sortRequest(r)
 	if err != nil {
-		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		http.Redirect(w, r, "/400", http.StatusSeeOther)
 		return
 	}
-	educationPosts, err = database.FetcheEducationPostsByCategoryID(4, userID)
-	if err != nil {
-		http.Redirect(w, r, "/500", http.StatusSeeOther)
+	feed, err := database.FetchFeedPage(userID, sort, pageRequest(r))
+	if err == database.ErrBadCursor {
+		http.Redirect(w, r, "/400", http.StatusSeeOther)
 		return
 	}
-	technologyPosts, err = database.FetchTechnologyPostsByCategoryID(5, userID)
 	if err != nil {
 		http.Redirect(w, r, "/500", http.StatusSeeOther)
 		return
 	}
-	sciencePosts, err = database.FetchSciencePostsByCategoryID(6, userID)
+
+	// The general category is the home feed itself, so it gets no section of its own.
+	// Top-level categories get a section with the newest posts of their subcategories included;
+	// the rest are on the category's own page.
+	allCategories, err := database.FetchCategories()
 	if err != nil {
 		http.Redirect(w, r, "/500", http.StatusSeeOther)
 		return
 	}
-	sportsPosts, err = database.FetchSportsPostsByCategoryID(7, userID)
-	if err != nil {
-		http.Redirect(w, r, "/500", http.StatusSeeOther)
-		return
+	var categories, postCategories []models.Category
+	threads := [][]models.Post{feed.Posts}
+	for _, category := range allCategories {
+		if category.Slug == database.GeneralCategorySlug {
+			continue
+		}
+		if !category.Archived {
+			postCategories = append(postCategories, category)
+		}
+		if category.ParentID != 0 {
+			continue
+		}
+		section, err := database.FetchCategoryPage(category.ID, userID, database.Sort{}, database.PageRequest{})
+		if err != nil {
+			http.Redirect(w, r, "/500", http.StatusSeeOther)
+			return
+		}
+		category.Posts = section.Posts
+		threads = append(threads, section.Posts)
+		categories = append(categories, category)
 	}
 
 	if isGuest {
@@ -156,21 +202,15 @@ func RootHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		guestData := struct {
-			Post            []models.Post
-			MemesPosts      []models.MemesPosts
-			GamingPosts     []models.GamingPosts
-			EducationPosts  []models.EducationPosts
-			TechnologyPosts []models.TechnologyPosts
-			SciencePosts    []models.SciencePosts
-			SportsPosts     []models.SportsPosts
+			Post       []models.Post
+			Feed       models.ListNav
+			Threads    []models.Post
+			Categories []models.Category
 		}{
-			Post:            posts,
-			MemesPosts:      memesPosts,
-			GamingPosts:     gamingPosts,
-			EducationPosts:  educationPosts,
-			TechnologyPosts: technologyPosts,
-			SciencePosts:    sciencePosts,
-			SportsPosts:     sportsPosts,
+			Post:       feed.Posts,
+			Feed:       listNav("/", "/feed", sort, feed),
+			Threads:    uniquePosts(threads...),
+			Categories: categories,
 		}
 
 		err = t.Execute(w, guestData)
@@ -193,17 +233,31 @@ func RootHandler(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/500", http.StatusSeeOther)
 		return
 	}
+	for _, profile := range userProfile {
+		threads = append(threads, profile.CreatedPosts.Posts, profile.LikedPosts.Posts, profile.DislikedPosts.Posts)
+	}
+
+	// Offer to delete the posts and comments this user may remove
+	perms, err := loadPermissions(userID)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	threadPosts := uniquePosts(threads...)
+	if err := perms.markDeletable(threadPosts); err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
 
 	// Prepare data for the template
 	data := models.Data{
-		UserProfile:     userProfile,
-		Post:            posts,
-		MemesPosts:      memesPosts,
-		GamingPosts:     gamingPosts,
-		EducationPosts:  educationPosts,
-		TechnologyPosts: technologyPosts,
-		SciencePosts:    sciencePosts,
-		SportsPosts:     sportsPosts,
+		CSRFToken:      csrfToken(r),
+		UserProfile:    userProfile,
+		Post:           feed.Posts,
+		Feed:           listNav("/", "/feed", sort, feed),
+		Threads:        threadPosts,
+		Categories:     categories,
+		PostCategories: postCategories,
 	}
 
 	// Execute template with user data
@@ -226,16 +280,7 @@ func Auth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	t, err := template.ParseFiles("./assets/templates/auth.html")
-	if err != nil {
-		http.Redirect(w, r, "/500", http.StatusSeeOther)
-		return
-	}
-	err2 := t.Execute(w, nil)
-	if err2 != nil {
-		http.Redirect(w, r, "/500", http.StatusSeeOther)
-		return
-	}
+	renderLoginPage(w, r, "")
 }
 
 // Register handles user registration
@@ -247,25 +292,28 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		}
 
 		username, password, secondpass, email := strings.TrimSpace(r.FormValue("username")), r.FormValue("password"), r.FormValue("secondpass"), r.FormValue("email")
-		// Validate input lengths
-		if len(username) > 50 || len(password) > 50 || len(username) < 3 || len(password) < 8 {
-			renderRegisterPage(w, r, "Username must be between 3-5 character and password must be between 8-50 character")
+		if username == "" || password == "" || email == "" {
+			renderRegisterPage(w, r, "All fields are required!")
 			return
 		}
 		if secondpass != password {
 			renderRegisterPage(w, r, "Passwords do not match")
 			return
 		}
-		if username == "" || password == "" || email == "" {
-			renderRegisterPage(w, r, "All fields are required!")
-			return
-		}
 
 		valid, msg := ValidateInput(username, email)
 		if !valid {
 			renderRegisterPage(w, r, msg)
 			return
 		}
+		if msg := checkRegistration(email, r.FormValue("invite_code")); msg != "" {
+			renderRegisterPage(w, r, msg)
+			return
+		}
+		if msg := checkNewPassword(password, username, email); msg != "" {
+			renderRegisterPage(w, r, msg)
+			return
+		}
 
 		// Check if the username already exists
 		exists, err := database.CheckUsernameExists(username)
@@ -296,13 +344,22 @@ func Register(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// Save the new user in the database using the existing InsertUser function
-		err = database.InsertUser(email, username, string(hashedPassword))
+		// Save the new user in the database, redeeming the invite code at the same time
+		userID, err := database.InsertUser(email, username, string(hashedPassword), signupInviteCode(r.FormValue("invite_code")))
+		if err == database.ErrInviteInvalid {
+			renderRegisterPage(w, r, "This invite code is not valid, or it has expired or been used up.")
+			return
+		}
 		if err != nil {
 			http.Redirect(w, r, "/500", http.StatusSeeOther)
 			return
 		}
 
+		// The account works right away; restricted actions wait for the emailed link
+		if err := sendVerificationEmail(userID, email); err != nil {
+			log.Printf("Sending verification email failed: %v", err)
+		}
+
 		// Redirect to login after successful registration
 		http.Redirect(w, r, "/auth", http.StatusSeeOther)
 		return
@@ -311,7 +368,9 @@ func Register(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-var templates = template.Must(template.ParseGlob("./assets/templates/*.html"))
+// templates holds the pages rendered by name. They are parsed when the server starts, from
+// the working directory, so tests can use the handlers that render none.
+var templates *template.Template
 
 // Login handles user login and renders the login page with error messages if needed
 func Login(w http.ResponseWriter, r *http.Request) {
@@ -322,40 +381,52 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		}
 
 		username, password := r.FormValue("username"), r.FormValue("password")
-		if len(username) > 50 || len(password) > 50 || len(username) < 3 || len(password) < 8 {
-			renderLoginPage(w, r, "Username must be between 3-50 characters and password between 8-50 characters")
-			return
-		}
 		if username == "" || password == "" {
 			renderLoginPage(w, r, "All fields are required")
 			return
 		}
+		// Older accounts may predate the current policy, so only refuse what can never match
+		if len(username) > 50 || len(username) < 3 || len(password) > maxPasswordBytes {
+			renderLoginPage(w, r, "Invalid username or password")
+			return
+		}
+
+		// Refuse before spending a bcrypt comparison on a throttled address or account;
+		// the attempt counts as failed until the password is accepted
+		if !reserveLoginAttempt(w, r, username) {
+			return
+		}
 
-		storedHashedPassword, err := database.FetchUserByUsername(username)
+		userID, storedHashedPassword, err := database.FetchUserByUsername(username)
+		if err == sql.ErrNoRows {
+			auditFailedLogin(r, username, "unknown_user")
+			renderLoginPage(w, r, "Invalid username or password")
+			return
+		}
 		if err != nil || bcrypt.CompareHashAndPassword([]byte(storedHashedPassword), []byte(password)) != nil {
+			auditFailedLogin(r, username, "bad_password")
 			renderLoginPage(w, r, "Invalid username or password")
 			return
 		}
+		passwordAccepted(r, username)
 
-		sessionToken, err := uuid.NewV4()
-		if err != nil {
+		// Accounts with two-factor enabled owe a code before a session is created
+		_, twoFactorEnabled, _, err := database.FetchTOTP(userID)
+		if err != nil && err != sql.ErrNoRows {
 			renderLoginPage(w, r, "Error creating session")
 			return
 		}
+		if twoFactorEnabled {
+			startLoginChallenge(w, r, userID)
+			return
+		}
 
-		err = database.StoreSessionToken(username, sessionToken.String())
+		err = startSession(w, r, userID)
 		if err != nil {
-			renderLoginPage(w, r, "Error storing session")
+			renderLoginPage(w, r, "Error creating session")
 			return
 		}
-
-		http.SetCookie(w, &http.Cookie{
-			Name:     "session_token",
-			Value:    sessionToken.String(),
-			Expires:  time.Now().Add(1 * time.Hour),
-			Path:     "/",
-			HttpOnly: true,
-		})
+		loginSucceeded(username)
 
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 	} else {
@@ -365,6 +436,11 @@ func Login(w http.ResponseWriter, r *http.Request) {
 
 // Logout handles user logout
 func Logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
 	// Check if the user has a session cookie
 	cookie, err := r.Cookie("session_token")
 	if err != nil {
@@ -381,13 +457,7 @@ func Logout(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Clear the session cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session_token",
-		Value:    "",
-		Expires:  time.Unix(0, 0), // Expire immediately
-		Path:     "/",
-		HttpOnly: true,
-	})
+	clearSessionCookie(w)
 
 	// Redirect to the login page after logout
 	http.Redirect(w, r, "/auth", http.StatusSeeOther)
@@ -398,9 +468,17 @@ func renderLoginPage(w http.ResponseWriter, r *http.Request, errorMessage string
 	data := struct {
 		ErrorMessage    string
 		RegErrorMessage string
+		Providers       []models.LoginProvider
+		PasswordHint    string
+		PasswordMax     int
+		Registration    registrationView
 	}{
 		ErrorMessage:    errorMessage,
 		RegErrorMessage: "",
+		Providers:       loginProviders(),
+		PasswordHint:    passwordPolicy.Hint(),
+		PasswordMax:     passwordPolicy.MaxLength,
+		Registration:    registrationPageData(r),
 	}
 
 	err := templates.ExecuteTemplate(w, "auth.html", data)
@@ -414,9 +492,17 @@ func renderRegisterPage(w http.ResponseWriter, r *http.Request, errorMessage str
 	data := struct {
 		ErrorMessage    string
 		RegErrorMessage string
+		Providers       []models.LoginProvider
+		PasswordHint    string
+		PasswordMax     int
+		Registration    registrationView
 	}{
 		RegErrorMessage: errorMessage,
 		ErrorMessage:    "",
+		Providers:       loginProviders(),
+		PasswordHint:    passwordPolicy.Hint(),
+		PasswordMax:     passwordPolicy.MaxLength,
+		Registration:    registrationPageData(r),
 	}
 
 	err := templates.ExecuteTemplate(w, "authreg.html", data)
@@ -455,6 +541,21 @@ func BadRequest(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Forbidden handles 403 errors
+func Forbidden(w http.ResponseWriter, r *http.Request) {
+	t, err := template.ParseFiles("./assets/templates/errors/403.html")
+	if err != nil {
+		http.Error(w, "403 forbidden", http.StatusForbidden)
+		return
+	}
+	w.WriteHeader(http.StatusForbidden)
+	err = t.Execute(w, nil)
+	if err != nil {
+		http.Error(w, "403 forbidden", http.StatusForbidden)
+		return
+	}
+}
+
 // Mnotallowed handles 405 errors
 func Mnotallowed(w http.ResponseWriter, r *http.Request) {
 	t, err := template.ParseFiles("./assets/templates/errors/405.html")
@@ -509,6 +610,17 @@ func CreatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Check the selected categories before anything is saved
+	categoryIDs, unknown, err := postCategoryIDs(r.Form["catInputs"])
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	if unknown != "" {
+		http.Redirect(w, r, "/400", http.StatusSeeOther)
+		return
+	}
+
 	// Handle media upload if present in the form
 	mediaFile, fileHeader, err := r.FormFile("postImage")
 	var filePath string
@@ -538,7 +650,8 @@ func CreatePost(w http.ResponseWriter, r *http.Request) {
 			".mov":  "video",
 			".avi":  "video",
 		}
-		_, valid := validExtensions[fileExtension]
+		var valid bool
+		fileType, valid = validExtensions[fileExtension]
 		if !valid {
 			http.Redirect(w, r, "/400", http.StatusSeeOther)
 			return
@@ -572,22 +685,8 @@ func CreatePost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Associate categories with the post
-	categories := r.Form["catInputs"] // Extract selected categories
-	if len(categories) > 0 {
-		for _, category := range categories {
-			categoryID, err := database.GetOrCreateCategory(category)
-			if err != nil {
-				http.Redirect(w, r, "/500", http.StatusSeeOther)
-				return
-			}
-			err = database.AssociatePostWithCategory(postID, categoryID)
-			if err != nil {
-				http.Redirect(w, r, "/500", http.StatusSeeOther)
-				return
-			}
-		}
-	} else {
-		err = database.AssociatePostWithCategory(postID, 1)
+	for _, categoryID := range categoryIDs {
+		err = database.AssociatePostWithCategory(postID, categoryID)
 		if err != nil {
 			http.Redirect(w, r, "/500", http.StatusSeeOther)
 			return
@@ -614,6 +713,11 @@ func CreateComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
 	content := strings.TrimSpace(r.FormValue("commentInput"))
 	postID := strings.TrimSpace(r.FormValue("hiddenID"))
 
@@ -622,50 +726,28 @@ func CreateComment(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/400", http.StatusSeeOther)
 		return
 	}
-	sessionToken, _ := r.Cookie("session_token")
-	userID, err := database.FetchUserIDBySessionToken(sessionToken.Value)
-	if err != nil {
-		return
-	}
-	posts, err := database.FetchPosts(userID)
-	if err != nil {
-		http.Redirect(w, r, "/400", http.StatusFound)
+	if _, err := database.FetchPostAuthor(intPostID); err != nil {
+		http.Redirect(w, r, "/400", http.StatusSeeOther)
 		return
 	}
-	for i, post := range posts {
-		if post.ID == intPostID {
-			break
-		} else if i == len(posts)-1 {
-			http.Redirect(w, r, "/400", http.StatusSeeOther)
-			return
-		}
-	}
 
 	if content == "" || len(content) > 366 {
 		http.Redirect(w, r, "/400", http.StatusFound)
 		return
 	}
 
-	cookie, err := r.Cookie("session_token")
-	if err != nil || cookie.Value == "" {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	userID, err = database.FetchUserIDBySessionToken(cookie.Value)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	commentID, err := database.InsertComment(userID, intPostID, content)
+	if err == database.ErrPostArchived {
+		http.Redirect(w, r, "/403", http.StatusSeeOther)
 		return
 	}
-
-	_, err = database.InsertComment(userID, intPostID, content)
 	if err != nil {
 		http.Redirect(w, r, "/500", http.StatusSeeOther)
 		return
 	}
 
-	// Redirect to the homepage after successful post creation
-	http.Redirect(w, r, fmt.Sprintf("/#CommentSection=%s", postID), http.StatusSeeOther)
+	// Show the new comment on the post's page
+	redirectToPost(w, r, postID, int(commentID))
 }
 
 // LikePost handles like action
@@ -695,12 +777,16 @@ func LikePost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err2 := database.LikePost(userID, postID)
+	if err2 == database.ErrPostArchived {
+		http.Redirect(w, r, "/403", http.StatusSeeOther)
+		return
+	}
 	if err2 != nil {
 		http.Redirect(w, r, "/500", http.StatusSeeOther)
 		return
 	}
 
-	http.Redirect(w, r, fmt.Sprintf("/#post=%s", postID), http.StatusSeeOther)
+	redirectToPost(w, r, postID, 0)
 }
 
 // DislikePost handles dislike action
@@ -730,12 +816,16 @@ func DislikePost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err2 := database.DislikePost(userID, postID)
+	if err2 == database.ErrPostArchived {
+		http.Redirect(w, r, "/403", http.StatusSeeOther)
+		return
+	}
 	if err2 != nil {
 		http.Redirect(w, r, "/500", http.StatusSeeOther)
 		return
 	}
 
-	http.Redirect(w, r, fmt.Sprintf("/#post=%s", postID), http.StatusSeeOther)
+	redirectToPost(w, r, postID, 0)
 }
 
 func inLikePost(w http.ResponseWriter, r *http.Request) {
@@ -764,12 +854,16 @@ func inLikePost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err2 := database.LikePost(userID, postID)
+	if err2 == database.ErrPostArchived {
+		http.Redirect(w, r, "/403", http.StatusSeeOther)
+		return
+	}
 	if err2 != nil {
 		http.Redirect(w, r, "/500", http.StatusSeeOther)
 		return
 	}
 
-	http.Redirect(w, r, fmt.Sprintf("/#CommentSection=%s", postID), http.StatusSeeOther)
+	redirectToPost(w, r, postID, 0)
 }
 
 func inDislikePost(w http.ResponseWriter, r *http.Request) {
@@ -798,12 +892,16 @@ func inDislikePost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err2 := database.DislikePost(userID, postID)
+	if err2 == database.ErrPostArchived {
+		http.Redirect(w, r, "/403", http.StatusSeeOther)
+		return
+	}
 	if err2 != nil {
 		http.Redirect(w, r, "/500", http.StatusSeeOther)
 		return
 	}
 
-	http.Redirect(w, r, fmt.Sprintf("/#CommentSection=%s", postID), http.StatusSeeOther)
+	redirectToPost(w, r, postID, 0)
 }
 
 func LikeComment(w http.ResponseWriter, r *http.Request) {
@@ -833,12 +931,17 @@ func LikeComment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err2 := database.LikeComment(userID, postID, CommentID)
+	if err2 == database.ErrPostArchived {
+		http.Redirect(w, r, "/403", http.StatusSeeOther)
+		return
+	}
 	if err2 != nil {
 		http.Redirect(w, r, "/500", http.StatusSeeOther)
 		return
 	}
 
-	http.Redirect(w, r, fmt.Sprintf("#CommentSection=%s", postID), http.StatusSeeOther)
+	commentID, _ := strconv.Atoi(CommentID)
+	redirectToPost(w, r, postID, commentID)
 }
 
 func DislikeComment(w http.ResponseWriter, r *http.Request) {
@@ -868,12 +971,137 @@ func DislikeComment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	err2 := database.DislikeComment(userID, postID, CommentID)
+	if err2 == database.ErrPostArchived {
+		http.Redirect(w, r, "/403", http.StatusSeeOther)
+		return
+	}
 	if err2 != nil {
 		http.Redirect(w, r, "/500", http.StatusSeeOther)
 		return
 	}
 
-	http.Redirect(w, r, fmt.Sprintf("#CommentSection=%s", postID), http.StatusSeeOther)
+	commentID, _ := strconv.Atoi(CommentID)
+	redirectToPost(w, r, postID, commentID)
+}
+
+// DeletePost deletes a post with its comments and media. Authors may delete their own
+// posts; moderators and moderators of one of the post's categories may delete any.
+func DeletePost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	userID, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	postID, err := strconv.Atoi(r.FormValue("post_id"))
+	if err != nil {
+		http.Redirect(w, r, "/400", http.StatusSeeOther)
+		return
+	}
+	authorID, err := database.FetchPostAuthor(postID)
+	if err == sql.ErrNoRows {
+		http.Redirect(w, r, "/404", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	perms, err := loadPermissions(userID)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	allowed, err := perms.canDelete(authorID, postID)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	if !allowed {
+		http.Redirect(w, r, "/403", http.StatusSeeOther)
+		return
+	}
+
+	files, err := database.DeletePost(postID)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	if authorID != userID {
+		log.Printf("Post %d by user %d deleted by moderator %d", postID, authorID, userID)
+	}
+
+	// Only ever remove files from the uploads directory
+	for _, file := range files {
+		file = filepath.Clean(file)
+		if filepath.Dir(file) != filepath.Clean("./assets/uploads") {
+			continue
+		}
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			log.Printf("Removing %s failed: %v", file, err)
+		}
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// DeleteComment deletes a comment. Authors may delete their own comments; moderators
+// and moderators of one of the post's categories may delete any.
+func DeleteComment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	userID, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	commentID, err := strconv.Atoi(r.FormValue("comment_id"))
+	if err != nil {
+		http.Redirect(w, r, "/400", http.StatusSeeOther)
+		return
+	}
+	authorID, postID, err := database.FetchCommentAuthor(commentID)
+	if err == sql.ErrNoRows {
+		http.Redirect(w, r, "/404", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	perms, err := loadPermissions(userID)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	allowed, err := perms.canDelete(authorID, postID)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	if !allowed {
+		http.Redirect(w, r, "/403", http.StatusSeeOther)
+		return
+	}
+
+	if err := database.DeleteComment(commentID); err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	if authorID != userID {
+		log.Printf("Comment %d by user %d deleted by moderator %d", commentID, authorID, userID)
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/posts/%d", postID), http.StatusSeeOther)
 }
 
 func UpdateProfileColor(w http.ResponseWriter, r *http.Request) {
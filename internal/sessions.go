@@ -0,0 +1,218 @@
+package root
+
+import (
+	"net"
+	"net/http"
+	database "root/internal/database"
+	"root/internal/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+)
+
+// startSession creates a new server-side session for the user and sets the session cookie
+func startSession(w http.ResponseWriter, r *http.Request, userID int) error {
+	sessionToken, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+
+	// Opportunistically clean up sessions that have already expired
+	if err := database.DeleteExpiredSessions(); err != nil {
+		return err
+	}
+
+	_, err = database.CreateSession(userID, sessionToken.String(), r.UserAgent(), clientIP(r))
+	if err != nil {
+		return err
+	}
+
+	// The cookie lives as long as the session could possibly live; the server enforces idle expiry
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_token",
+		Value:    sessionToken.String(),
+		Expires:  time.Now().Add(database.SessionMaxLifetime),
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// clearSessionCookie expires the session cookie in the browser
+func clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_token",
+		Value:    "",
+		Expires:  time.Unix(0, 0), // Expire immediately
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// clientIP returns the remote address of the request without the port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// LogoutAll signs the user out of every device by deleting all of their sessions
+func LogoutAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	cookie, err := r.Cookie("session_token")
+	if err != nil || cookie.Value == "" {
+		http.Redirect(w, r, "/auth", http.StatusSeeOther)
+		return
+	}
+
+	userID, err := database.FetchUserIDBySessionToken(cookie.Value)
+	if err != nil {
+		clearSessionCookie(w)
+		http.Redirect(w, r, "/auth", http.StatusSeeOther)
+		return
+	}
+
+	err = database.DeleteUserSessions(userID)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	clearSessionCookie(w)
+	http.Redirect(w, r, "/auth", http.StatusSeeOther)
+}
+
+// AccountSessions lists every device the user is signed in from
+func AccountSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	cookie, err := r.Cookie("session_token")
+	if err != nil || cookie.Value == "" {
+		http.Redirect(w, r, "/auth", http.StatusSeeOther)
+		return
+	}
+
+	userID, err := database.FetchUserIDBySessionToken(cookie.Value)
+	if err != nil {
+		http.Redirect(w, r, "/auth", http.StatusSeeOther)
+		return
+	}
+
+	sessions, err := database.FetchUserSessions(userID, cookie.Value)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	for i := range sessions {
+		sessions[i].Device = describeUserAgent(sessions[i].UserAgent)
+	}
+
+	data := struct {
+		CSRFToken string
+		Sessions  []models.Session
+	}{
+		CSRFToken: csrfToken(r),
+		Sessions:  sessions,
+	}
+
+	err = templates.ExecuteTemplate(w, "sessions.html", data)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+}
+
+// RevokeSession signs a single device out
+func RevokeSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	sessionID, err := strconv.Atoi(r.FormValue("session_id"))
+	if err != nil {
+		http.Redirect(w, r, "/400", http.StatusSeeOther)
+		return
+	}
+
+	cookie, err := r.Cookie("session_token")
+	if err != nil || cookie.Value == "" {
+		http.Redirect(w, r, "/auth", http.StatusSeeOther)
+		return
+	}
+
+	userID, err := database.FetchUserIDBySessionToken(cookie.Value)
+	if err != nil {
+		http.Redirect(w, r, "/auth", http.StatusSeeOther)
+		return
+	}
+
+	err = database.DeleteUserSession(userID, sessionID)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	// Revoking the session we are using is the same as logging out
+	if _, err := database.FetchUserIDBySessionToken(cookie.Value); err != nil {
+		clearSessionCookie(w)
+		http.Redirect(w, r, "/auth", http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, "/account/sessions", http.StatusSeeOther)
+}
+
+// describeUserAgent turns a raw User-Agent header into a short "Browser on OS" label
+func describeUserAgent(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown device"
+	}
+
+	browser := "Unknown browser"
+	switch {
+	case strings.Contains(userAgent, "Edg/"):
+		browser = "Edge"
+	case strings.Contains(userAgent, "OPR/"):
+		browser = "Opera"
+	case strings.Contains(userAgent, "Firefox/"):
+		browser = "Firefox"
+	case strings.Contains(userAgent, "Chrome/"):
+		browser = "Chrome"
+	case strings.Contains(userAgent, "Safari/"):
+		browser = "Safari"
+	case strings.Contains(userAgent, "curl/"):
+		browser = "curl"
+	}
+
+	system := "unknown OS"
+	switch {
+	case strings.Contains(userAgent, "Android"):
+		system = "Android"
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"):
+		system = "iOS"
+	case strings.Contains(userAgent, "Windows"):
+		system = "Windows"
+	case strings.Contains(userAgent, "Mac OS X"):
+		system = "macOS"
+	case strings.Contains(userAgent, "Linux"):
+		system = "Linux"
+	}
+
+	return browser + " on " + system
+}
@@ -0,0 +1,194 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the limiter what time it is, so tests can drive it with a fake clock
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the real wall clock
+type SystemClock struct{}
+
+// Now returns the current time
+func (SystemClock) Now() time.Time { return time.Now() }
+
+// Policy describes how quickly a key is slowed down and when it is locked out
+type Policy struct {
+	// FreeAttempts failures are allowed before any delay applies
+	FreeAttempts int
+	// BaseDelay is the wait after the first failure past FreeAttempts; it doubles with every further failure
+	BaseDelay time.Duration
+	// MaxDelay caps the exponential backoff
+	MaxDelay time.Duration
+	// LockoutAfter failures lock the key for LockoutDuration
+	LockoutAfter    int
+	LockoutDuration time.Duration
+	// ForgetAfter is how long a key must stay quiet before its failures are forgotten
+	ForgetAfter time.Duration
+}
+
+// entry is the failure history of one key
+type entry struct {
+	failures    int
+	lastFailure time.Time
+}
+
+// Limiter counts failures per key (an IP address, a username, ...) in memory
+type Limiter struct {
+	policy Policy
+	clock  Clock
+
+	mu        sync.Mutex
+	entries   map[string]*entry
+	lastPrune time.Time
+}
+
+// New returns a limiter applying policy, reading the time from clock
+func New(policy Policy, clock Clock) *Limiter {
+	return &Limiter{
+		policy:  policy,
+		clock:   clock,
+		entries: map[string]*entry{},
+	}
+}
+
+// Check returns how long the key has to wait before its next attempt is allowed,
+// and whether that wait is a lockout rather than a backoff delay. Zero means go ahead.
+func (l *Limiter) Check(key string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.wait(key, l.clock.Now())
+}
+
+// Attempt is Check and Failure in one step: when the key may go ahead, the attempt is
+// counted as a failure right away, before the caller knows how it turns out, so parallel
+// attempts cannot all pass the check before any of them is counted. An attempt that
+// succeeds is given back with Refund or Success. A key that has to wait is not counted.
+func (l *Limiter) Attempt(key string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	if wait, locked := l.wait(key, now); wait > 0 {
+		return wait, locked
+	}
+	l.fail(key, now)
+	return 0, false
+}
+
+// Refund gives back one attempt counted by Attempt
+func (l *Limiter) Refund(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, ok := l.entries[key]
+	if !ok {
+		return
+	}
+	e.failures--
+	if e.failures <= 0 {
+		delete(l.entries, key)
+	}
+}
+
+// Failure records a failed attempt for the key
+func (l *Limiter) Failure(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.fail(key, l.clock.Now())
+}
+
+// Success forgets the failures of the key
+func (l *Limiter) Success(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.entries, key)
+}
+
+// wait is Check without the lock
+func (l *Limiter) wait(key string, now time.Time) (time.Duration, bool) {
+	l.prune(now)
+
+	e := l.live(key, now)
+	if e == nil {
+		return 0, false
+	}
+	if l.locked(e) {
+		return e.lastFailure.Add(l.policy.LockoutDuration).Sub(now), true
+	}
+	if wait := e.lastFailure.Add(l.delay(e.failures)).Sub(now); wait > 0 {
+		return wait, false
+	}
+	return 0, false
+}
+
+// fail is Failure without the lock
+func (l *Limiter) fail(key string, now time.Time) {
+	e := l.live(key, now)
+	if e == nil {
+		e = &entry{}
+		l.entries[key] = e
+	}
+	e.failures++
+	e.lastFailure = now
+}
+
+// live returns the failure history of the key, forgetting it once a lockout has run out
+// or the key has been quiet for longer than ForgetAfter
+func (l *Limiter) live(key string, now time.Time) *entry {
+	e, ok := l.entries[key]
+	if !ok {
+		return nil
+	}
+	if l.locked(e) {
+		if now.Before(e.lastFailure.Add(l.policy.LockoutDuration)) {
+			return e
+		}
+	} else if now.Sub(e.lastFailure) <= l.policy.ForgetAfter {
+		return e
+	}
+	delete(l.entries, key)
+	return nil
+}
+
+// locked reports whether the entry has reached the lockout threshold
+func (l *Limiter) locked(e *entry) bool {
+	return l.policy.LockoutAfter > 0 && e.failures >= l.policy.LockoutAfter
+}
+
+// delay is the exponential backoff owed after the given number of failures
+func (l *Limiter) delay(failures int) time.Duration {
+	over := failures - l.policy.FreeAttempts
+	if over <= 0 {
+		return 0
+	}
+
+	d := l.policy.BaseDelay
+	for i := 1; i < over && d < l.policy.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > l.policy.MaxDelay {
+		d = l.policy.MaxDelay
+	}
+	return d
+}
+
+// prune drops keys that have been quiet for longer than ForgetAfter (and any finished
+// lockout), at most once per ForgetAfter, so the map cannot grow without bound
+func (l *Limiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < l.policy.ForgetAfter {
+		return
+	}
+	l.lastPrune = now
+
+	for key := range l.entries {
+		l.live(key, now)
+	}
+}
@@ -0,0 +1,261 @@
+package throttle
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock the tests move forward by hand
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+// testPolicy allows two free failures, then waits 1s, 2s, 4s, ... up to 10s, and locks
+// the key for 15 minutes at the sixth failure
+var testPolicy = Policy{
+	FreeAttempts:    2,
+	BaseDelay:       time.Second,
+	MaxDelay:        10 * time.Second,
+	LockoutAfter:    6,
+	LockoutDuration: 15 * time.Minute,
+	ForgetAfter:     time.Hour,
+}
+
+// fail records n failures for key without letting time pass
+func fail(l *Limiter, key string, n int) {
+	for i := 0; i < n; i++ {
+		l.Failure(key)
+	}
+}
+
+func expectWait(t *testing.T, l *Limiter, key string, wantWait time.Duration, wantLocked bool) {
+	t.Helper()
+	wait, locked := l.Check(key)
+	if wait != wantWait || locked != wantLocked {
+		t.Fatalf("Check(%q) = %v, %v; want %v, %v", key, wait, locked, wantWait, wantLocked)
+	}
+}
+
+func TestBackoffDoubles(t *testing.T) {
+	policy := testPolicy
+	policy.LockoutAfter = 0
+	clock := newFakeClock()
+	l := New(policy, clock)
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 0},
+		{2, 0},
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{5, 4 * time.Second},
+		{6, 8 * time.Second},
+		{7, 10 * time.Second},
+		{8, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		l.Failure("alice")
+		expectWait(t, l, "alice", tt.want, false)
+	}
+}
+
+func TestBackoffRunsOut(t *testing.T) {
+	clock := newFakeClock()
+	l := New(testPolicy, clock)
+
+	fail(l, "alice", 4)
+	expectWait(t, l, "alice", 2*time.Second, false)
+
+	clock.Advance(1500 * time.Millisecond)
+	expectWait(t, l, "alice", 500*time.Millisecond, false)
+
+	clock.Advance(500 * time.Millisecond)
+	expectWait(t, l, "alice", 0, false)
+}
+
+func TestLockoutAfterFailures(t *testing.T) {
+	clock := newFakeClock()
+	l := New(testPolicy, clock)
+
+	fail(l, "alice", testPolicy.LockoutAfter-1)
+	if _, locked := l.Check("alice"); locked {
+		t.Fatal("locked out one failure early")
+	}
+
+	l.Failure("alice")
+	expectWait(t, l, "alice", testPolicy.LockoutDuration, true)
+
+	clock.Advance(5 * time.Minute)
+	expectWait(t, l, "alice", 10*time.Minute, true)
+}
+
+func TestLockoutExpires(t *testing.T) {
+	clock := newFakeClock()
+	l := New(testPolicy, clock)
+
+	fail(l, "alice", testPolicy.LockoutAfter)
+	clock.Advance(testPolicy.LockoutDuration)
+	expectWait(t, l, "alice", 0, false)
+
+	// The expired lockout is forgotten, so the next failure is a free one again
+	l.Failure("alice")
+	expectWait(t, l, "alice", 0, false)
+}
+
+func TestFailuresAreForgotten(t *testing.T) {
+	clock := newFakeClock()
+	l := New(testPolicy, clock)
+
+	fail(l, "alice", 4)
+	clock.Advance(testPolicy.ForgetAfter)
+	l.Failure("alice")
+	expectWait(t, l, "alice", 4*time.Second, false)
+
+	clock.Advance(testPolicy.ForgetAfter + time.Second)
+	l.Failure("alice")
+	expectWait(t, l, "alice", 0, false)
+}
+
+func TestQuietKeysArePruned(t *testing.T) {
+	clock := newFakeClock()
+	l := New(testPolicy, clock)
+
+	fail(l, "alice", 1)
+	fail(l, "bob", testPolicy.LockoutAfter)
+	clock.Advance(testPolicy.ForgetAfter + time.Second)
+	l.Check("carol")
+
+	if len(l.entries) != 0 {
+		t.Fatalf("%d keys left after they went quiet, want 0", len(l.entries))
+	}
+}
+
+func TestSuccessResetsFailures(t *testing.T) {
+	clock := newFakeClock()
+	l := New(testPolicy, clock)
+
+	fail(l, "alice", 5)
+	expectWait(t, l, "alice", 4*time.Second, false)
+
+	l.Success("alice")
+	expectWait(t, l, "alice", 0, false)
+
+	// Counting starts over: the next failures are free again
+	fail(l, "alice", 2)
+	expectWait(t, l, "alice", 0, false)
+	l.Failure("alice")
+	expectWait(t, l, "alice", time.Second, false)
+}
+
+func TestKeysAreCountedIndependently(t *testing.T) {
+	clock := newFakeClock()
+	byIP := New(Policy{
+		FreeAttempts:    10,
+		BaseDelay:       time.Second,
+		MaxDelay:        time.Minute,
+		LockoutAfter:    50,
+		LockoutDuration: time.Hour,
+		ForgetAfter:     time.Hour,
+	}, clock)
+	byUsername := New(testPolicy, clock)
+
+	// One address guessing the passwords of several accounts
+	for _, username := range []string{"alice", "bob", "carol", "dave"} {
+		fail(byIP, "203.0.113.7", 3)
+		fail(byUsername, username, 3)
+	}
+
+	expectWait(t, byIP, "203.0.113.7", 2*time.Second, false)
+	expectWait(t, byIP, "198.51.100.1", 0, false)
+	for _, username := range []string{"alice", "bob", "carol", "dave"} {
+		expectWait(t, byUsername, username, time.Second, false)
+	}
+	expectWait(t, byUsername, "erin", 0, false)
+
+	byUsername.Success("alice")
+	expectWait(t, byUsername, "alice", 0, false)
+	expectWait(t, byUsername, "bob", time.Second, false)
+	expectWait(t, byIP, "203.0.113.7", 2*time.Second, false)
+}
+
+func TestParallelAttemptsAreCountedBeforeTheyRun(t *testing.T) {
+	clock := newFakeClock()
+	l := New(testPolicy, clock)
+
+	// Every guess is sent at once, before any of them has been answered
+	const guesses = 50
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	start := make(chan struct{})
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			if wait, _ := l.Attempt("alice"); wait == 0 {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	// The free attempts and the one that earns the first delay get through, nothing more
+	if want := testPolicy.FreeAttempts + 1; allowed != want {
+		t.Fatalf("%d of %d parallel attempts got through, want %d", allowed, guesses, want)
+	}
+	expectWait(t, l, "alice", time.Second, false)
+}
+
+func TestAttemptIsRefunded(t *testing.T) {
+	clock := newFakeClock()
+	l := New(testPolicy, clock)
+
+	fail(l, "alice", 2)
+	if wait, _ := l.Attempt("alice"); wait != 0 {
+		t.Fatalf("third attempt has to wait %v", wait)
+	}
+	expectWait(t, l, "alice", time.Second, false)
+
+	// The attempt turned out to be right, so only the two failures before it count
+	l.Refund("alice")
+	expectWait(t, l, "alice", 0, false)
+	l.Failure("alice")
+	expectWait(t, l, "alice", time.Second, false)
+
+	// A refunded first attempt leaves nothing behind
+	if wait, _ := l.Attempt("bob"); wait != 0 {
+		t.Fatalf("first attempt has to wait %v", wait)
+	}
+	l.Refund("bob")
+	if _, ok := l.entries["bob"]; ok {
+		t.Fatal("a refunded key is still tracked")
+	}
+}
+
+func TestWaitingAttemptIsNotCounted(t *testing.T) {
+	clock := newFakeClock()
+	l := New(testPolicy, clock)
+
+	fail(l, "alice", 3)
+	for i := 0; i < 10; i++ {
+		if wait, locked := l.Attempt("alice"); wait != time.Second || locked {
+			t.Fatalf("Attempt = %v, %v; want 1s, false", wait, locked)
+		}
+	}
+	expectWait(t, l, "alice", time.Second, false)
+}
@@ -0,0 +1,385 @@
+package root
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	database "root/internal/database"
+	"root/internal/totp"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"rsc.io/qr"
+)
+
+const (
+	// totpIssuer is the name authenticator apps show next to the code
+	totpIssuer = "Stellar Forum"
+	// recoveryCodeCount is how many recovery codes a user receives on enrollment
+	recoveryCodeCount = 10
+)
+
+// twoFactorPage is the data of the two-factor settings page
+type twoFactorPage struct {
+	CSRFToken     string
+	HasPassword   bool
+	Enabled       bool
+	Secret        string
+	URI           template.URL
+	QRCode        template.URL
+	RecoveryCodes []string
+	CodesLeft     int
+	ErrorMessage  string
+}
+
+// TwoFactor shows the two-factor settings, starting an enrollment when it is off
+func TwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	userID, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	renderTwoFactorPage(w, r, userID, nil, "")
+}
+
+// EnableTwoFactor confirms enrollment with the first code from the authenticator app
+func EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	userID, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	secret, enabled, _, err := database.FetchTOTP(userID)
+	if err == sql.ErrNoRows || enabled {
+		http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	step, valid := totp.Validate(secret, r.FormValue("code"), time.Now(), 0)
+	if !valid {
+		renderTwoFactorPage(w, r, userID, nil, "That code is not valid. Check the time on your device and try again.")
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	err = database.EnableTOTP(userID, step, hashes)
+	if err != nil && err != database.ErrTOTPAlreadyEnabled {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	// The recovery codes are only ever shown on this response
+	renderTwoFactorPage(w, r, userID, codes, "")
+}
+
+// DisableTwoFactor turns two-factor off after checking a current code or a recovery code
+func DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	userID, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	valid, err := verifySecondFactor(userID, r.FormValue("code"))
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	if !valid {
+		renderTwoFactorPage(w, r, userID, nil, "That code is not valid.")
+		return
+	}
+
+	if err := database.DisableTOTP(userID); err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/account/2fa", http.StatusSeeOther)
+}
+
+// renderTwoFactorPage renders the two-factor settings page. While two-factor is off it
+// shows the pending secret as a QR code; recoveryCodes are only passed right after enrollment.
+func renderTwoFactorPage(w http.ResponseWriter, r *http.Request, userID int, recoveryCodes []string, errorMessage string) {
+	data := twoFactorPage{
+		CSRFToken:     csrfToken(r),
+		RecoveryCodes: recoveryCodes,
+		ErrorMessage:  errorMessage,
+	}
+
+	var err error
+	data.HasPassword, err = database.UserHasPassword(userID)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	secret, enabled, _, err := database.FetchTOTP(userID)
+	if err != nil && err != sql.ErrNoRows {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	data.Enabled = enabled
+
+	switch {
+	case enabled:
+		codes, err := database.FetchUnusedRecoveryCodes(userID)
+		if err != nil {
+			http.Redirect(w, r, "/500", http.StatusSeeOther)
+			return
+		}
+		data.CodesLeft = len(codes)
+	case data.HasPassword:
+		// Keep showing the same secret until the enrollment is confirmed
+		if secret == "" {
+			secret, err = totp.GenerateSecret()
+			if err == nil {
+				err = database.SavePendingTOTP(userID, secret)
+			}
+			if err != nil {
+				http.Redirect(w, r, "/500", http.StatusSeeOther)
+				return
+			}
+		}
+
+		username, err := database.FetchUsernameByUserID(userID)
+		if err != nil {
+			http.Redirect(w, r, "/500", http.StatusSeeOther)
+			return
+		}
+		data.Secret = secret
+		uri := totp.URI(totpIssuer, username, secret)
+		data.URI = template.URL(uri)
+
+		code, err := qr.Encode(uri, qr.M)
+		if err != nil {
+			http.Redirect(w, r, "/500", http.StatusSeeOther)
+			return
+		}
+		code.Scale = 5
+		data.QRCode = template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(code.PNG()))
+	}
+
+	// The page may carry a secret or recovery codes, so keep it out of caches
+	w.Header().Set("Cache-Control", "no-store")
+	err = templates.ExecuteTemplate(w, "twofactor.html", data)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+	}
+}
+
+// startLoginChallenge parks a login that passed the password check until the second factor is given
+func startLoginChallenge(w http.ResponseWriter, r *http.Request, userID int) {
+	challengeToken, err := uuid.NewV4()
+	if err != nil {
+		renderLoginPage(w, r, "Error creating session")
+		return
+	}
+	if err := database.CreateLoginChallenge(userID, challengeToken.String()); err != nil {
+		renderLoginPage(w, r, "Error creating session")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "login_challenge",
+		Value:    challengeToken.String(),
+		Path:     "/login/2fa",
+		MaxAge:   int(database.LoginChallengeLifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, "/login/2fa", http.StatusSeeOther)
+}
+
+// LoginTwoFactor is the second login step, asking for an authenticator or recovery code
+func LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie("login_challenge")
+	if err != nil || cookie.Value == "" {
+		http.Redirect(w, r, "/auth", http.StatusSeeOther)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		if _, err := database.FetchLoginChallenge(cookie.Value); err != nil {
+			http.Redirect(w, r, "/auth", http.StatusSeeOther)
+			return
+		}
+		renderLoginTwoFactorPage(w, r, "")
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/405", http.StatusSeeOther)
+		return
+	}
+
+	userID, err := database.RecordLoginChallengeAttempt(cookie.Value)
+	if err == sql.ErrNoRows {
+		// Expired or out of attempts: the password has to be entered again
+		http.SetCookie(w, &http.Cookie{Name: "login_challenge", Value: "", Path: "/login/2fa", MaxAge: -1})
+		renderLoginPage(w, r, "Your login expired, please sign in again")
+		return
+	}
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	username, err := database.FetchUsernameByUserID(userID)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+
+	valid, err := verifySecondFactor(userID, r.FormValue("code"))
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	if !valid {
+		loginFailed(r, username, "bad_2fa_code")
+		renderLoginTwoFactorPage(w, r, "That code is not valid.")
+		return
+	}
+
+	if err := database.DeleteLoginChallenge(cookie.Value); err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: "login_challenge", Value: "", Path: "/login/2fa", MaxAge: -1})
+
+	err = startSession(w, r, userID)
+	if err != nil {
+		renderLoginPage(w, r, "Error creating session")
+		return
+	}
+	loginSucceeded(username)
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// renderLoginTwoFactorPage renders the second login step
+func renderLoginTwoFactorPage(w http.ResponseWriter, r *http.Request, errorMessage string) {
+	data := struct {
+		ErrorMessage string
+	}{
+		ErrorMessage: errorMessage,
+	}
+
+	err := templates.ExecuteTemplate(w, "login2fa.html", data)
+	if err != nil {
+		http.Redirect(w, r, "/500", http.StatusSeeOther)
+	}
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused recovery code
+func verifySecondFactor(userID int, code string) (bool, error) {
+	secret, enabled, lastStep, err := database.FetchTOTP(userID)
+	if err == sql.ErrNoRows || (err == nil && !enabled) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if step, ok := totp.Validate(secret, code, time.Now(), lastStep); ok {
+		return database.UseTOTPStep(userID, step)
+	}
+
+	normalized := normalizeRecoveryCode(code)
+	if len(normalized) != 10 {
+		return false, nil
+	}
+	codes, err := database.FetchUnusedRecoveryCodes(userID)
+	if err != nil {
+		return false, err
+	}
+	for _, recoveryCode := range codes {
+		if bcrypt.CompareHashAndPassword([]byte(recoveryCode.Hash), []byte(normalized)) == nil {
+			return database.UseRecoveryCode(recoveryCode.ID)
+		}
+	}
+	return false, nil
+}
+
+// generateRecoveryCodes returns fresh recovery codes for display together with their bcrypt hashes
+func generateRecoveryCodes() ([]string, []string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	var codes, hashes []string
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 7)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(encoding.EncodeToString(buf))[:10]
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, string(hash))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode strips the separator and spacing users may type
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// requireSession returns the signed-in user, sending guests to the login page
+func requireSession(w http.ResponseWriter, r *http.Request) (int, bool) {
+	cookie, err := r.Cookie("session_token")
+	if err != nil || cookie.Value == "" {
+		http.Redirect(w, r, "/auth", http.StatusSeeOther)
+		return 0, false
+	}
+
+	userID, err := database.FetchUserIDBySessionToken(cookie.Value)
+	if err != nil {
+		http.Redirect(w, r, "/auth", http.StatusSeeOther)
+		return 0, false
+	}
+	return userID, true
+}
+
+// sessionUserID returns the signed-in user, or 0 for guests
+func sessionUserID(r *http.Request) int {
+	cookie, err := r.Cookie("session_token")
+	if err != nil || cookie.Value == "" {
+		return 0
+	}
+	userID, err := database.FetchUserIDBySessionToken(cookie.Value)
+	if err != nil {
+		return 0
+	}
+	return userID
+}
@@ -1,24 +1,38 @@
 package root
 
-import "regexp"
+import (
+	"regexp"
+	"root/internal/registration"
+)
 
 func ValidateInput(username, email string) (bool, string) {
+	if valid, msg := ValidateUsername(username); !valid {
+		return false, msg
+	}
+
+	// Which domains may register is up to the registration policy
+	if !registration.ValidEmail(email) {
+		return false, "Please enter a valid email address."
+	}
+
+	return true, ""
+}
+
+// ValidateUsername checks the length and characters of a username
+func ValidateUsername(username string) (bool, string) {
+	if len(username) < 3 || len(username) > 50 {
+		return false, "Username must be between 3-50 characters"
+	}
+
 	// Username validation: allows only letters, numbers, and periods
 	usernameRegex := `^[a-zA-Z0-9.]+$`
 	if matched, _ := regexp.MatchString(usernameRegex, username); !matched {
 		return false, "Username can only contain letters, numbers, and periods, with no spaces or special characters."
 	}
-
-	// Email validation: allows only specific domains
-	emailRegex := `^[a-zA-Z0-9]([.]?[a-zA-Z0-9]+)*@(gmail\.com|hotmail\.com|yahoo\.com)$`
-	if matched, _ := regexp.MatchString(emailRegex, email); !matched {
-		return false, "Email can only contain alphanumerics and ( . ) which can not be placed in the beginning or end of the email and should be from gmail.com, hotmail.com, or yahoo.com."
-	}
-
 	return true, ""
 }
 
 func isValidColor(color string) bool {
 	matched, _ := regexp.MatchString(`^#(?:[0-9a-fA-F]{3}){1,2}$`, color)
 	return matched
-}
\ No newline at end of file
+}